@@ -0,0 +1,334 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 现金出入账原因代码
+const (
+	ReasonBankTransfer = "bank_transfer" // 银行转账入金/出金
+	ReasonPromotion    = "promotion"     // 活动赠送
+	ReasonAdjustment   = "adjustment"    // 人工调账
+	ReasonFee          = "fee"           // 费用扣收
+)
+
+var cashReasons = map[string]bool{
+	ReasonBankTransfer: true,
+	ReasonPromotion:    true,
+	ReasonAdjustment:   true,
+	ReasonFee:          true,
+}
+
+// checkReason 校验出入账原因代码
+func checkReason(reason string) error {
+	if !cashReasons[reason] {
+		return fmt.Errorf("invalid reason code %s", reason)
+	}
+	return nil
+}
+
+// CreateUser 开户：创建用户账户，用户名已存在时拒绝。
+// 初始余额（分）和个人资料通过 transient map 的 account 键传入，写入私有数据集合；初始余额不为 0 时只有管理员可以开户。
+func (s *StockSmartContract) CreateUser(ctx contractapi.TransactionContextInterface, username string) error {
+	if username == "" || strings.TrimSpace(username) != username {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	details, err := transientAccountDetails(ctx)
+	if err != nil {
+		return err
+	}
+	initialBalance := details.InitialBalance
+	if initialBalance < 0 {
+		return fmt.Errorf("initial balance must not be negative")
+	}
+	if initialBalance != 0 {
+		if err := requireAdmin(ctx); err != nil {
+			return err
+		}
+	}
+
+	exists, err := userExists(ctx, username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("user %s already exists", username)
+	}
+	closed, err := readClosedAccount(ctx, username)
+	if err != nil {
+		return err
+	}
+	if closed != nil {
+		return fmt.Errorf("username %s belongs to a closed account and cannot be reused", username)
+	}
+
+	// 账户绑定到开户交易的提交者
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	user := UserAccount{
+		Name:     username,
+		Stocks:   map[string]int{},
+		Balance:  initialBalance,
+		Balances: map[string]int64{},
+		History:  []string{fmt.Sprintf("Account opened with $%s", FormatCents(initialBalance))},
+		OwnerMSP: caller.MSPID,
+		OwnerID:  caller.ID,
+		RealName: details.RealName,
+		Email:    details.Email,
+	}
+	if err := writeUser(ctx, &user); err != nil {
+		return err
+	}
+	if initialBalance > 0 {
+		trades, err := newTradeLog(ctx)
+		if err != nil {
+			return err
+		}
+		if err := trades.recordCash(CashEntry{Username: username, Kind: CashOpening, Currency: DefaultCurrency}, initialBalance); err != nil {
+			return err
+		}
+	}
+	return emitEvent(ctx, StockEvent{Type: EventAccountOpened, Username: username})
+}
+
+// Deposit 管理员为用户入金（确认银行到账、活动赠送或调账），金额（分）通过 transient map 的 amount 键传入，
+// currency 为空时为基准币种，返回入金后该币种的余额
+func (s *StockSmartContract) Deposit(ctx contractapi.TransactionContextInterface, username string, currency string, reason string) (int64, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+	amount, err := transientAmount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive")
+	}
+	if currency, err = normalizeCurrency(currency); err != nil {
+		return 0, err
+	}
+	if err := checkReason(reason); err != nil {
+		return 0, err
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := user.addBalance(currency, amount); err != nil {
+		return 0, err
+	}
+	user.History = append(user.History, fmt.Sprintf("Deposited %s (%s)", formatMoney(currency, amount), reason))
+
+	if err := accounts.flush(); err != nil {
+		return 0, err
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := trades.recordCash(CashEntry{Username: username, Kind: CashDeposit, Currency: currency, Reason: reason}, amount); err != nil {
+		return 0, err
+	}
+	return user.balanceIn(currency), emitEvent(ctx, StockEvent{Type: EventCashDeposited, Username: username, Currency: currency, Reason: reason})
+}
+
+// Withdraw 出金，金额（分）通过 transient map 的 amount 键传入，currency 为空时为基准币种，
+// 该币种余额不足时拒绝，返回出金后该币种的余额
+func (s *StockSmartContract) Withdraw(ctx contractapi.TransactionContextInterface, username string, currency string, reason string) (int64, error) {
+	amount, err := transientAmount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive")
+	}
+	if currency, err = normalizeCurrency(currency); err != nil {
+		return 0, err
+	}
+	if err := checkReason(reason); err != nil {
+		return 0, err
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return 0, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return 0, err
+	}
+
+	if user.balanceIn(currency) < amount {
+		return 0, fmt.Errorf("insufficient balance. Available: %s", formatAmount(currency, user.balanceIn(currency)))
+	}
+	if err := user.addBalance(currency, -amount); err != nil {
+		return 0, err
+	}
+	user.History = append(user.History, fmt.Sprintf("Withdrew %s (%s)", formatMoney(currency, amount), reason))
+
+	if err := accounts.flush(); err != nil {
+		return 0, err
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := trades.recordCash(CashEntry{Username: username, Kind: CashWithdrawal, Currency: currency, Reason: reason}, amount); err != nil {
+		return 0, err
+	}
+	return user.balanceIn(currency), emitEvent(ctx, StockEvent{Type: EventCashWithdrawn, Username: username, Currency: currency, Reason: reason})
+}
+
+// ClosedAccount 销户墓碑记录，保留账户名、原绑定身份和余额去向，防止用户名被重新开户
+type ClosedAccount struct {
+	Name          string `json:"name"`          // 账户名
+	OwnerMSP      string `json:"ownerMsp"`      // 销户前绑定身份的 MSP ID
+	OwnerID       string `json:"ownerId"`       // 销户前绑定身份的证书 ID
+	PayoutAccount string `json:"payoutAccount"` // 余额转入的账户，直接销户时为空
+	TxID          string `json:"txId"`          // 销户交易
+	ClosedAt      string `json:"closedAt"`      // 销户时间（RFC3339）
+}
+
+// readClosedAccount 读取销户墓碑记录，账户未销户时返回 nil
+func readClosedAccount(ctx contractapi.TransactionContextInterface, username string) (*ClosedAccount, error) {
+	key, err := closedKey(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	closedJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if closedJSON == nil {
+		return nil, nil
+	}
+
+	var closed ClosedAccount
+	if err := json.Unmarshal(closedJSON, &closed); err != nil {
+		return nil, err
+	}
+	return &closed, nil
+}
+
+// writeClosedAccount 写入销户墓碑记录
+func writeClosedAccount(ctx contractapi.TransactionContextInterface, user *UserAccount, payoutAccount string, timestamp string) error {
+	key, err := closedKey(ctx, user.Name)
+	if err != nil {
+		return err
+	}
+	closed := ClosedAccount{
+		Name:          user.Name,
+		OwnerMSP:      user.OwnerMSP,
+		OwnerID:       user.OwnerID,
+		PayoutAccount: payoutAccount,
+		TxID:          ctx.GetStub().GetTxID(),
+		ClosedAt:      timestamp,
+	}
+	return putJSON(ctx, key, closed)
+}
+
+// GetClosedAccount 查询已销户账户的墓碑记录
+func (s *StockSmartContract) GetClosedAccount(ctx contractapi.TransactionContextInterface, username string) (*ClosedAccount, error) {
+	closed, err := readClosedAccount(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if closed == nil {
+		return nil, fmt.Errorf("account %s is not closed", username)
+	}
+	return closed, nil
+}
+
+// openOrders 按用户挂单索引返回用户全部未成交的挂单，按订单号排序
+func openOrders(ctx contractapi.TransactionContextInterface, username string) ([]*Order, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(userOrderObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var orders []*Order
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := readOrder(ctx, string(queryResponse.Value))
+		if err != nil {
+			return nil, err
+		}
+		if order.Status == OrderOpen {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// liquidateHoldings 按现价将用户全部持仓卖回发行方，股票数量归还流通量，所得计入股票计价币种的余额。
+// 持有停牌或已退市的股票时拒绝清仓。卖出前先结转成本，已实现盈亏计入交易记录。
+// 按股票代码顺序处理，保证各背书节点生成的交易记录一致
+func liquidateHoldings(ctx contractapi.TransactionContextInterface, accounts *accountCache, trades *tradeLog, user *UserAccount) error {
+	symbols := make([]string, 0, len(user.Stocks))
+	for symbol, quantity := range user.Stocks {
+		if quantity > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	// 先核对全部持仓都可以交易，再逐只卖出
+	stocks := make([]*StockToken, 0, len(symbols))
+	for _, symbol := range symbols {
+		stock, err := readStock(ctx, symbol)
+		if err != nil {
+			return err
+		}
+		if err := checkTradable(stock); err != nil {
+			return fmt.Errorf("cannot liquidate %s: %v", symbol, err)
+		}
+		stocks = append(stocks, stock)
+	}
+
+	for i, stock := range stocks {
+		symbol := symbols[i]
+		quantity := user.Stocks[symbol]
+		revenue, err := mulCents(stock.Price, quantity)
+		if err != nil {
+			return err
+		}
+		currency := stockCurrency(stock)
+		if err := user.addBalance(currency, revenue); err != nil {
+			return err
+		}
+		realized, err := accounts.disposeLots(user, symbol, quantity, revenue)
+		if err != nil {
+			return err
+		}
+		user.Stocks[symbol] = 0
+		stock.Quantity += quantity
+		if err := writeStock(ctx, stock); err != nil {
+			return err
+		}
+		if err := trades.record(Trade{Username: user.Name, Side: TradeSell, Symbol: symbol, Quantity: quantity, Price: stock.Price, Currency: currency, Amount: revenue, Realized: realized}); err != nil {
+			return err
+		}
+		if err := trades.recordTick(symbol, TickTrade, stock.Price, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
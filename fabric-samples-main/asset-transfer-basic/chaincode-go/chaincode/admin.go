@@ -0,0 +1,199 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 管理员身份判定：调用者必须属于 AdminMSPID，并且证书带有 AdminAttribute=true 属性（fabric-ca 签发），
+// 或者证书 OU 为 AdminOU（开启 NodeOUs 时 Admin@org 证书的 OU）。
+const (
+	AdminMSPID     = "Org1MSP"
+	AdminAttribute = "stock.admin"
+	AdminOU        = "admin"
+)
+
+// 股票交易状态
+const (
+	StockActive   = "active"
+	StockHalted   = "halted"
+	StockDelisted = "delisted"
+)
+
+// requireAdmin 校验调用者是否为管理员
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	identity := ctx.GetClientIdentity()
+	if identity == nil {
+		return fmt.Errorf("caller identity not available")
+	}
+
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	if mspID != AdminMSPID {
+		return fmt.Errorf("caller from %s is not authorized to perform admin operations", mspID)
+	}
+
+	if identity.AssertAttributeValue(AdminAttribute, "true") == nil {
+		return nil
+	}
+
+	cert, err := identity.GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get caller certificate: %v", err)
+	}
+	if cert != nil {
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if ou == AdminOU {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("caller is not an admin")
+}
+
+// checkTradable 校验股票当前是否允许交易，旧记录没有状态字段时视为正常交易
+func checkTradable(stock *StockToken) error {
+	switch stock.Status {
+	case StockDelisted:
+		return fmt.Errorf("stock %s is delisted", stock.Symbol)
+	case StockHalted:
+		return fmt.Errorf("stock %s is halted (%s)", stock.Symbol, stock.HaltReason)
+	}
+	return nil
+}
+
+// ListStock 管理员上市新股票，设置发行价（分）、发行量和计价币种，currency 为空时为基准币种，其他币种必须已设置汇率
+func (s *StockSmartContract) ListStock(ctx contractapi.TransactionContextInterface, stockID string, price int64, supply int, currency string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if stockID == "" {
+		return fmt.Errorf("stock symbol is required")
+	}
+	if price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+	if supply <= 0 {
+		return fmt.Errorf("supply must be positive")
+	}
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	if _, err := readFXRate(ctx, currency); err != nil {
+		return err
+	}
+
+	exists, err := stockExists(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("stock %s already exists", stockID)
+	}
+
+	session, err := tradingSession(ctx)
+	if err != nil {
+		return err
+	}
+	stock := StockToken{Symbol: stockID, Price: price, Quantity: supply, Supply: supply, Currency: currency, Status: StockActive, ReferencePrice: price, ReferenceDate: session}
+	if err := writeStock(ctx, &stock); err != nil {
+		return err
+	}
+	if err := recordPriceTick(ctx, stockID, TickListing, price); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventStockListed, Symbol: stockID, Price: price, Currency: currency, Quantity: supply})
+}
+
+// SetStockPrice 管理员调整股价（分），返回调价后的股票。
+// 正常交易的股票调价后偏离熔断参考价超过阈值时自动停牌，停牌原因为 circuit_breaker；参考价按交易日滚动（见 rollReferencePrice）。
+func (s *StockSmartContract) SetStockPrice(ctx contractapi.TransactionContextInterface, stockID string, price int64) (*StockToken, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if price <= 0 {
+		return nil, fmt.Errorf("price must be positive")
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Status == StockDelisted {
+		return nil, fmt.Errorf("stock %s is delisted", stockID)
+	}
+
+	if err := rollReferencePrice(ctx, stock); err != nil {
+		return nil, err
+	}
+	tripped := false
+	if stock.Status != StockHalted {
+		config, err := readCircuitBreaker(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if tripped, err = tripsCircuitBreaker(config, stock.ReferencePrice, price); err != nil {
+			return nil, err
+		}
+	}
+
+	stock.Price = price
+	event := StockEvent{Type: EventStockPriceSet, Symbol: stockID, Price: price}
+	if tripped {
+		stock.Status = StockHalted
+		stock.HaltReason = HaltCircuitBreaker
+		event = StockEvent{Type: EventStockHalted, Symbol: stockID, Price: price, Reason: HaltCircuitBreaker}
+	}
+	if err := writeStock(ctx, stock); err != nil {
+		return nil, err
+	}
+	if err := recordPriceTick(ctx, stockID, TickPrice, price); err != nil {
+		return nil, err
+	}
+	if err := emitEvent(ctx, event); err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// DelistStock 管理员退市股票：停止交易并撤销该股票所有挂单，用户已有持仓保留
+func (s *StockSmartContract) DelistStock(ctx contractapi.TransactionContextInterface, stockID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	if stock.Status == StockDelisted {
+		return fmt.Errorf("stock %s is already delisted", stockID)
+	}
+
+	book, err := s.GetOrderBook(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	accounts := newAccountCache(ctx)
+	for _, orders := range [][]Order{book.Bids, book.Asks} {
+		for i := range orders {
+			if err := s.cancelOrder(ctx, accounts, &orders[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+
+	stock.Status = StockDelisted
+	if err := writeStock(ctx, stock); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventStockDelisted, Symbol: stockID})
+}
@@ -0,0 +1,194 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+)
+
+// UserVersion 用户账户记录的一个历史版本，删除版本的 Value 为空账户
+type UserVersion struct {
+	TxID         string      `json:"txId"`         // 写入该版本的交易
+	Timestamp    string      `json:"timestamp"`    // 交易时间（RFC3339）
+	IsDelete     bool        `json:"isDelete"`     // 该版本是否为删除
+	Value        UserAccount `json:"value"`        // 该版本的账户记录，不含持仓
+	TradeIDs     []string    `json:"tradeIds"`     // 同一交易为该用户写入的交易记录，见 GetUserTrades
+	CashEntryIDs []string    `json:"cashEntryIds"` // 同一交易为该用户写入的现金流水，见 GetUserCashEntries
+}
+
+// StockVersion 股票记录的一个历史版本，删除版本的 Value 为空记录
+type StockVersion struct {
+	TxID      string     `json:"txId"`      // 写入该版本的交易
+	Timestamp string     `json:"timestamp"` // 交易时间（RFC3339）
+	IsDelete  bool       `json:"isDelete"`  // 该版本是否为删除
+	Value     StockToken `json:"value"`     // 该版本的股票记录
+}
+
+// keyHistory 读取某个键的全部历史版本，按时间先后排列
+func keyHistory(ctx contractapi.TransactionContextInterface, key string) ([]*queryresult.KeyModification, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var modifications []*queryresult.KeyModification
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		modifications = append(modifications, modification)
+	}
+
+	// 不同版本的 peer 返回顺序不同，统一按时间先后排序
+	sort.SliceStable(modifications, func(i, j int) bool {
+		return modifications[i].GetTimestamp().AsTime().Before(modifications[j].GetTimestamp().AsTime())
+	})
+	return modifications, nil
+}
+
+// recordHistory 读取记录在复合键和迁移前的旧键（legacyKey）下的全部历史版本，按时间先后合并
+func recordHistory(ctx contractapi.TransactionContextInterface, key string, legacyKey string) ([]*queryresult.KeyModification, error) {
+	legacy, err := keyHistory(ctx, legacyKey)
+	if err != nil {
+		return nil, err
+	}
+	current, err := keyHistory(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	modifications := append(legacy, current...)
+	sort.SliceStable(modifications, func(i, j int) bool {
+		return modifications[i].GetTimestamp().AsTime().Before(modifications[j].GetTimestamp().AsTime())
+	})
+	return modifications, nil
+}
+
+// recordIDsByTx 按交易号归集用户名下某类记录（交易记录或现金流水）的编号
+func recordIDsByTx(ctx contractapi.TransactionContextInterface, objectType string, username string) (map[string][]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ids := map[string][]string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record struct {
+			ID   string `json:"id"`
+			TxID string `json:"txId"`
+		}
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return nil, err
+		}
+		ids[record.TxID] = append(ids[record.TxID], record.ID)
+	}
+	return ids, nil
+}
+
+func modificationTime(modification *queryresult.KeyModification) string {
+	return modification.GetTimestamp().AsTime().UTC().Format(time.RFC3339Nano)
+}
+
+// GetUserHistory 返回用户账户公共记录的全部历史版本，包括存储布局迁移前 "user_"+username 旧键下的版本。
+// 公共记录只含用户名和绑定身份等字段，余额等私有字段保存在私有数据集合中，不出现在历史里（迁移前的旧版本除外）。
+// 余额变动通过交易记录和现金流水追溯：每个版本的 TradeIDs、CashEntryIDs 分别列出同一交易为该用户写入的交易记录和现金流水
+func (s *StockSmartContract) GetUserHistory(ctx contractapi.TransactionContextInterface, username string) ([]UserVersion, error) {
+	key, err := userKey(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	modifications, err := recordHistory(ctx, key, userResultPrefix+username)
+	if err != nil {
+		return nil, err
+	}
+	if len(modifications) == 0 {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+	tradeIDs, err := recordIDsByTx(ctx, tradeObjectType, username)
+	if err != nil {
+		return nil, err
+	}
+	cashEntryIDs, err := recordIDsByTx(ctx, cashEntryObjectType, username)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []UserVersion{}
+	for _, modification := range modifications {
+		version := UserVersion{
+			TxID:         modification.GetTxId(),
+			Timestamp:    modificationTime(modification),
+			IsDelete:     modification.GetIsDelete(),
+			TradeIDs:     tradeIDs[modification.GetTxId()],
+			CashEntryIDs: cashEntryIDs[modification.GetTxId()],
+		}
+		if version.TradeIDs == nil {
+			version.TradeIDs = []string{}
+		}
+		if version.CashEntryIDs == nil {
+			version.CashEntryIDs = []string{}
+		}
+		if !version.IsDelete {
+			user, _, err := decodeUserRecord(modification.GetValue())
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode user %s at tx %s: %v", username, version.TxID, err)
+			}
+			version.Value = *user
+		}
+		version.Value.Stocks = map[string]int{}
+		if version.Value.Balances == nil {
+			version.Value.Balances = map[string]int64{}
+		}
+		if version.Value.History == nil {
+			version.Value.History = []string{}
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// GetStockHistory 返回股票记录的全部历史版本，包括存储布局迁移前 "stock_"+symbol 旧键下的版本
+func (s *StockSmartContract) GetStockHistory(ctx contractapi.TransactionContextInterface, stockID string) ([]StockVersion, error) {
+	key, err := stockKey(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	modifications, err := recordHistory(ctx, key, stockResultPrefix+stockID)
+	if err != nil {
+		return nil, err
+	}
+	if len(modifications) == 0 {
+		return nil, fmt.Errorf("stock %s not found", stockID)
+	}
+
+	versions := []StockVersion{}
+	for _, modification := range modifications {
+		version := StockVersion{
+			TxID:      modification.GetTxId(),
+			Timestamp: modificationTime(modification),
+			IsDelete:  modification.GetIsDelete(),
+		}
+		if !version.IsDelete {
+			stock, _, err := decodeStockRecord(modification.GetValue())
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode stock %s at tx %s: %v", stockID, version.TxID, err)
+			}
+			version.Value = *stock
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
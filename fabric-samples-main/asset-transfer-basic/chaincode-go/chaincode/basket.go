@@ -0,0 +1,253 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// MaxBasketLegs 一个篮子委托最多包含的股票数
+const MaxBasketLegs = 20
+
+// BasketLeg 篮子委托中的一只股票，按发行方当前价格与流通池成交（同 BuyStock / SellStock），
+// 买入时当前价格不得高于限价，卖出时不得低于限价
+type BasketLeg struct {
+	Symbol     string `json:"symbol"`          // 股票代码
+	Side       string `json:"side"`            // buy / sell
+	Quantity   int    `json:"quantity"`        // 数量
+	LimitPrice int64  `json:"limitPriceCents"` // 限价（分）
+}
+
+// LegResult 篮子中一只股票的成交结果
+type LegResult struct {
+	Symbol   string `json:"symbol"`        // 股票代码
+	Side     string `json:"side"`          // buy / sell
+	Quantity int    `json:"quantity"`      // 成交数量
+	Price    int64  `json:"priceCents"`    // 成交价（分）
+	Currency string `json:"currency"`      // 计价币种
+	Amount   int64  `json:"amountCents"`   // 成交金额（分）
+	Fee      int64  `json:"feeCents"`      // 手续费（分）
+	Realized int64  `json:"realizedCents"` // 卖出的已实现盈亏（分），买入为 0
+}
+
+// BasketResult 篮子委托的执行结果，Legs 与提交的顺序一致
+type BasketResult struct {
+	Legs []LegResult      `json:"legs"`
+	Net  map[string]int64 `json:"netCents"` // 各币种现金净变动（分），含手续费，负数为支出
+}
+
+// basketLeg 校验通过、待执行的一只股票
+type basketLeg struct {
+	BasketLeg
+	stock    *StockToken
+	currency string
+	amount   int64
+	fee      int64
+}
+
+// parseBasket 解析并校验篮子委托，同一只股票只能出现一次
+func parseBasket(legsJSON string) ([]BasketLeg, error) {
+	var legs []BasketLeg
+	if err := json.Unmarshal([]byte(legsJSON), &legs); err != nil {
+		return nil, fmt.Errorf("legs must be a JSON array: %v", err)
+	}
+	if len(legs) == 0 || len(legs) > MaxBasketLegs {
+		return nil, fmt.Errorf("basket must have between 1 and %d legs", MaxBasketLegs)
+	}
+
+	seen := map[string]bool{}
+	for i, leg := range legs {
+		if leg.Side != SideBuy && leg.Side != SideSell {
+			return nil, fmt.Errorf("leg %d: invalid side %s, must be %s or %s", i+1, leg.Side, SideBuy, SideSell)
+		}
+		if leg.Quantity <= 0 {
+			return nil, fmt.Errorf("leg %d: quantity must be positive", i+1)
+		}
+		if leg.LimitPrice <= 0 {
+			return nil, fmt.Errorf("leg %d: limit price must be positive", i+1)
+		}
+		if seen[leg.Symbol] {
+			return nil, fmt.Errorf("leg %d: stock %s appears more than once in the basket", i+1, leg.Symbol)
+		}
+		seen[leg.Symbol] = true
+	}
+	return legs, nil
+}
+
+// SubmitBasket 在一笔交易内买卖多只股票，全部成交或全部不成交。
+// legsJSON 为 BasketLeg 数组；各股票的限价、流通池和持仓逐一校验，现金按币种合并核对：
+// 卖出所得与买入支出（含手续费）相抵后的净支出不得超过该币种余额。
+// clientOrderID 为客户端订单号，可为空；以相同订单号重复提交同一篮子时不会再次执行，返回原交易的结果
+func (s *StockSmartContract) SubmitBasket(ctx contractapi.TransactionContextInterface, username string, legsJSON string, clientOrderID string) (*BasketResult, error) {
+	legs, err := parseBasket(legsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+	// 以规范化后的 JSON 识别同一请求，忽略空白和字段顺序
+	normalized, err := json.Marshal(legs)
+	if err != nil {
+		return nil, err
+	}
+	request := string(normalized)
+	previous, err := replayClientOrder(ctx, username, clientOrderID, "SubmitBasket", request)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		var result BasketResult
+		if err := json.Unmarshal([]byte(previous.Result), &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐只校验并计算金额和手续费，此时尚未修改任何状态
+	pending := make([]basketLeg, 0, len(legs))
+	net := map[string]int64{}
+	for i, leg := range legs {
+		stock, err := readStock(ctx, leg.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %v", i+1, err)
+		}
+		if err := checkTradable(stock); err != nil {
+			return nil, fmt.Errorf("leg %d: %v", i+1, err)
+		}
+		if stock.Price <= 0 {
+			return nil, fmt.Errorf("leg %d: stock %s has no valid price", i+1, leg.Symbol)
+		}
+
+		if leg.Side == SideBuy {
+			if stock.Price > leg.LimitPrice {
+				return nil, fmt.Errorf("leg %d: price of %s is %s, above the limit of %s", i+1, leg.Symbol, FormatCents(stock.Price), FormatCents(leg.LimitPrice))
+			}
+			if stock.Quantity < leg.Quantity {
+				return nil, fmt.Errorf("leg %d: insufficient float of %s. Available: %d", i+1, leg.Symbol, stock.Quantity)
+			}
+		} else {
+			if stock.Price < leg.LimitPrice {
+				return nil, fmt.Errorf("leg %d: price of %s is %s, below the limit of %s", i+1, leg.Symbol, FormatCents(stock.Price), FormatCents(leg.LimitPrice))
+			}
+			if user.Stocks[leg.Symbol] < leg.Quantity {
+				return nil, fmt.Errorf("leg %d: insufficient shares of %s to sell", i+1, leg.Symbol)
+			}
+		}
+
+		amount, err := mulCents(stock.Price, leg.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		fee, err := schedule.fee(leg.Symbol, amount)
+		if err != nil {
+			return nil, err
+		}
+		currency := stockCurrency(stock)
+		change := amount - fee
+		if leg.Side == SideBuy {
+			if change, err = addCents(amount, fee); err != nil {
+				return nil, err
+			}
+			change = -change
+		}
+		if net[currency], err = addCents(net[currency], change); err != nil {
+			return nil, err
+		}
+		pending = append(pending, basketLeg{BasketLeg: leg, stock: stock, currency: currency, amount: amount, fee: fee})
+	}
+
+	// 按币种合并核对现金，币种排序保证错误信息确定
+	currencies := make([]string, 0, len(net))
+	for currency := range net {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		if available := user.balanceIn(currency); available+net[currency] < 0 {
+			return nil, fmt.Errorf("insufficient %s balance for basket. Required: %s, available: %s", currency, formatAmount(currency, -net[currency]), formatAmount(currency, available))
+		}
+	}
+
+	// 先卖后买，卖出所得可用于同一篮子中的买入
+	result := &BasketResult{Legs: make([]LegResult, len(pending)), Net: net}
+	for _, side := range []string{SideSell, SideBuy} {
+		for i := range pending {
+			leg := &pending[i]
+			if leg.Side != side {
+				continue
+			}
+			var realized int64
+			if side == SideSell {
+				user.Stocks[leg.Symbol] -= leg.Quantity
+				if err := user.addBalance(leg.currency, leg.amount); err != nil {
+					return nil, err
+				}
+				if err := chargeFee(accounts, schedule, user, leg.currency, leg.fee); err != nil {
+					return nil, err
+				}
+				if realized, err = accounts.disposeLots(user, leg.Symbol, leg.Quantity, leg.amount-leg.fee); err != nil {
+					return nil, err
+				}
+				leg.stock.Quantity += leg.Quantity
+			} else {
+				user.Stocks[leg.Symbol] += leg.Quantity
+				if err := user.addBalance(leg.currency, -leg.amount); err != nil {
+					return nil, err
+				}
+				if err := chargeFee(accounts, schedule, user, leg.currency, leg.fee); err != nil {
+					return nil, err
+				}
+				if err := accounts.acquireLot(username, leg.Symbol, leg.Quantity, leg.amount+leg.fee); err != nil {
+					return nil, err
+				}
+				leg.stock.Quantity -= leg.Quantity
+			}
+			result.Legs[i] = LegResult{Symbol: leg.Symbol, Side: side, Quantity: leg.Quantity, Price: leg.stock.Price, Currency: leg.currency, Amount: leg.amount, Fee: leg.fee, Realized: realized}
+		}
+	}
+
+	// 写回状态
+	if err := accounts.flush(); err != nil {
+		return nil, err
+	}
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, leg := range pending {
+		if err := writeStock(ctx, leg.stock); err != nil {
+			return nil, err
+		}
+		tradeSide := TradeBuy
+		if leg.Side == SideSell {
+			tradeSide = TradeSell
+		}
+		legResult := result.Legs[i]
+		if err := trades.record(Trade{Username: username, Side: tradeSide, Symbol: leg.Symbol, Quantity: leg.Quantity, Price: legResult.Price, Currency: leg.currency, Amount: leg.amount, Fee: leg.fee, Realized: legResult.Realized}); err != nil {
+			return nil, err
+		}
+		if err := trades.recordTick(leg.Symbol, TickTrade, legResult.Price, leg.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordClientOrder(ctx, username, clientOrderID, "SubmitBasket", request, result); err != nil {
+		return nil, err
+	}
+
+	return result, emitEvent(ctx, StockEvent{Type: EventBasketExecuted, Username: username, Count: len(pending)})
+}
@@ -0,0 +1,126 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 现金流水类型
+const (
+	CashOpening     = "opening"      // 开户初始余额
+	CashDeposit     = "deposit"      // 入金
+	CashWithdrawal  = "withdrawal"   // 出金
+	CashTransferIn  = "transfer_in"  // 现金转入
+	CashTransferOut = "transfer_out" // 现金转出，包括销户时余额转入收款账户
+)
+
+// CashEntry 用户余额的一笔入金、出金或现金转账。流水存储在公共账本 cashEntry 类型的键下，
+// 键为 [username, 交易时间纳秒, 记录编号]；金额保存在私有数据集合的同名键下，公共账本上只有它的哈希。
+type CashEntry struct {
+	ID           string `json:"id"`           // 记录编号：txID_序号，与同一交易的交易记录共用序号
+	TxID         string `json:"txId"`         // 产生该流水的交易
+	Username     string `json:"username"`     // 流水所属用户
+	Kind         string `json:"kind"`         // opening / deposit / withdrawal / transfer_in / transfer_out
+	Currency     string `json:"currency"`     // 币种
+	Reason       string `json:"reason"`       // 出入金原因代码，转账为空
+	Counterparty string `json:"counterparty"` // 转账对手方，出入金为空
+	Timestamp    string `json:"timestamp"`    // 交易时间（RFC3339）
+	Amount       int64  `json:"amountCents"`  // 金额（分），只保存在私有数据集合中，查询时只向集合成员组织内的账户本人和管理员返回
+	AmountHash   string `json:"amountHash"`   // 私有金额记录的哈希（十六进制 SHA-256），查询时填入
+}
+
+// cashAmount 现金流水保存在私有数据集合中的部分
+type cashAmount struct {
+	Amount int64 `json:"amountCents"`
+}
+
+func cashEntryKey(ctx contractapi.TransactionContextInterface, entry *CashEntry, nanos int64) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(cashEntryObjectType, []string{entry.Username, fmt.Sprintf("%020d", nanos), entry.ID})
+}
+
+// recordCash 补全编号、交易号和时间后写入现金流水，金额写入私有数据集合
+func (l *tradeLog) recordCash(entry CashEntry, amount int64) error {
+	entry.ID = fmt.Sprintf("%s_%03d", l.txID, l.seq)
+	entry.TxID = l.txID
+	entry.Timestamp = l.timestamp
+	entry.Amount = 0
+	entry.AmountHash = ""
+	l.seq++
+
+	key, err := cashEntryKey(l.ctx, &entry, l.nanos)
+	if err != nil {
+		return err
+	}
+	if err := putJSON(l.ctx, key, entry); err != nil {
+		return err
+	}
+	amountJSON, err := json.Marshal(cashAmount{Amount: amount})
+	if err != nil {
+		return err
+	}
+	return l.ctx.GetStub().PutPrivateData(UserPrivateCollection, key, amountJSON)
+}
+
+// recordCashTransfer 为转出方和转入方各写一条现金流水
+func (l *tradeLog) recordCashTransfer(from string, to string, currency string, amount int64) error {
+	if err := l.recordCash(CashEntry{Username: from, Kind: CashTransferOut, Currency: currency, Counterparty: to}, amount); err != nil {
+		return err
+	}
+	return l.recordCash(CashEntry{Username: to, Kind: CashTransferIn, Currency: currency, Counterparty: from}, amount)
+}
+
+// GetUserCashEntries 按时间先后返回用户的现金流水，只向账户本人和管理员返回。
+// 每条流水带有私有金额记录的哈希；调用者属于私有数据集合成员组织时同时返回金额
+func (s *StockSmartContract) GetUserCashEntries(ctx contractapi.TransactionContextInterface, username string) ([]CashEntry, error) {
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(cashEntryObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	readAmounts := canReadPrivate(ctx)
+	entries := []CashEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var entry CashEntry
+		if err := json.Unmarshal(queryResponse.Value, &entry); err != nil {
+			return nil, err
+		}
+		hash, err := ctx.GetStub().GetPrivateDataHash(UserPrivateCollection, queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private data hash of cash entry %s: %v", entry.ID, err)
+		}
+		entry.AmountHash = hex.EncodeToString(hash)
+		if readAmounts {
+			amountJSON, err := ctx.GetStub().GetPrivateData(UserPrivateCollection, queryResponse.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read amount of cash entry %s: %v", entry.ID, err)
+			}
+			if amountJSON != nil {
+				var amount cashAmount
+				if err := json.Unmarshal(amountJSON, &amount); err != nil {
+					return nil, err
+				}
+				entry.Amount = amount.Amount
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,341 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// DefaultCurrency 基准币种：未标注币种的旧股票记录按该币种计价，UserAccount.Balance 为该币种的现金余额
+const DefaultCurrency = "USD"
+
+// FXRateScale 汇率精度：汇率以 1 单位外币折合基准币种的金额 × 10^6 表示
+const FXRateScale = 1000000
+
+// FXRate 管理员维护的汇率，1 单位 Currency 折合 Rate / FXRateScale 单位基准币种
+type FXRate struct {
+	Currency  string `json:"currency"`   // 币种代码（ISO 4217）
+	Rate      int64  `json:"rateMicros"` // 1 单位该币种折合的基准币种金额 × 10^6
+	UpdatedAt string `json:"updatedAt"`  // 最近一次设置的时间（RFC3339）
+}
+
+// ValuationLine 估值明细中的一行：一种币种的现金或一只股票的持仓
+type ValuationLine struct {
+	Symbol    string `json:"symbol"`         // 股票代码，现金行为空
+	Quantity  int    `json:"quantity"`       // 持股数量（含挂卖单冻结的股票），现金行为 0
+	Currency  string `json:"currency"`       // 原币种
+	Value     int64  `json:"valueCents"`     // 原币金额（分），现金含挂买单冻结的部分
+	Converted int64  `json:"convertedCents"` // 折算为计价币种的金额（分）
+}
+
+// Valuation 用户资产估值，全部折算为 Currency 计价
+type Valuation struct {
+	Username string          `json:"username"`   // 用户名
+	Currency string          `json:"currency"`   // 计价币种
+	Total    int64           `json:"totalCents"` // 折算后的总资产（分）
+	Lines    []ValuationLine `json:"lines"`      // 现金按币种排列在前，持仓按股票代码排列在后
+}
+
+func fxKey(ctx contractapi.TransactionContextInterface, currency string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(fxObjectType, []string{currency})
+}
+
+// validCurrency 校验币种代码：三位大写字母
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for i := 0; i < len(currency); i++ {
+		if currency[i] < 'A' || currency[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCurrency 空币种视为基准币种，并校验币种代码
+func normalizeCurrency(currency string) (string, error) {
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if !validCurrency(currency) {
+		return "", fmt.Errorf("invalid currency %s", currency)
+	}
+	return currency, nil
+}
+
+// stockCurrency 返回股票的计价币种，旧记录没有币种时为基准币种
+func stockCurrency(stock *StockToken) string {
+	if stock.Currency == "" {
+		return DefaultCurrency
+	}
+	return stock.Currency
+}
+
+// formatMoney 格式化带币种的金额，基准币种沿用 "$" 前缀，例如 "$180.50"、"HKD 320.00"
+func formatMoney(currency string, cents int64) string {
+	if currency == DefaultCurrency {
+		return "$" + FormatCents(cents)
+	}
+	return currency + " " + FormatCents(cents)
+}
+
+// formatAmount 格式化错误信息中的金额，基准币种与旧版本一致不带币种，例如 "180.50"、"320.00 HKD"
+func formatAmount(currency string, cents int64) string {
+	if currency == DefaultCurrency {
+		return FormatCents(cents)
+	}
+	return FormatCents(cents) + " " + currency
+}
+
+// balanceIn 返回用户某币种的现金余额
+func (u *UserAccount) balanceIn(currency string) int64 {
+	if currency == DefaultCurrency {
+		return u.Balance
+	}
+	return u.Balances[currency]
+}
+
+// addBalance 调整用户某币种的现金余额，溢出或余额将为负时返回错误；非基准币种余额为 0 时不保留该币种
+func (u *UserAccount) addBalance(currency string, delta int64) error {
+	balance, err := addCents(u.balanceIn(currency), delta)
+	if err != nil {
+		return err
+	}
+	if balance < 0 {
+		return fmt.Errorf("insufficient %s balance of %s. Available: %s", currency, u.Name, formatAmount(currency, u.balanceIn(currency)))
+	}
+	if currency == DefaultCurrency {
+		u.Balance = balance
+		return nil
+	}
+	if u.Balances == nil {
+		u.Balances = map[string]int64{}
+	}
+	if balance == 0 {
+		delete(u.Balances, currency)
+	} else {
+		u.Balances[currency] = balance
+	}
+	return nil
+}
+
+// currencies 返回用户持有现金的全部币种，基准币种在前，其余按代码排序
+func (u *UserAccount) currencies() []string {
+	currencies := []string{DefaultCurrency}
+	others := make([]string, 0, len(u.Balances))
+	for currency := range u.Balances {
+		others = append(others, currency)
+	}
+	sort.Strings(others)
+	return append(currencies, others...)
+}
+
+// readFXRate 读取某币种的汇率，基准币种固定为 FXRateScale
+func readFXRate(ctx contractapi.TransactionContextInterface, currency string) (int64, error) {
+	if currency == DefaultCurrency {
+		return FXRateScale, nil
+	}
+	key, err := fxKey(ctx, currency)
+	if err != nil {
+		return 0, err
+	}
+	rateJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if rateJSON == nil {
+		return 0, fmt.Errorf("no FX rate for %s", currency)
+	}
+
+	var rate FXRate
+	if err := json.Unmarshal(rateJSON, &rate); err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// convertCents 将金额从 from 币种折算为 to 币种，四舍五入到分（0.5 远离零）
+func convertCents(ctx contractapi.TransactionContextInterface, cents int64, from string, to string) (int64, error) {
+	if from == to {
+		return cents, nil
+	}
+	fromRate, err := readFXRate(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := readFXRate(ctx, to)
+	if err != nil {
+		return 0, err
+	}
+	return scaleCents(cents, fromRate, toRate)
+}
+
+// writeFXRate 写入汇率，以交易时间作为更新时间，返回写入的记录
+func writeFXRate(ctx contractapi.TransactionContextInterface, currency string, rate int64) (*FXRate, error) {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	key, err := fxKey(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	fxRate := &FXRate{Currency: currency, Rate: rate, UpdatedAt: txTime.AsTime().UTC().Format(time.RFC3339Nano)}
+	return fxRate, putJSON(ctx, key, fxRate)
+}
+
+// SetFXRate 管理员设置汇率：1 单位 currency 折合 rateMicros / 10^6 单位基准币种
+func (s *StockSmartContract) SetFXRate(ctx contractapi.TransactionContextInterface, currency string, rateMicros int64) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if !validCurrency(currency) {
+		return fmt.Errorf("invalid currency %s", currency)
+	}
+	if currency == DefaultCurrency {
+		return fmt.Errorf("the rate of the base currency %s is fixed", DefaultCurrency)
+	}
+	if rateMicros <= 0 {
+		return fmt.Errorf("FX rate must be positive")
+	}
+
+	fxRate, err := writeFXRate(ctx, currency, rateMicros)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventFXRateSet, Currency: currency, FXRate: fxRate})
+}
+
+// GetFXRates 返回全部汇率，按币种代码排列
+func (s *StockSmartContract) GetFXRates(ctx contractapi.TransactionContextInterface) ([]FXRate, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(fxObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	rates := []FXRate{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var rate FXRate
+		if err := json.Unmarshal(queryResponse.Value, &rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// valuation 按当前股价和汇率计算用户资产，折算为 currency 计价。
+// 挂买单冻结的现金（限价×未成交数量加预留手续费）计入对应币种的现金，挂卖单冻结的股票计入持仓
+func valuation(ctx contractapi.TransactionContextInterface, user *UserAccount, currency string) (*Valuation, error) {
+	result := &Valuation{Username: user.Name, Currency: currency, Lines: []ValuationLine{}}
+	add := func(line ValuationLine) error {
+		converted, err := convertCents(ctx, line.Value, line.Currency, currency)
+		if err != nil {
+			return err
+		}
+		line.Converted = converted
+		if result.Total, err = addCents(result.Total, converted); err != nil {
+			return err
+		}
+		result.Lines = append(result.Lines, line)
+		return nil
+	}
+
+	cash := map[string]int64{}
+	for _, cashCurrency := range user.currencies() {
+		cash[cashCurrency] = user.balanceIn(cashCurrency)
+	}
+	held := map[string]int{}
+	for symbol, quantity := range user.Stocks {
+		held[symbol] += quantity
+	}
+	orders, err := openOrders(ctx, user.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		if order.Side == SideSell {
+			held[order.Symbol] += order.Remaining
+			continue
+		}
+		stock, err := readStock(ctx, order.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		reserved, err := mulCents(order.Price, order.Remaining)
+		if err != nil {
+			return nil, err
+		}
+		if reserved, err = addCents(reserved, order.FeeReserved); err != nil {
+			return nil, err
+		}
+		orderCurrency := stockCurrency(stock)
+		if cash[orderCurrency], err = addCents(cash[orderCurrency], reserved); err != nil {
+			return nil, err
+		}
+	}
+
+	currencies := make([]string, 0, len(cash))
+	for cashCurrency := range cash {
+		if cashCurrency != DefaultCurrency {
+			currencies = append(currencies, cashCurrency)
+		}
+	}
+	sort.Strings(currencies)
+	for _, cashCurrency := range append([]string{DefaultCurrency}, currencies...) {
+		if err := add(ValuationLine{Currency: cashCurrency, Value: cash[cashCurrency]}); err != nil {
+			return nil, err
+		}
+	}
+
+	symbols := make([]string, 0, len(held))
+	for symbol, quantity := range held {
+		if quantity > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		stock, err := readStock(ctx, symbol)
+		if err != nil {
+			return nil, err
+		}
+		value, err := mulCents(stock.Price, held[symbol])
+		if err != nil {
+			return nil, err
+		}
+		if err := add(ValuationLine{Symbol: symbol, Quantity: held[symbol], Currency: stockCurrency(stock), Value: value}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetUserValuation 查询用户各币种现金和持仓的市值，并按汇率折算为 currency（为空时为基准币种）
+func (s *StockSmartContract) GetUserValuation(ctx contractapi.TransactionContextInterface, username string, currency string) (*Valuation, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readFXRate(ctx, currency); err != nil {
+		return nil, err
+	}
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+	return valuation(ctx, user, currency)
+}
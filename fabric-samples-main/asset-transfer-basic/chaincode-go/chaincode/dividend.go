@@ -0,0 +1,261 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// recordDateLayout 登记日格式
+const recordDateLayout = "2006-01-02"
+
+// DividendDeclaration 一次现金分红的宣布记录，编号为 股票代码_登记日，同一只股票同一登记日只能分红一次
+type DividendDeclaration struct {
+	ID          string `json:"id"`            // 宣布编号：symbol_recordDate
+	Symbol      string `json:"symbol"`        // 股票代码
+	Currency    string `json:"currency"`      // 派息币种，即股票计价币种
+	PerShare    int64  `json:"perShareCents"` // 每股派息（分）
+	RecordDate  string `json:"recordDate"`    // 登记日（YYYY-MM-DD）
+	Holders     int    `json:"holders"`       // 获得派息的股东数
+	TotalShares int    `json:"totalShares"`   // 参与派息的股份总数
+	Total       int64  `json:"totalCents"`    // 派息总额（分）
+	TxID        string `json:"txId"`          // 宣布分红的交易
+	Timestamp   string `json:"timestamp"`     // 宣布时间（RFC3339）
+}
+
+// DividendPayment 某个股东在一次分红中获得的派息，键为 [username, declarationID]
+type DividendPayment struct {
+	DeclarationID string `json:"declarationId"` // 宣布编号
+	Username      string `json:"username"`      // 股东
+	Symbol        string `json:"symbol"`        // 股票代码
+	Currency      string `json:"currency"`      // 派息币种
+	Shares        int    `json:"shares"`        // 登记的股份数
+	PerShare      int64  `json:"perShareCents"` // 每股派息（分）
+	Amount        int64  `json:"amountCents"`   // 派息金额（分）
+	RecordDate    string `json:"recordDate"`    // 登记日
+	TxID          string `json:"txId"`          // 宣布分红的交易
+	Timestamp     string `json:"timestamp"`     // 到账时间（RFC3339）
+}
+
+func dividendKey(ctx contractapi.TransactionContextInterface, declarationID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(dividendObjectType, []string{declarationID})
+}
+
+func dividendPaymentKey(ctx contractapi.TransactionContextInterface, username string, declarationID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(dividendPaymentObjectType, []string{username, declarationID})
+}
+
+// stockPositions 返回某只股票全部股东的持股数（含挂卖单冻结的股份），以及按用户名排序的股东列表。
+// 可用持仓按股东索引读取
+func stockPositions(ctx contractapi.TransactionContextInterface, symbol string) (map[string]int, []string, error) {
+	positions := map[string]int{}
+
+	held, err := holders(ctx, symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, position := range held {
+		if position.Quantity > 0 {
+			positions[position.Username] += position.Quantity
+		}
+	}
+
+	// 挂卖单冻结的股份仍归下单用户所有
+	asks, err := sideOrders(ctx, symbol, SideSell)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, order := range asks {
+		positions[order.Username] += order.Remaining
+	}
+
+	holders := make([]string, 0, len(positions))
+	for username := range positions {
+		holders = append(holders, username)
+	}
+	sort.Strings(holders)
+	return positions, holders, nil
+}
+
+// DeclareDividend 管理员宣布现金分红，按宣布交易时的持股（含挂卖单冻结的股份）向每个股东派息并写入派息记录。
+// perShareAmount 为每股派息（分，股票计价币种），recordDate 为登记日（YYYY-MM-DD），不能晚于宣布日。
+// 同一只股票同一登记日以相同每股派息重复宣布时直接返回已有的宣布记录，不会重复派息；每股派息不同时拒绝。
+// 已退市的股票不能分红。
+func (s *StockSmartContract) DeclareDividend(ctx contractapi.TransactionContextInterface, stockID string, perShareAmount int64, recordDate string) (*DividendDeclaration, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if perShareAmount <= 0 {
+		return nil, fmt.Errorf("dividend per share must be positive")
+	}
+	date, err := time.Parse(recordDateLayout, recordDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record date %s, must be YYYY-MM-DD", recordDate)
+	}
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Status == StockDelisted {
+		return nil, fmt.Errorf("stock %s is delisted", stockID)
+	}
+	currency := stockCurrency(stock)
+
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	now := txTime.AsTime()
+	if date.After(now) {
+		return nil, fmt.Errorf("record date %s is in the future", recordDate)
+	}
+
+	declaration := DividendDeclaration{
+		ID:         stockID + "_" + recordDate,
+		Symbol:     stockID,
+		Currency:   currency,
+		PerShare:   perShareAmount,
+		RecordDate: recordDate,
+		TxID:       ctx.GetStub().GetTxID(),
+		Timestamp:  now.UTC().Format(time.RFC3339Nano),
+	}
+	key, err := dividendKey(ctx, declaration.ID)
+	if err != nil {
+		return nil, err
+	}
+	existingJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingJSON != nil {
+		var existing DividendDeclaration
+		if err := json.Unmarshal(existingJSON, &existing); err != nil {
+			return nil, err
+		}
+		if existing.PerShare != perShareAmount {
+			return nil, fmt.Errorf("dividend %s was already declared by transaction %s with %s per share", existing.ID, existing.TxID, formatMoney(existing.Currency, existing.PerShare))
+		}
+		return &existing, nil
+	}
+
+	positions, holders, err := stockPositions(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := newAccountCache(ctx)
+	for _, username := range holders {
+		shares := positions[username]
+		amount, err := mulCents(perShareAmount, shares)
+		if err != nil {
+			return nil, err
+		}
+		user, err := accounts.get(username)
+		if err != nil {
+			return nil, err
+		}
+		if err := user.addBalance(currency, amount); err != nil {
+			return nil, err
+		}
+		user.History = append(user.History, fmt.Sprintf("Dividend %s on %d %s", formatMoney(currency, amount), shares, stockID))
+
+		payment := DividendPayment{
+			DeclarationID: declaration.ID,
+			Username:      username,
+			Symbol:        stockID,
+			Currency:      currency,
+			Shares:        shares,
+			PerShare:      perShareAmount,
+			Amount:        amount,
+			RecordDate:    recordDate,
+			TxID:          declaration.TxID,
+			Timestamp:     declaration.Timestamp,
+		}
+		paymentKey, err := dividendPaymentKey(ctx, username, declaration.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := putJSON(ctx, paymentKey, payment); err != nil {
+			return nil, err
+		}
+
+		declaration.Holders++
+		declaration.TotalShares += shares
+		if declaration.Total, err = addCents(declaration.Total, amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := accounts.flush(); err != nil {
+		return nil, err
+	}
+	if err := putJSON(ctx, key, declaration); err != nil {
+		return nil, err
+	}
+
+	event := StockEvent{Type: EventDividendDeclared, Symbol: stockID, Quantity: declaration.TotalShares, Price: perShareAmount, Currency: currency, Amount: declaration.Total, Count: declaration.Holders}
+	if err := emitEvent(ctx, event); err != nil {
+		return nil, err
+	}
+	return &declaration, nil
+}
+
+// GetDividend 查询分红宣布记录
+func (s *StockSmartContract) GetDividend(ctx contractapi.TransactionContextInterface, declarationID string) (*DividendDeclaration, error) {
+	key, err := dividendKey(ctx, declarationID)
+	if err != nil {
+		return nil, err
+	}
+	declarationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil || declarationJSON == nil {
+		return nil, fmt.Errorf("dividend %s not found", declarationID)
+	}
+
+	var declaration DividendDeclaration
+	if err := json.Unmarshal(declarationJSON, &declaration); err != nil {
+		return nil, err
+	}
+	return &declaration, nil
+}
+
+// GetUserDividends 返回用户收到的全部派息记录
+func (s *StockSmartContract) GetUserDividends(ctx contractapi.TransactionContextInterface, username string) ([]DividendPayment, error) {
+	exists, err := userExists(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(dividendPaymentObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	payments := []DividendPayment{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var payment DividendPayment
+		if err := json.Unmarshal(queryResponse.Value, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+
+	// 键按宣布编号排序，返回时按到账时间先后排列
+	sort.SliceStable(payments, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, payments[i].Timestamp)
+		tj, _ := time.Parse(time.RFC3339Nano, payments[j].Timestamp)
+		return ti.Before(tj)
+	})
+	return payments, nil
+}
@@ -0,0 +1,82 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 链码事件名称。Fabric 每笔交易只保留最后一次 SetEvent，因此每个改变状态的函数在成功前发出且只发出一个事件。
+const (
+	EventLedgerInitialized   = "LedgerInitialized"
+	EventStockBought         = "StockBought"
+	EventStockSold           = "StockSold"
+	EventAccountOpened       = "AccountOpened"
+	EventAccountClosed       = "AccountClosed"
+	EventAccountBound        = "AccountBound"
+	EventAccountUpdated      = "AccountUpdated"
+	EventCashDeposited       = "CashDeposited"
+	EventCashWithdrawn       = "CashWithdrawn"
+	EventOrderPlaced         = "OrderPlaced"
+	EventOrderCancelled      = "OrderCancelled"
+	EventSharesTransferred   = "SharesTransferred"
+	EventCashTransferred     = "CashTransferred"
+	EventStockListed         = "StockListed"
+	EventStockPriceSet       = "StockPriceSet"
+	EventStockDelisted       = "StockDelisted"
+	EventAmountsMigrated     = "AmountsMigrated"
+	EventLayoutMigrated      = "LayoutMigrated"
+	EventPrivateDataMigrated = "PrivateDataMigrated"
+	EventDividendDeclared    = "DividendDeclared"
+	EventStockSplit          = "StockSplit"
+	EventStockHalted         = "StockHalted"
+	EventStockResumed        = "StockResumed"
+	EventCircuitBreakerSet   = "CircuitBreakerSet"
+	EventFeeScheduleSet      = "FeeScheduleSet"
+	EventFXRateSet           = "FXRateSet"
+	EventCostBasisMethodSet  = "CostBasisMethodSet"
+	EventQueryFieldsMigrated = "QueryFieldsMigrated"
+	EventHolderIndexMigrated = "HolderIndexMigrated"
+	EventOrderIndexMigrated  = "OrderIndexMigrated"
+	EventBasketExecuted      = "BasketExecuted"
+)
+
+// StockEvent 链码事件的负载，按事件类型填写相关字段，未用到的字段省略。
+// 事件对通道内所有组织可见，不包含余额、出入金和转账金额等私有数据。
+type StockEvent struct {
+	Type         string `json:"type"`                   // 事件名称
+	TxID         string `json:"txId"`                   // 产生事件的交易
+	Username     string `json:"username,omitempty"`     // 发起用户
+	Counterparty string `json:"counterparty,omitempty"` // 转让的接收方、销户的收款账户
+	Symbol       string `json:"symbol,omitempty"`       // 股票代码
+	Quantity     int    `json:"quantity,omitempty"`     // 股票数量
+	Price        int64  `json:"priceCents,omitempty"`   // 价格（分）
+	Currency     string `json:"currency,omitempty"`     // 价格和金额的币种
+	Amount       int64  `json:"amountCents,omitempty"`  // 买卖的成交金额、派息总额（分）；现金转账、出入金等余额变动不填写
+	Fee          int64  `json:"feeCents,omitempty"`     // 发起用户支付的手续费（分）
+	Reason       string `json:"reason,omitempty"`       // 出入金原因代码、停牌原因
+	Count        int    `json:"count,omitempty"`        // 记录数：迁移的记录数、派息的股东数、组合下单的订单数
+	Order        *Order `json:"order,omitempty"`        // 下单、撤单后的订单状态
+	Fills        []Fill `json:"fills,omitempty"`        // 下单时产生的成交
+
+	// 以下字段只出现在对应类型的事件中
+	FXRate          *FXRate         `json:"fxRate,omitempty"`          // FXRateSet：设置后的汇率
+	CircuitBreaker  *CircuitBreaker `json:"circuitBreaker,omitempty"`  // CircuitBreakerSet：设置后的熔断阈值
+	Split           *SplitResult    `json:"split,omitempty"`           // StockSplit：拆股比例、前后股价、调整的股东数和零股折现
+	CostBasisMethod string          `json:"costBasisMethod,omitempty"` // CostBasisMethodSet：设置后的成本计价方法
+	Collector       string          `json:"collector,omitempty"`       // FeeScheduleSet：当前的手续费账户
+}
+
+// emitEvent 补全交易号后以事件类型为名称发出链码事件
+func emitEvent(ctx contractapi.TransactionContextInterface, event StockEvent) error {
+	event.TxID = ctx.GetStub().GetTxID()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().SetEvent(event.Type, payload); err != nil {
+		return fmt.Errorf("failed to set event %s: %v", event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// feeScheduleConfigName 手续费配置在 config 类型下的名称
+const feeScheduleConfigName = "feeSchedule"
+
+// FeeRate 一档手续费费率：每笔费用 = 固定费用 + 成交金额 × 比例，低于最低收费时按最低收费。
+// 固定费用和最低收费以股票的计价币种计，手续费以该币种收取
+type FeeRate struct {
+	Flat        int64 `json:"flatCents"`    // 每笔固定费用（分）
+	BasisPoints int   `json:"basisPoints"`  // 按成交金额收取的比例（万分之一），四舍五入到分
+	Minimum     int64 `json:"minimumCents"` // 每笔最低收费（分）
+}
+
+// FeeSchedule 手续费配置。买卖双方每笔成交分别收取，手续费计入 Collector 账户；未配置时不收手续费
+type FeeSchedule struct {
+	Collector string             `json:"collector"` // 收取手续费的账户
+	Default   FeeRate            `json:"default"`   // 默认费率
+	Overrides map[string]FeeRate `json:"overrides"` // 按股票代码覆盖默认费率
+}
+
+// FeeQuote 手续费预估
+type FeeQuote struct {
+	Symbol   string `json:"symbol"`        // 股票代码
+	Currency string `json:"currency"`      // 计价币种
+	Side     string `json:"side"`          // buy / sell
+	Quantity int    `json:"quantity"`      // 数量
+	Price    int64  `json:"priceCents"`    // 价格（分）
+	Notional int64  `json:"notionalCents"` // 成交金额（分）
+	Fee      int64  `json:"feeCents"`      // 手续费（分）
+	Total    int64  `json:"totalCents"`    // 买入为应付总额，卖出为扣除手续费后的所得（分）
+}
+
+// rate 返回某只股票适用的费率
+func (f *FeeSchedule) rate(symbol string) FeeRate {
+	if rate, ok := f.Overrides[symbol]; ok {
+		return rate
+	}
+	return f.Default
+}
+
+// fee 计算某只股票一笔成交金额为 notional 的手续费
+func (f *FeeSchedule) fee(symbol string, notional int64) (int64, error) {
+	rate := f.rate(symbol)
+	variable, err := scaleCents(notional, int64(rate.BasisPoints), 10000)
+	if err != nil {
+		return 0, err
+	}
+	fee, err := addCents(rate.Flat, variable)
+	if err != nil {
+		return 0, err
+	}
+	if fee < rate.Minimum {
+		fee = rate.Minimum
+	}
+	return fee, nil
+}
+
+// validateFeeRate 校验费率参数
+func validateFeeRate(rate FeeRate) error {
+	if rate.Flat < 0 || rate.Minimum < 0 {
+		return fmt.Errorf("fees must not be negative")
+	}
+	if rate.BasisPoints < 0 || rate.BasisPoints > 10000 {
+		return fmt.Errorf("fee rate must be between 0 and 10000 basis points")
+	}
+	return nil
+}
+
+// readFeeSchedule 读取手续费配置，未配置时返回不收费的空配置
+func readFeeSchedule(ctx contractapi.TransactionContextInterface) (*FeeSchedule, error) {
+	key, err := configKey(ctx, feeScheduleConfigName)
+	if err != nil {
+		return nil, err
+	}
+	scheduleJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	schedule := FeeSchedule{Overrides: map[string]FeeRate{}}
+	if scheduleJSON == nil {
+		return &schedule, nil
+	}
+	if err := json.Unmarshal(scheduleJSON, &schedule); err != nil {
+		return nil, err
+	}
+	if schedule.Overrides == nil {
+		schedule.Overrides = map[string]FeeRate{}
+	}
+	return &schedule, nil
+}
+
+func writeFeeSchedule(ctx contractapi.TransactionContextInterface, schedule *FeeSchedule) error {
+	key, err := configKey(ctx, feeScheduleConfigName)
+	if err != nil {
+		return err
+	}
+	return putJSON(ctx, key, schedule)
+}
+
+// chargeFee 从付款方该币种余额中扣除手续费并计入手续费账户，账户变更由调用方统一写回
+func chargeFee(accounts *accountCache, schedule *FeeSchedule, payer *UserAccount, currency string, fee int64) error {
+	if fee == 0 {
+		return nil
+	}
+	if payer.balanceIn(currency) < fee {
+		return fmt.Errorf("insufficient balance for fee. Required: %s", formatAmount(currency, fee))
+	}
+	collector, err := accounts.get(schedule.Collector)
+	if err != nil {
+		return fmt.Errorf("fee collector unavailable: %v", err)
+	}
+	if err := payer.addBalance(currency, -fee); err != nil {
+		return err
+	}
+	return collector.addBalance(currency, fee)
+}
+
+// SetFeeSchedule 管理员设置手续费账户和默认费率，已有的按股票覆盖费率保持不变
+func (s *StockSmartContract) SetFeeSchedule(ctx contractapi.TransactionContextInterface, collector string, flatFee int64, basisPoints int, minimumFee int64) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	rate := FeeRate{Flat: flatFee, BasisPoints: basisPoints, Minimum: minimumFee}
+	if err := validateFeeRate(rate); err != nil {
+		return err
+	}
+	exists, err := userExists(ctx, collector)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("fee collector %s not found", collector)
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+	schedule.Collector = collector
+	schedule.Default = rate
+	if err := writeFeeSchedule(ctx, schedule); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventFeeScheduleSet, Collector: collector})
+}
+
+// SetSymbolFee 管理员为某只股票设置单独的费率，覆盖默认费率
+func (s *StockSmartContract) SetSymbolFee(ctx contractapi.TransactionContextInterface, stockID string, flatFee int64, basisPoints int, minimumFee int64) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	rate := FeeRate{Flat: flatFee, BasisPoints: basisPoints, Minimum: minimumFee}
+	if err := validateFeeRate(rate); err != nil {
+		return err
+	}
+	if _, err := readStock(ctx, stockID); err != nil {
+		return err
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+	if schedule.Collector == "" {
+		return fmt.Errorf("fee collector is not configured")
+	}
+	schedule.Overrides[stockID] = rate
+	if err := writeFeeSchedule(ctx, schedule); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventFeeScheduleSet, Symbol: stockID, Collector: schedule.Collector})
+}
+
+// RemoveSymbolFee 管理员删除某只股票的单独费率，恢复使用默认费率
+func (s *StockSmartContract) RemoveSymbolFee(ctx contractapi.TransactionContextInterface, stockID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := schedule.Overrides[stockID]; !ok {
+		return fmt.Errorf("stock %s has no fee override", stockID)
+	}
+	delete(schedule.Overrides, stockID)
+	if err := writeFeeSchedule(ctx, schedule); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventFeeScheduleSet, Symbol: stockID, Collector: schedule.Collector})
+}
+
+// GetFeeSchedule 查询当前手续费配置
+func (s *StockSmartContract) GetFeeSchedule(ctx contractapi.TransactionContextInterface) (*FeeSchedule, error) {
+	return readFeeSchedule(ctx)
+}
+
+// QuoteFee 预估一笔买卖的手续费，price 为 0 时按当前股价计算
+func (s *StockSmartContract) QuoteFee(ctx contractapi.TransactionContextInterface, stockID string, side string, quantity int, price int64) (*FeeQuote, error) {
+	if side != SideBuy && side != SideSell {
+		return nil, fmt.Errorf("invalid side %s, must be %s or %s", side, SideBuy, SideSell)
+	}
+	if quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+	if price < 0 {
+		return nil, fmt.Errorf("price must not be negative")
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	if price == 0 {
+		price = stock.Price
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	notional, err := mulCents(price, quantity)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := schedule.fee(stockID, notional)
+	if err != nil {
+		return nil, err
+	}
+
+	total := notional - fee
+	if side == SideBuy {
+		if total, err = addCents(notional, fee); err != nil {
+			return nil, err
+		}
+	}
+	return &FeeQuote{Symbol: stockID, Currency: stockCurrency(stock), Side: side, Quantity: quantity, Price: price, Notional: notional, Fee: fee, Total: total}, nil
+}
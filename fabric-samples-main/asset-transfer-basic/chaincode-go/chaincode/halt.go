@@ -0,0 +1,177 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 停牌原因代码，circuit_breaker 只由调价触发熔断时自动设置
+const (
+	HaltNewsPending    = "news_pending"    // 等待重大消息公布
+	HaltRegulatory     = "regulatory"      // 监管要求
+	HaltOperational    = "operational"     // 系统或运营原因
+	HaltCircuitBreaker = "circuit_breaker" // 价格波动超过熔断阈值
+)
+
+var manualHaltReasons = map[string]bool{
+	HaltNewsPending: true,
+	HaltRegulatory:  true,
+	HaltOperational: true,
+}
+
+// DefaultCircuitBreakerBasisPoints 未配置时的熔断阈值：偏离参考价 10%
+const DefaultCircuitBreakerBasisPoints = 1000
+
+// circuitBreakerConfigName 熔断配置在 config 类型下的名称
+const circuitBreakerConfigName = "circuitBreaker"
+
+// CircuitBreaker 熔断配置：调价偏离参考价超过 ThresholdBasisPoints（万分之一）时自动停牌，为 0 表示关闭熔断。
+// 参考价按交易日滚动，见 rollReferencePrice
+type CircuitBreaker struct {
+	ThresholdBasisPoints int `json:"thresholdBasisPoints"`
+}
+
+func configKey(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(configObjectType, []string{name})
+}
+
+// readCircuitBreaker 读取熔断配置，未配置时返回默认值
+func readCircuitBreaker(ctx contractapi.TransactionContextInterface) (*CircuitBreaker, error) {
+	key, err := configKey(ctx, circuitBreakerConfigName)
+	if err != nil {
+		return nil, err
+	}
+	configJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if configJSON == nil {
+		return &CircuitBreaker{ThresholdBasisPoints: DefaultCircuitBreakerBasisPoints}, nil
+	}
+
+	var config CircuitBreaker
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// tradingSession 返回当前交易所在的交易日，以交易时间的 UTC 日期计
+func tradingSession(ctx contractapi.TransactionContextInterface) (string, error) {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return txTime.AsTime().UTC().Format(recordDateLayout), nil
+}
+
+// rollReferencePrice 每个交易日第一次调价前，将熔断参考价滚动为上一交易日最后的股价（即本次调价前的价格）。
+// 同一交易日内参考价不变；上市和复牌时参考价重置为当时的价格。旧记录没有参考价或交易日时同样滚动
+func rollReferencePrice(ctx contractapi.TransactionContextInterface, stock *StockToken) error {
+	session, err := tradingSession(ctx)
+	if err != nil {
+		return err
+	}
+	if stock.ReferenceDate != session || stock.ReferencePrice == 0 {
+		stock.ReferencePrice = stock.Price
+		stock.ReferenceDate = session
+	}
+	return nil
+}
+
+// tripsCircuitBreaker 判断新价格相对参考价的偏离是否超过熔断阈值
+func tripsCircuitBreaker(config *CircuitBreaker, reference int64, price int64) (bool, error) {
+	if config.ThresholdBasisPoints == 0 || reference <= 0 {
+		return false, nil
+	}
+	limit, err := scaleCents(reference, int64(config.ThresholdBasisPoints), 10000)
+	if err != nil {
+		return false, err
+	}
+	move := price - reference
+	if move < 0 {
+		move = -move
+	}
+	return move > limit, nil
+}
+
+// SetCircuitBreaker 管理员设置熔断阈值（万分之一），0 表示关闭熔断
+func (s *StockSmartContract) SetCircuitBreaker(ctx contractapi.TransactionContextInterface, thresholdBasisPoints int) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if thresholdBasisPoints < 0 || thresholdBasisPoints > 10000 {
+		return fmt.Errorf("circuit breaker threshold must be between 0 and 10000 basis points")
+	}
+
+	key, err := configKey(ctx, circuitBreakerConfigName)
+	if err != nil {
+		return err
+	}
+	config := CircuitBreaker{ThresholdBasisPoints: thresholdBasisPoints}
+	if err := putJSON(ctx, key, config); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventCircuitBreakerSet, CircuitBreaker: &config})
+}
+
+// GetCircuitBreaker 查询当前熔断配置
+func (s *StockSmartContract) GetCircuitBreaker(ctx contractapi.TransactionContextInterface) (*CircuitBreaker, error) {
+	return readCircuitBreaker(ctx)
+}
+
+// HaltStock 管理员停牌股票，停牌期间不能买卖、下单和转让，已有挂单可以撤销
+func (s *StockSmartContract) HaltStock(ctx contractapi.TransactionContextInterface, stockID string, reason string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if !manualHaltReasons[reason] {
+		return fmt.Errorf("invalid halt reason %s", reason)
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	switch stock.Status {
+	case StockDelisted:
+		return fmt.Errorf("stock %s is delisted", stockID)
+	case StockHalted:
+		return fmt.Errorf("stock %s is already halted", stockID)
+	}
+
+	stock.Status = StockHalted
+	stock.HaltReason = reason
+	if err := writeStock(ctx, stock); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventStockHalted, Symbol: stockID, Price: stock.Price, Reason: reason})
+}
+
+// ResumeStock 管理员恢复停牌股票的交易，并以当前价格作为当日新的熔断参考价
+func (s *StockSmartContract) ResumeStock(ctx contractapi.TransactionContextInterface, stockID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	if stock.Status != StockHalted {
+		return fmt.Errorf("stock %s is not halted", stockID)
+	}
+
+	stock.Status = StockActive
+	stock.HaltReason = ""
+	stock.ReferencePrice = stock.Price
+	if stock.ReferenceDate, err = tradingSession(ctx); err != nil {
+		return err
+	}
+	if err := writeStock(ctx, stock); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventStockResumed, Symbol: stockID, Price: stock.Price})
+}
@@ -0,0 +1,122 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// MaxClientOrderIDLength 客户端订单号的最大长度
+const MaxClientOrderIDLength = 64
+
+// ClientOrder 记录一个客户端订单号对应的已执行请求，键为 [username, clientOrderID]。
+// 同一用户以相同订单号重复提交同一请求时不再执行，直接返回原交易的结果；订单号已用于不同请求时拒绝。
+// 同一区块内的并发重复提交都会读写该键，只有一笔能通过 MVCC 校验
+type ClientOrder struct {
+	Username      string `json:"username"`      // 下单用户
+	ClientOrderID string `json:"clientOrderId"` // 客户端订单号
+	Function      string `json:"function"`      // BuyStock / SellStock / PlaceOrder / SubmitBasket
+	Request       string `json:"request"`       // 请求参数，用于识别同一订单号的不同请求
+	TxID          string `json:"txId"`          // 原交易
+	Timestamp     string `json:"timestamp"`     // 原交易时间（RFC3339）
+	Result        string `json:"result"`        // 原交易的返回值（JSON），没有返回值时为空
+}
+
+func clientOrderKey(ctx contractapi.TransactionContextInterface, username string, clientOrderID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(clientOrderObjectType, []string{username, clientOrderID})
+}
+
+// replayClientOrder 查找客户端订单号的已有记录：未传订单号或没有记录时返回 nil，
+// 记录的请求与本次不同时返回错误。调用前须已校验调用者为账户所有者
+func replayClientOrder(ctx contractapi.TransactionContextInterface, username string, clientOrderID string, function string, request string) (*ClientOrder, error) {
+	if clientOrderID == "" {
+		return nil, nil
+	}
+	if len(clientOrderID) > MaxClientOrderIDLength {
+		return nil, fmt.Errorf("client order ID must be at most %d characters", MaxClientOrderIDLength)
+	}
+	key, err := clientOrderKey(ctx, username, clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, nil
+	}
+
+	var record ClientOrder
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return nil, err
+	}
+	if record.Function != function || record.Request != request {
+		return nil, fmt.Errorf("client order ID %s was already used by transaction %s for a different request", clientOrderID, record.TxID)
+	}
+	return &record, nil
+}
+
+// recordClientOrder 写入客户端订单号及本次交易的返回值，未传订单号时不写入
+func recordClientOrder(ctx contractapi.TransactionContextInterface, username string, clientOrderID string, function string, request string, result interface{}) error {
+	if clientOrderID == "" {
+		return nil
+	}
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	record := ClientOrder{
+		Username:      username,
+		ClientOrderID: clientOrderID,
+		Function:      function,
+		Request:       request,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     txTime.AsTime().UTC().Format(time.RFC3339Nano),
+	}
+	if result != nil {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		record.Result = string(resultJSON)
+	}
+
+	key, err := clientOrderKey(ctx, username, clientOrderID)
+	if err != nil {
+		return err
+	}
+	return putJSON(ctx, key, record)
+}
+
+// GetClientOrder 按客户端订单号查询已执行的请求，可用于确认超时的提交是否已上链。
+// 记录中的结果可能含有卖出所得，只向账户本人和管理员返回
+func (s *StockSmartContract) GetClientOrder(ctx contractapi.TransactionContextInterface, username string, clientOrderID string) (*ClientOrder, error) {
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+	key, err := clientOrderKey(ctx, username, clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("client order %s of user %s not found", clientOrderID, username)
+	}
+
+	var record ClientOrder
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
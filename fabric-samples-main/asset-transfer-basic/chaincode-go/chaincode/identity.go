@@ -0,0 +1,79 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// CallerIdentity 调用者的 X.509 身份：MSP ID 与 cid 包给出的证书 ID（由证书主题和颁发者生成）
+type CallerIdentity struct {
+	MSPID string `json:"mspId"`
+	ID    string `json:"id"`
+}
+
+// callerIdentity 读取当前交易提交者的身份
+func callerIdentity(ctx contractapi.TransactionContextInterface) (*CallerIdentity, error) {
+	identity := ctx.GetClientIdentity()
+	if identity == nil {
+		return nil, fmt.Errorf("caller identity not available")
+	}
+
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	id, err := identity.GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller ID: %v", err)
+	}
+	return &CallerIdentity{MSPID: mspID, ID: id}, nil
+}
+
+// requireOwner 校验调用者是账户绑定的身份或管理员。
+// 未绑定身份的账户（InitLedger 创建的演示账户、旧版本账户）只能由管理员操作，或先由管理员绑定。
+func requireOwner(ctx contractapi.TransactionContextInterface, user *UserAccount) error {
+	if requireAdmin(ctx) == nil {
+		return nil
+	}
+
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if user.OwnerMSP == "" {
+		return fmt.Errorf("account %s is not bound to an identity", user.Name)
+	}
+	if user.OwnerMSP != caller.MSPID || user.OwnerID != caller.ID {
+		return fmt.Errorf("caller is not the owner of account %s", user.Name)
+	}
+	return nil
+}
+
+// WhoAmI 返回调用者的身份，管理员据此将账户绑定到该身份
+func (s *StockSmartContract) WhoAmI(ctx contractapi.TransactionContextInterface) (*CallerIdentity, error) {
+	return callerIdentity(ctx)
+}
+
+// BindAccount 管理员将账户绑定到指定身份，此后只有该身份和管理员可以操作账户
+func (s *StockSmartContract) BindAccount(ctx contractapi.TransactionContextInterface, username string, mspID string, clientID string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if mspID == "" || clientID == "" {
+		return fmt.Errorf("msp ID and client ID are required")
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+
+	user.OwnerMSP = mspID
+	user.OwnerID = clientID
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventAccountBound, Username: username})
+}
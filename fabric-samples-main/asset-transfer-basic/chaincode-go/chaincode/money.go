@@ -0,0 +1,78 @@
+package chaincode
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// 金额统一使用 int64 表示的最小货币单位（分），不再使用 float64，避免多次交易后余额漂移。
+// 取整规则：
+//   - 客户端传入的金额本身已经是整数分，不做任何隐式取整；
+//   - 单价 × 数量 为整数乘法，结果精确，溢出时直接报错；
+//   - 需要除法的派生金额（比例分摊等）以及旧账本中的浮点数迁移，一律四舍五入到分（0.5 远离零）。
+
+// CentsPerUnit 一个货币单位包含的分数
+const CentsPerUnit = 100
+
+// mulCents 计算单价（分）乘以数量，溢出时返回错误
+func mulCents(price int64, amount int) (int64, error) {
+	if price == 0 || amount == 0 {
+		return 0, nil
+	}
+	total := price * int64(amount)
+	if total/int64(amount) != price {
+		return 0, fmt.Errorf("amount overflow: %d * %d", price, amount)
+	}
+	return total, nil
+}
+
+// addCents 两个金额相加，溢出时返回错误
+func addCents(a, b int64) (int64, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, fmt.Errorf("amount overflow: %d + %d", a, b)
+	}
+	return sum, nil
+}
+
+// scaleCents 计算 cents × numerator ÷ denominator，四舍五入到分（0.5 远离零），溢出时返回错误
+func scaleCents(cents int64, numerator int64, denominator int64) (int64, error) {
+	if denominator == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	product := new(big.Int).Mul(big.NewInt(cents), big.NewInt(numerator))
+	quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(denominator), new(big.Int))
+	// |余数| × 2 ≥ |除数| 时远离零进一
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(new(big.Int).Abs(big.NewInt(denominator))) >= 0 {
+		if (product.Sign() < 0) != (denominator < 0) {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() {
+		return 0, fmt.Errorf("amount overflow: %d * %d / %d", cents, numerator, denominator)
+	}
+	return quotient.Int64(), nil
+}
+
+// floatToCents 将旧账本中的浮点金额转换为分，四舍五入（0.5 远离零）
+func floatToCents(v float64) (int64, error) {
+	cents := math.Round(v * CentsPerUnit)
+	if math.IsNaN(cents) || math.IsInf(cents, 0) || cents > math.MaxInt64 || cents < math.MinInt64 {
+		return 0, fmt.Errorf("amount %v out of range", v)
+	}
+	return int64(cents), nil
+}
+
+// FormatCents 将分格式化为两位小数的字符串，例如 18050 -> "180.50"
+func FormatCents(cents int64) string {
+	sign := ""
+	u := uint64(cents)
+	if cents < 0 {
+		sign = "-"
+		u = uint64(-cents)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, u/CentsPerUnit, u%CentsPerUnit)
+}
@@ -0,0 +1,613 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 订单方向
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// 订单状态
+const (
+	OrderOpen      = "open"
+	OrderFilled    = "filled"
+	OrderCancelled = "cancelled"
+)
+
+// Order 表示一笔限价委托。
+// 买单挂单时按 限价×剩余数量 冻结现金，并按全部委托金额预留手续费，分笔成交的买方手续费合计以此为上限；卖单挂单时冻结股票。
+// 冻结部分保存在订单中，成交或撤单时释放。
+type Order struct {
+	ID            string `json:"id"`               // 订单号（下单交易的 txID）
+	Username      string `json:"username"`         // 下单用户
+	Symbol        string `json:"symbol"`           // 股票代码
+	Side          string `json:"side"`             // buy / sell
+	Price         int64  `json:"priceCents"`       // 限价（分）
+	Quantity      int    `json:"quantity"`         // 委托数量
+	Remaining     int    `json:"remaining"`        // 未成交数量
+	Status        string `json:"status"`           // open / filled / cancelled
+	FeeReserved   int64  `json:"feeReservedCents"` // 买单尚未使用的预留手续费（分）
+	Timestamp     string `json:"timestamp"`        // 下单时间（RFC3339）
+	ClientOrderID string `json:"clientOrderId"`    // 客户端订单号，未传时为空
+}
+
+// Fill 表示一笔撮合成交
+type Fill struct {
+	ID          string `json:"id"`             // 成交编号
+	Symbol      string `json:"symbol"`         // 股票代码
+	BuyOrderID  string `json:"buyOrderId"`     // 买方订单号
+	SellOrderID string `json:"sellOrderId"`    // 卖方订单号
+	Buyer       string `json:"buyer"`          // 买方用户
+	Seller      string `json:"seller"`         // 卖方用户
+	Price       int64  `json:"priceCents"`     // 成交价（分），取挂单方价格
+	Quantity    int    `json:"quantity"`       // 成交数量
+	BuyerFee    int64  `json:"buyerFeeCents"`  // 买方手续费（分）
+	SellerFee   int64  `json:"sellerFeeCents"` // 卖方手续费（分）
+	Timestamp   string `json:"timestamp"`      // 成交时间（RFC3339）
+}
+
+// OrderResult 下单结果：订单最新状态及本次产生的成交
+type OrderResult struct {
+	Order Order  `json:"order"`
+	Fills []Fill `json:"fills"`
+}
+
+// OrderBook 某只股票当前的买卖盘，按价格优先、时间优先排序
+type OrderBook struct {
+	Symbol string  `json:"symbol"`
+	Bids   []Order `json:"bids"`
+	Asks   []Order `json:"asks"`
+}
+
+// bookAttributes 返回某只股票某一方向挂单索引的复合键前缀属性
+func bookAttributes(symbol string, side string) []string {
+	return []string{symbol, side}
+}
+
+// bookKey 返回订单在挂单索引中的键。
+// 键中价格和时间均为定长数字，按复合键前缀查询的自然顺序即为撮合优先顺序：
+// 卖盘价格升序；买盘价格取反后升序（即价格降序）；同价按时间先后。
+func bookKey(ctx contractapi.TransactionContextInterface, order *Order, nanos int64) (string, error) {
+	price := order.Price
+	if order.Side == SideBuy {
+		price = math.MaxInt64 - order.Price
+	}
+	attributes := append(bookAttributes(order.Symbol, order.Side), fmt.Sprintf("%019d", price), fmt.Sprintf("%020d", nanos), order.ID)
+	return ctx.GetStub().CreateCompositeKey(bookObjectType, attributes)
+}
+
+// orderNanos 从订单时间戳还原纳秒时间，用于定位挂单索引
+func orderNanos(order *Order) (int64, error) {
+	t, err := time.Parse(time.RFC3339Nano, order.Timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp on order %s: %v", order.ID, err)
+	}
+	return t.UnixNano(), nil
+}
+
+// PlaceOrder 提交限价委托，按价格优先、时间优先与对手盘撮合，未成交部分挂单。
+// price 为限价（分），成交价取挂单方价格，买方按限价冻结的差额在成交时退回。
+// clientOrderID 为客户端订单号，可为空，保存在订单中；以相同订单号重复提交同一委托时不会再次下单，返回原交易的下单结果。
+func (s *StockSmartContract) PlaceOrder(ctx contractapi.TransactionContextInterface, username string, stockID string, side string, quantity int, price int64, clientOrderID string) (*OrderResult, error) {
+	if side != SideBuy && side != SideSell {
+		return nil, fmt.Errorf("invalid side %s, must be %s or %s", side, SideBuy, SideSell)
+	}
+	if quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+	if price <= 0 {
+		return nil, fmt.Errorf("price must be positive")
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+	request := fmt.Sprintf("%s|%s|%d|%d", stockID, side, quantity, price)
+	previous, err := replayClientOrder(ctx, username, clientOrderID, "PlaceOrder", request)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		var result OrderResult
+		if err := json.Unmarshal([]byte(previous.Result), &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTradable(stock); err != nil {
+		return nil, err
+	}
+
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	now := txTime.AsTime()
+	timestamp := now.UTC().Format(time.RFC3339Nano)
+
+	order := Order{
+		ID:            ctx.GetStub().GetTxID(),
+		ClientOrderID: clientOrderID,
+		Username:      username,
+		Symbol:        stockID,
+		Side:          side,
+		Price:         price,
+		Quantity:      quantity,
+		Remaining:     quantity,
+		Status:        OrderOpen,
+		Timestamp:     timestamp,
+	}
+
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 冻结下单所需的现金（股票计价币种，含预留手续费）或股票
+	currency := stockCurrency(stock)
+	if side == SideBuy {
+		notional, err := mulCents(price, quantity)
+		if err != nil {
+			return nil, err
+		}
+		if order.FeeReserved, err = schedule.fee(stockID, notional); err != nil {
+			return nil, err
+		}
+		reserved, err := addCents(notional, order.FeeReserved)
+		if err != nil {
+			return nil, err
+		}
+		if user.balanceIn(currency) < reserved {
+			return nil, fmt.Errorf("insufficient balance. Required: %s", formatAmount(currency, reserved))
+		}
+		if err := user.addBalance(currency, -reserved); err != nil {
+			return nil, err
+		}
+	} else {
+		if user.Stocks[stockID] < quantity {
+			return nil, fmt.Errorf("insufficient shares to sell")
+		}
+		user.Stocks[stockID] -= quantity
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fills, err := s.matchOrder(ctx, accounts, schedule, trades, &order, currency, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Remaining == 0 {
+		order.Status = OrderFilled
+	} else {
+		key, err := bookKey(ctx, &order, now.UnixNano())
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.GetStub().PutState(key, []byte(order.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeOrder(ctx, &order); err != nil {
+		return nil, err
+	}
+	if err := accounts.flush(); err != nil {
+		return nil, err
+	}
+
+	result := &OrderResult{Order: order, Fills: fills}
+	if err := recordClientOrder(ctx, username, clientOrderID, "PlaceOrder", request, result); err != nil {
+		return nil, err
+	}
+
+	event := StockEvent{Type: EventOrderPlaced, Username: username, Symbol: stockID, Quantity: quantity, Price: price, Currency: currency, Order: &order, Fills: fills}
+	if err := emitEvent(ctx, event); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// matchOrder 将新订单与对手盘逐笔撮合，以 currency 完成双方现金和股票的交割并写入双方的交易记录
+func (s *StockSmartContract) matchOrder(ctx contractapi.TransactionContextInterface, accounts *accountCache, schedule *FeeSchedule, trades *tradeLog, order *Order, currency string, timestamp string) ([]Fill, error) {
+	oppositeSide := SideSell
+	if order.Side == SideSell {
+		oppositeSide = SideBuy
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bookObjectType, bookAttributes(order.Symbol, oppositeSide))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	fills := []Fill{}
+	for order.Remaining > 0 && resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		resting, err := s.GetOrder(ctx, string(queryResponse.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		// 价格不再交叉时停止撮合
+		if (order.Side == SideBuy && resting.Price > order.Price) || (order.Side == SideSell && resting.Price < order.Price) {
+			break
+		}
+		// 不与自己的挂单成交
+		if resting.Username == order.Username {
+			continue
+		}
+
+		quantity := order.Remaining
+		if resting.Remaining < quantity {
+			quantity = resting.Remaining
+		}
+
+		buyOrder, sellOrder := order, resting
+		if order.Side == SideSell {
+			buyOrder, sellOrder = resting, order
+		}
+		fill := Fill{
+			ID:          fmt.Sprintf("%s_%03d", order.ID, len(fills)),
+			Symbol:      order.Symbol,
+			BuyOrderID:  buyOrder.ID,
+			SellOrderID: sellOrder.ID,
+			Buyer:       buyOrder.Username,
+			Seller:      sellOrder.Username,
+			Price:       resting.Price,
+			Quantity:    quantity,
+			Timestamp:   timestamp,
+		}
+		realized, err := settleFill(accounts, schedule, currency, buyOrder, &fill)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordFill(trades, currency, &fill, realized); err != nil {
+			return nil, err
+		}
+		if err := trades.recordTick(fill.Symbol, TickTrade, fill.Price, fill.Quantity); err != nil {
+			return nil, err
+		}
+
+		order.Remaining -= quantity
+		resting.Remaining -= quantity
+		if resting.Remaining == 0 {
+			resting.Status = OrderFilled
+			if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeOrder(ctx, resting); err != nil {
+			return nil, err
+		}
+
+		key, err := fillKey(ctx, fill.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := putJSON(ctx, key, fill); err != nil {
+			return nil, err
+		}
+		fills = append(fills, fill)
+	}
+
+	return fills, nil
+}
+
+// settleFill 交割一笔成交：买方获得股票并退回限价与成交价的差额，卖方获得现金，双方各自支付手续费。
+// 买方手续费从订单预留中释放再扣除，预留用完后的成交不再收取买方手续费，订单全部成交时退回剩余预留。
+// 买方按成交金额加手续费记入新的成本批次，卖方结转成本，返回卖方的已实现盈亏。
+func settleFill(accounts *accountCache, schedule *FeeSchedule, currency string, buyOrder *Order, fill *Fill) (int64, error) {
+	buyer, err := accounts.get(fill.Buyer)
+	if err != nil {
+		return 0, err
+	}
+	seller, err := accounts.get(fill.Seller)
+	if err != nil {
+		return 0, err
+	}
+
+	proceeds, err := mulCents(fill.Price, fill.Quantity)
+	if err != nil {
+		return 0, err
+	}
+	refund, err := mulCents(buyOrder.Price-fill.Price, fill.Quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	if fill.BuyerFee, err = schedule.fee(fill.Symbol, proceeds); err != nil {
+		return 0, err
+	}
+	if fill.SellerFee, err = schedule.fee(fill.Symbol, proceeds); err != nil {
+		return 0, err
+	}
+	// 买方各笔成交的手续费合计不超过下单时的预留，避免从买方余额中额外扣款
+	if fill.BuyerFee > buyOrder.FeeReserved {
+		fill.BuyerFee = buyOrder.FeeReserved
+	}
+	released := fill.BuyerFee
+	if fill.Quantity == buyOrder.Remaining {
+		released = buyOrder.FeeReserved
+	}
+	buyOrder.FeeReserved -= released
+	if refund, err = addCents(refund, released); err != nil {
+		return 0, err
+	}
+
+	buyer.Stocks[fill.Symbol] += fill.Quantity
+	if err := buyer.addBalance(currency, refund); err != nil {
+		return 0, err
+	}
+	if err := chargeFee(accounts, schedule, buyer, currency, fill.BuyerFee); err != nil {
+		return 0, err
+	}
+	if err := seller.addBalance(currency, proceeds); err != nil {
+		return 0, err
+	}
+	if err := chargeFee(accounts, schedule, seller, currency, fill.SellerFee); err != nil {
+		return 0, err
+	}
+
+	if err := accounts.acquireLot(fill.Buyer, fill.Symbol, fill.Quantity, proceeds+fill.BuyerFee); err != nil {
+		return 0, err
+	}
+	return accounts.disposeLots(seller, fill.Symbol, fill.Quantity, proceeds-fill.SellerFee)
+}
+
+// recordFill 为成交的买卖双方各写一条交易记录，realized 为卖方的已实现盈亏
+func recordFill(trades *tradeLog, currency string, fill *Fill, realized int64) error {
+	amount, err := mulCents(fill.Price, fill.Quantity)
+	if err != nil {
+		return err
+	}
+	if err := trades.record(Trade{Username: fill.Buyer, Side: TradeBuy, Symbol: fill.Symbol, Quantity: fill.Quantity, Price: fill.Price, Currency: currency, Amount: amount, Fee: fill.BuyerFee, Counterparty: fill.Seller}); err != nil {
+		return err
+	}
+	return trades.record(Trade{Username: fill.Seller, Side: TradeSell, Symbol: fill.Symbol, Quantity: fill.Quantity, Price: fill.Price, Currency: currency, Amount: amount, Fee: fill.SellerFee, Realized: realized, Counterparty: fill.Buyer})
+}
+
+// CancelOrder 撤销用户未成交的挂单，并释放冻结的现金或股票
+func (s *StockSmartContract) CancelOrder(ctx contractapi.TransactionContextInterface, username string, orderID string) error {
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Username != username {
+		return fmt.Errorf("order %s does not belong to user %s", orderID, username)
+	}
+	if order.Status != OrderOpen {
+		return fmt.Errorf("order %s is %s", orderID, order.Status)
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return err
+	}
+	if err := s.cancelOrder(ctx, accounts, order); err != nil {
+		return err
+	}
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventOrderCancelled, Username: username, Symbol: order.Symbol, Order: order})
+}
+
+// cancelOrder 撤单：释放冻结的现金（含预留手续费）或股票、删除挂单索引并更新订单状态，账户变更由调用方统一写回
+func (s *StockSmartContract) cancelOrder(ctx contractapi.TransactionContextInterface, accounts *accountCache, order *Order) error {
+	user, err := accounts.get(order.Username)
+	if err != nil {
+		return err
+	}
+	if order.Side == SideBuy {
+		stock, err := readStock(ctx, order.Symbol)
+		if err != nil {
+			return err
+		}
+		reserved, err := mulCents(order.Price, order.Remaining)
+		if err != nil {
+			return err
+		}
+		if reserved, err = addCents(reserved, order.FeeReserved); err != nil {
+			return err
+		}
+		if err := user.addBalance(stockCurrency(stock), reserved); err != nil {
+			return err
+		}
+		order.FeeReserved = 0
+	} else {
+		user.Stocks[order.Symbol] += order.Remaining
+	}
+
+	nanos, err := orderNanos(order)
+	if err != nil {
+		return err
+	}
+	key, err := bookKey(ctx, order, nanos)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+
+	order.Status = OrderCancelled
+	return writeOrder(ctx, order)
+}
+
+// writeOrder 写入订单，并同步用户挂单索引：未成交的订单写入索引，成交或撤销后删除
+func writeOrder(ctx contractapi.TransactionContextInterface, order *Order) error {
+	key, err := orderKey(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if err := putJSON(ctx, key, order); err != nil {
+		return err
+	}
+	return writeUserOrderIndex(ctx, order)
+}
+
+func userOrderKey(ctx contractapi.TransactionContextInterface, username string, orderID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(userOrderObjectType, []string{username, orderID})
+}
+
+// writeUserOrderIndex 维护用户挂单索引
+func writeUserOrderIndex(ctx contractapi.TransactionContextInterface, order *Order) error {
+	key, err := userOrderKey(ctx, order.Username, order.ID)
+	if err != nil {
+		return err
+	}
+	if order.Status == OrderOpen {
+		err = ctx.GetStub().PutState(key, []byte(order.ID))
+	} else {
+		err = ctx.GetStub().DelState(key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order index of user %s: %v", order.Username, err)
+	}
+	return nil
+}
+
+// MigrateOrderIndex 管理员根据现有订单重建用户挂单索引，升级前的账本需要执行一次，返回写入的索引数
+func (s *StockSmartContract) MigrateOrderIndex(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var order Order
+		if err := json.Unmarshal(queryResponse.Value, &order); err != nil {
+			return 0, err
+		}
+		if order.Status != OrderOpen {
+			continue
+		}
+		if err := writeUserOrderIndex(ctx, &order); err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	return migrated, emitEvent(ctx, StockEvent{Type: EventOrderIndexMigrated, Count: migrated})
+}
+
+// GetOrder 查询订单
+func (s *StockSmartContract) GetOrder(ctx contractapi.TransactionContextInterface, orderID string) (*Order, error) {
+	return readOrder(ctx, orderID)
+}
+
+// readOrder 读取订单记录
+func readOrder(ctx contractapi.TransactionContextInterface, orderID string) (*Order, error) {
+	key, err := orderKey(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	orderJSON, err := ctx.GetStub().GetState(key)
+	if err != nil || orderJSON == nil {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+
+	var order Order
+	if err := json.Unmarshal(orderJSON, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderBook 查询某只股票的买卖盘
+func (s *StockSmartContract) GetOrderBook(ctx contractapi.TransactionContextInterface, stockID string) (*OrderBook, error) {
+	bids, err := sideOrders(ctx, stockID, SideBuy)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := sideOrders(ctx, stockID, SideSell)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &OrderBook{Symbol: stockID, Bids: []Order{}, Asks: []Order{}}
+	for _, order := range bids {
+		book.Bids = append(book.Bids, *order)
+	}
+	for _, order := range asks {
+		book.Asks = append(book.Asks, *order)
+	}
+	return book, nil
+}
+
+// bookOrders 返回某只股票买卖两个方向的全部挂单
+func bookOrders(ctx contractapi.TransactionContextInterface, symbol string) ([]*Order, error) {
+	bids, err := sideOrders(ctx, symbol, SideBuy)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := sideOrders(ctx, symbol, SideSell)
+	if err != nil {
+		return nil, err
+	}
+	return append(bids, asks...), nil
+}
+
+// sideOrders 按挂单索引读取某只股票某一方向的全部挂单
+func sideOrders(ctx contractapi.TransactionContextInterface, symbol string, side string) ([]*Order, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bookObjectType, bookAttributes(symbol, side))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var orders []*Order
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := readOrder(ctx, string(queryResponse.Value))
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
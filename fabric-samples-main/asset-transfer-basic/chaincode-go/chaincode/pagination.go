@@ -0,0 +1,162 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// MaxPageSize 单页最多返回的记录数
+const MaxPageSize = 200
+
+// 资产分页书签的前缀，标记当前翻到了股票还是用户
+const (
+	assetStockBookmark = "stock:"
+	assetUserBookmark  = "user:"
+)
+
+// StockPage 股票分页结果，Bookmark 为空表示没有下一页
+type StockPage struct {
+	Stocks   map[string]StockToken `json:"stocks"`
+	Bookmark string                `json:"bookmark"`
+}
+
+// UserPage 用户分页结果，Bookmark 为空表示没有下一页
+type UserPage struct {
+	Users    map[string]UserAccount `json:"users"`
+	Bookmark string                 `json:"bookmark"`
+}
+
+// AssetPage 资产分页结果：先翻完股票再翻用户，Bookmark 为空表示没有下一页
+type AssetPage struct {
+	Assets   map[string]interface{} `json:"assets"`
+	Bookmark string                 `json:"bookmark"`
+}
+
+// checkPageSize 校验分页大小
+func checkPageSize(pageSize int32) error {
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		return fmt.Errorf("page size must be between 1 and %d", MaxPageSize)
+	}
+	return nil
+}
+
+// GetStocksPage 分页返回股票信息，bookmark 为上一页返回的书签，首页传空串
+func (s *StockSmartContract) GetStocksPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*StockPage, error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(stockObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &StockPage{Stocks: make(map[string]StockToken)}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var stock StockToken
+		err = json.Unmarshal(queryResponse.Value, &stock)
+		if err != nil {
+			continue
+		}
+		page.Stocks[stockResultPrefix+stock.Symbol] = stock
+	}
+
+	// 本页未取满说明已经到底
+	if metadata != nil && metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+	return page, nil
+}
+
+// GetUsersPage 分页返回用户信息，bookmark 为上一页返回的书签，首页传空串
+func (s *StockSmartContract) GetUsersPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*UserPage, error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(userObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &UserPage{Users: make(map[string]UserAccount)}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var user UserAccount
+		err = json.Unmarshal(queryResponse.Value, &user)
+		if err != nil {
+			continue
+		}
+		if err := fillPrivate(ctx, &user); err != nil {
+			return nil, err
+		}
+		user.Stocks, err = readHoldings(ctx, user.Name)
+		if err != nil {
+			return nil, err
+		}
+		page.Users[userResultPrefix+user.Name] = user
+	}
+
+	if metadata != nil && metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+	return page, nil
+}
+
+// GetAssetsPage 分页返回所有资产。书签带有 "stock:" 或 "user:" 前缀，记录当前翻到的对象类型；
+// 股票翻完后同一页剩余的名额继续用来取用户。
+func (s *StockSmartContract) GetAssetsPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*AssetPage, error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+
+	page := &AssetPage{Assets: make(map[string]interface{})}
+	remaining := pageSize
+
+	if !strings.HasPrefix(bookmark, assetUserBookmark) {
+		stocks, err := s.GetStocksPage(ctx, pageSize, strings.TrimPrefix(bookmark, assetStockBookmark))
+		if err != nil {
+			return nil, err
+		}
+		for key, stock := range stocks.Stocks {
+			page.Assets[key] = stock
+		}
+		if stocks.Bookmark != "" {
+			page.Bookmark = assetStockBookmark + stocks.Bookmark
+			return page, nil
+		}
+
+		remaining -= int32(len(stocks.Stocks))
+		if remaining <= 0 {
+			page.Bookmark = assetUserBookmark
+			return page, nil
+		}
+		bookmark = ""
+	}
+
+	users, err := s.GetUsersPage(ctx, remaining, strings.TrimPrefix(bookmark, assetUserBookmark))
+	if err != nil {
+		return nil, err
+	}
+	for key, user := range users.Users {
+		page.Assets[key] = user
+	}
+	if users.Bookmark != "" {
+		page.Bookmark = assetUserBookmark + users.Bookmark
+	}
+	return page, nil
+}
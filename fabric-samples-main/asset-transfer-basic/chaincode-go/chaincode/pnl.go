@@ -0,0 +1,415 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 成本计算方法
+const (
+	CostBasisFIFO    = "fifo"    // 先进先出：卖出时按买入先后消耗批次
+	CostBasisAverage = "average" // 移动平均：卖出时按全部批次的平均成本结转，剩余批次合并为一批
+)
+
+// Lot 一批买入（或转入）的股票及其成本。成本以股票的计价币种计，包含买入手续费
+type Lot struct {
+	Quantity   int    `json:"quantity"`   // 剩余数量
+	Cost       int64  `json:"costCents"`  // 剩余数量的总成本（分）
+	TxID       string `json:"txId"`       // 买入该批次的交易
+	AcquiredAt string `json:"acquiredAt"` // 买入时间（RFC3339）
+}
+
+// CostBasis 用户某只股票的成本记录，存储在 costBasis 类型的键下。
+// 批次按买入时间先后排列；挂单冻结的股票仍计入批次，成交时才结转。
+// 本功能上线前的持仓没有批次，其卖出不计入已实现盈亏
+type CostBasis struct {
+	Username string `json:"username"`      // 用户名
+	Symbol   string `json:"symbol"`        // 股票代码
+	Lots     []Lot  `json:"lots"`          // 持仓批次 ⬅️ 本字段必须初始化
+	Realized int64  `json:"realizedCents"` // 累计已实现盈亏（分），卖出所得扣除手续费后减去结转成本
+}
+
+// PositionPnL 单只股票的盈亏
+type PositionPnL struct {
+	Symbol     string `json:"symbol"`          // 股票代码
+	Currency   string `json:"currency"`        // 计价币种，以下金额均以该币种计
+	Quantity   int    `json:"quantity"`        // 持仓数量，含挂单冻结的股票
+	Untracked  int    `json:"untracked"`       // 没有成本记录的股数，不计入未实现盈亏
+	Price      int64  `json:"priceCents"`      // 当前股价（分）
+	Cost       int64  `json:"costCents"`       // 有成本记录部分的持仓成本（分）
+	Value      int64  `json:"valueCents"`      // 有成本记录部分的市值（分）
+	Realized   int64  `json:"realizedCents"`   // 累计已实现盈亏（分）
+	Unrealized int64  `json:"unrealizedCents"` // 未实现盈亏（分）：市值减持仓成本
+}
+
+// UserPnL 用户各持仓的盈亏，按股票代码排列
+type UserPnL struct {
+	Username  string        `json:"username"`  // 用户名
+	Method    string        `json:"method"`    // 成本计算方法
+	Positions []PositionPnL `json:"positions"` // 持仓或有已实现盈亏的股票
+}
+
+func costBasisKey(ctx contractapi.TransactionContextInterface, username string, symbol string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(costBasisObjectType, []string{username, symbol})
+}
+
+// costMethod 返回用户的成本计算方法，未设置时为先进先出
+func (u *UserAccount) costMethod() string {
+	if u.CostBasisMethod == "" {
+		return CostBasisFIFO
+	}
+	return u.CostBasisMethod
+}
+
+// lotQuantity 返回全部批次的股数和总成本
+func (b *CostBasis) lotQuantity() (int, int64) {
+	quantity, cost := 0, int64(0)
+	for _, lot := range b.Lots {
+		quantity += lot.Quantity
+		cost += lot.Cost
+	}
+	return quantity, cost
+}
+
+// take 按成本计算方法取出 quantity 股的批次，批次不足时取出全部，返回取出的批次和股数。
+// 部分取出的批次按股数比例分摊成本，四舍五入到分
+func (b *CostBasis) take(method string, quantity int) ([]Lot, int, error) {
+	held, totalCost := b.lotQuantity()
+	if quantity > held {
+		quantity = held
+	}
+	if quantity <= 0 {
+		return []Lot{}, 0, nil
+	}
+
+	if method == CostBasisAverage {
+		cost, err := scaleCents(totalCost, int64(quantity), int64(held))
+		if err != nil {
+			return nil, 0, err
+		}
+		first := b.Lots[0]
+		b.Lots = []Lot{}
+		if quantity < held {
+			b.Lots = append(b.Lots, Lot{Quantity: held - quantity, Cost: totalCost - cost, TxID: first.TxID, AcquiredAt: first.AcquiredAt})
+		}
+		return []Lot{{Quantity: quantity, Cost: cost, TxID: first.TxID, AcquiredAt: first.AcquiredAt}}, quantity, nil
+	}
+
+	taken := []Lot{}
+	remaining := quantity
+	for remaining > 0 {
+		lot := &b.Lots[0]
+		if lot.Quantity <= remaining {
+			taken = append(taken, *lot)
+			remaining -= lot.Quantity
+			b.Lots = b.Lots[1:]
+			continue
+		}
+		cost, err := scaleCents(lot.Cost, int64(remaining), int64(lot.Quantity))
+		if err != nil {
+			return nil, 0, err
+		}
+		taken = append(taken, Lot{Quantity: remaining, Cost: cost, TxID: lot.TxID, AcquiredAt: lot.AcquiredAt})
+		lot.Quantity -= remaining
+		lot.Cost -= cost
+		remaining = 0
+	}
+	return taken, quantity, nil
+}
+
+// split 按 numerator:denominator 调整批次：各批次按累计股数折算后向下取整，总成本不变。
+// 零股按拆股前股价折现，视为卖出，结转按股数比例分摊的成本并计入已实现盈亏。
+// 折算后为 0 股的批次，其成本并入后一批次（最后一批并入前一批次）
+func (b *CostBasis) split(numerator int, denominator int, oldPrice int64) error {
+	held, totalCost := b.lotQuantity()
+	if held == 0 {
+		return nil
+	}
+
+	scaled := int64(held) * int64(numerator)
+	remainder := scaled % int64(denominator)
+	fractionCost, err := scaleCents(totalCost, remainder, scaled)
+	if err != nil {
+		return err
+	}
+	cash, err := scaleCents(oldPrice, remainder, int64(numerator))
+	if err != nil {
+		return err
+	}
+
+	lots := []Lot{}
+	cumulative, previous, carry := int64(0), int64(0), int64(0)
+	for _, lot := range b.Lots {
+		cumulative += int64(lot.Quantity)
+		current := cumulative * int64(numerator) / int64(denominator)
+		lot.Cost += carry
+		carry = 0
+		if current == previous {
+			carry = lot.Cost
+			continue
+		}
+		lot.Quantity = int(current - previous)
+		previous = current
+		lots = append(lots, lot)
+	}
+	if len(lots) > 0 {
+		lots[len(lots)-1].Cost += carry
+	}
+
+	// 零股的成本从最新的批次开始扣除
+	pending := fractionCost
+	for i := len(lots) - 1; i >= 0 && pending > 0; i-- {
+		deducted := pending
+		if deducted > lots[i].Cost {
+			deducted = lots[i].Cost
+		}
+		lots[i].Cost -= deducted
+		pending -= deducted
+	}
+	b.Lots = lots
+
+	b.Realized, err = addCents(b.Realized, cash-fractionCost)
+	return err
+}
+
+// readCostBasis 读取用户某只股票的成本记录，不存在时返回空记录
+func readCostBasis(ctx contractapi.TransactionContextInterface, username string, symbol string) (*CostBasis, error) {
+	key, err := costBasisKey(ctx, username, symbol)
+	if err != nil {
+		return nil, err
+	}
+	basisJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	basis := CostBasis{Username: username, Symbol: symbol, Lots: []Lot{}}
+	if basisJSON == nil {
+		return &basis, nil
+	}
+	if err := json.Unmarshal(basisJSON, &basis); err != nil {
+		return nil, err
+	}
+	if basis.Lots == nil {
+		basis.Lots = []Lot{}
+	}
+	return &basis, nil
+}
+
+func writeCostBasis(ctx contractapi.TransactionContextInterface, basis *CostBasis) error {
+	key, err := costBasisKey(ctx, basis.Username, basis.Symbol)
+	if err != nil {
+		return err
+	}
+	return putJSON(ctx, key, basis)
+}
+
+// readCostBases 读取用户全部股票的成本记录
+func readCostBases(ctx contractapi.TransactionContextInterface, username string) (map[string]*CostBasis, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(costBasisObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	bases := map[string]*CostBasis{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var basis CostBasis
+		if err := json.Unmarshal(queryResponse.Value, &basis); err != nil {
+			return nil, err
+		}
+		if basis.Lots == nil {
+			basis.Lots = []Lot{}
+		}
+		bases[basis.Symbol] = &basis
+	}
+	return bases, nil
+}
+
+// newLot 以当前交易作为买入交易和买入时间创建批次
+func newLot(ctx contractapi.TransactionContextInterface, quantity int, cost int64) (Lot, error) {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return Lot{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return Lot{Quantity: quantity, Cost: cost, TxID: ctx.GetStub().GetTxID(), AcquiredAt: txTime.AsTime().UTC().Format(time.RFC3339Nano)}, nil
+}
+
+// lotTime 解析批次的买入时间，无法解析时视为最早
+func lotTime(lot Lot) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, lot.AcquiredAt)
+	return t
+}
+
+// acquireLot 用户买入 quantity 股，cost 为含手续费的总成本，记为一个新批次
+func (c *accountCache) acquireLot(username string, symbol string, quantity int, cost int64) error {
+	basis, err := c.costBasis(username, symbol)
+	if err != nil {
+		return err
+	}
+	lot, err := newLot(c.ctx, quantity, cost)
+	if err != nil {
+		return err
+	}
+	basis.Lots = append(basis.Lots, lot)
+	return nil
+}
+
+// disposeLots 用户卖出 quantity 股，proceeds 为扣除手续费后的所得，按用户的成本计算方法结转成本，返回已实现盈亏。
+// 没有成本记录的股份按股数比例扣除对应所得，不计入盈亏
+func (c *accountCache) disposeLots(user *UserAccount, symbol string, quantity int, proceeds int64) (int64, error) {
+	basis, err := c.costBasis(user.Name, symbol)
+	if err != nil {
+		return 0, err
+	}
+	taken, tracked, err := basis.take(user.costMethod(), quantity)
+	if err != nil {
+		return 0, err
+	}
+	if tracked == 0 {
+		return 0, nil
+	}
+
+	trackedProceeds, err := scaleCents(proceeds, int64(tracked), int64(quantity))
+	if err != nil {
+		return 0, err
+	}
+	realized := trackedProceeds
+	for _, lot := range taken {
+		realized -= lot.Cost
+	}
+	if basis.Realized, err = addCents(basis.Realized, realized); err != nil {
+		return 0, err
+	}
+	return realized, nil
+}
+
+// transferLots 转让 quantity 股时按转出方的成本计算方法取出批次，原成本和买入时间随股票转入接收方
+func (c *accountCache) transferLots(sender *UserAccount, receiver *UserAccount, symbol string, quantity int) error {
+	from, err := c.costBasis(sender.Name, symbol)
+	if err != nil {
+		return err
+	}
+	to, err := c.costBasis(receiver.Name, symbol)
+	if err != nil {
+		return err
+	}
+	taken, _, err := from.take(sender.costMethod(), quantity)
+	if err != nil {
+		return err
+	}
+	to.Lots = append(to.Lots, taken...)
+	sort.SliceStable(to.Lots, func(i, j int) bool {
+		return lotTime(to.Lots[i]).Before(lotTime(to.Lots[j]))
+	})
+	return nil
+}
+
+// SetCostBasisMethod 设置用户的成本计算方法：fifo（默认）或 average。
+// 改为 average 后下一次卖出时现有批次合并为一批，改回 fifo 不会恢复原批次
+func (s *StockSmartContract) SetCostBasisMethod(ctx contractapi.TransactionContextInterface, username string, method string) error {
+	if method != CostBasisFIFO && method != CostBasisAverage {
+		return fmt.Errorf("invalid cost basis method %s, must be %s or %s", method, CostBasisFIFO, CostBasisAverage)
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return err
+	}
+
+	user.CostBasisMethod = method
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventCostBasisMethodSet, Username: username, CostBasisMethod: method})
+}
+
+// GetUserPnL 查询用户各持仓的已实现和未实现盈亏，未实现盈亏按当前股价计算
+func (s *StockSmartContract) GetUserPnL(ctx contractapi.TransactionContextInterface, username string) (*UserPnL, error) {
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+	bases, err := readCostBases(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	// 挂卖单冻结的股票不在 user.Stocks 中，但仍计入批次，需要加回后再与批次比较
+	orders, err := openOrders(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]int{}
+	for symbol, quantity := range user.Stocks {
+		held[symbol] += quantity
+	}
+	for _, order := range orders {
+		if order.Side == SideSell {
+			held[order.Symbol] += order.Remaining
+		}
+	}
+
+	symbols := []string{}
+	for symbol, quantity := range held {
+		if _, ok := bases[symbol]; !ok && quantity > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	for symbol := range bases {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	result := &UserPnL{Username: username, Method: user.costMethod(), Positions: []PositionPnL{}}
+	for _, symbol := range symbols {
+		basis, ok := bases[symbol]
+		if !ok {
+			basis = &CostBasis{Username: username, Symbol: symbol, Lots: []Lot{}}
+		}
+		tracked, cost := basis.lotQuantity()
+		untracked := held[symbol] - tracked
+		if untracked < 0 {
+			untracked = 0
+		}
+		if tracked+untracked == 0 && basis.Realized == 0 {
+			continue
+		}
+
+		stock, err := readStock(ctx, symbol)
+		if err != nil {
+			return nil, err
+		}
+		value, err := mulCents(stock.Price, tracked)
+		if err != nil {
+			return nil, err
+		}
+		result.Positions = append(result.Positions, PositionPnL{
+			Symbol:     symbol,
+			Currency:   stockCurrency(stock),
+			Quantity:   tracked + untracked,
+			Untracked:  untracked,
+			Price:      stock.Price,
+			Cost:       cost,
+			Value:      value,
+			Realized:   basis.Realized,
+			Unrealized: value - cost,
+		})
+	}
+	return result, nil
+}
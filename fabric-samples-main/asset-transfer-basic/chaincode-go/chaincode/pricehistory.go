@@ -0,0 +1,150 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 价格记录来源
+const (
+	TickListing = "listing" // 上市发行价
+	TickPrice   = "price"   // 管理员调价
+	TickTrade   = "trade"   // 买卖或撮合成交
+	TickSplit   = "split"   // 拆股或合股后的股价
+)
+
+// barIntervals K 线周期
+var barIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// PriceTick 一次价格变动或成交，每条记录单独存储在 tick 类型的键下，
+// 键为 [symbol, 交易时间纳秒, 记录编号]，按股票前缀查询即按时间先后排列。
+type PriceTick struct {
+	ID        string `json:"id"`         // 记录编号：txID_序号
+	TxID      string `json:"txId"`       // 产生该记录的交易
+	Symbol    string `json:"symbol"`     // 股票代码
+	Source    string `json:"source"`     // listing / price / trade / split
+	Price     int64  `json:"priceCents"` // 价格（分）
+	Quantity  int    `json:"quantity"`   // 成交量，非成交记录为 0
+	Timestamp string `json:"timestamp"`  // 交易时间（RFC3339）
+}
+
+// PriceBar 一根 K 线，Start 为周期起点（UTC）
+type PriceBar struct {
+	Start  string `json:"start"`      // 周期起点（RFC3339）
+	Open   int64  `json:"openCents"`  // 开盘价（分）
+	High   int64  `json:"highCents"`  // 最高价（分）
+	Low    int64  `json:"lowCents"`   // 最低价（分）
+	Close  int64  `json:"closeCents"` // 收盘价（分）
+	Volume int    `json:"volume"`     // 成交量
+	Ticks  int    `json:"ticks"`      // 周期内的价格记录数
+}
+
+func tickKey(ctx contractapi.TransactionContextInterface, tick *PriceTick, nanos int64) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(tickObjectType, []string{tick.Symbol, fmt.Sprintf("%020d", nanos), tick.ID})
+}
+
+// recordTick 以交易时间写入一条价格记录，同一交易内的记录按写入顺序编号
+func (l *tradeLog) recordTick(symbol string, source string, price int64, quantity int) error {
+	tick := PriceTick{
+		ID:        fmt.Sprintf("%s_%03d", l.txID, l.tickSeq),
+		TxID:      l.txID,
+		Symbol:    symbol,
+		Source:    source,
+		Price:     price,
+		Quantity:  quantity,
+		Timestamp: l.timestamp,
+	}
+	l.tickSeq++
+
+	key, err := tickKey(l.ctx, &tick, l.nanos)
+	if err != nil {
+		return err
+	}
+	return putJSON(l.ctx, key, tick)
+}
+
+// recordPriceTick 供没有交易记录的函数（上市、调价、拆股）写入一条价格记录
+func recordPriceTick(ctx contractapi.TransactionContextInterface, symbol string, source string, price int64) error {
+	ticks, err := newTradeLog(ctx)
+	if err != nil {
+		return err
+	}
+	return ticks.recordTick(symbol, source, price, 0)
+}
+
+// GetPriceBars 按周期 interval（1m / 1h / 1d）将股票的价格记录汇总为 K 线，按时间先后排列，没有记录的周期不返回。
+// startTime、endTime 为 RFC3339 时间，包含起点不含终点，传空串表示不限。
+// 拆股前后的价格不做复权
+func (s *StockSmartContract) GetPriceBars(ctx contractapi.TransactionContextInterface, stockID string, interval string, startTime string, endTime string) ([]PriceBar, error) {
+	period, ok := barIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("invalid interval %s, must be 1m, 1h or 1d", interval)
+	}
+	start, err := parseTimeBound(startTime)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeBound(endTime)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readStock(ctx, stockID); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tickObjectType, []string{stockID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	bars := []PriceBar{}
+	var current *PriceBar
+	var currentStart time.Time
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var tick PriceTick
+		if err := json.Unmarshal(queryResponse.Value, &tick); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, tick.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp on price tick %s: %v", tick.ID, err)
+		}
+		if start != nil && t.Before(*start) {
+			continue
+		}
+		if end != nil && !t.Before(*end) {
+			continue
+		}
+
+		barStart := t.UTC().Truncate(period)
+		if current == nil || !barStart.Equal(currentStart) {
+			bars = append(bars, PriceBar{Start: barStart.Format(time.RFC3339), Open: tick.Price, High: tick.Price, Low: tick.Price})
+			current = &bars[len(bars)-1]
+			currentStart = barStart
+		}
+		if tick.Price > current.High {
+			current.High = tick.Price
+		}
+		if tick.Price < current.Low {
+			current.Low = tick.Price
+		}
+		current.Close = tick.Price
+		current.Volume += tick.Quantity
+		current.Ticks++
+	}
+
+	return bars, nil
+}
@@ -0,0 +1,244 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 用户余额、账户变动历史和个人资料保存在私有数据集合中，集合定义见 chaincode-go/collections_config.json。
+// 公共账本上只保留账户名、绑定身份和持仓，Fabric 会自动在公共账本记录私有数据的哈希。
+const (
+	UserPrivateCollection = "stockUserPrivate"
+	PrivateDataMSPID      = "Org1MSP" // 集合成员组织，只有该组织的调用者能查询到私有字段
+)
+
+// transient map 中的键，私有字段不出现在交易参数中
+const (
+	TransientAccountKey = "account" // AccountDetails 的 JSON
+	TransientAmountKey  = "amount"  // 出入金金额（分）的十进制字符串
+)
+
+// UserPrivate 用户账户中保存在私有数据集合的部分
+type UserPrivate struct {
+	DocType  string           `json:"docType"` // 记录类型 user，供富查询区分
+	Name     string           `json:"name"`
+	Balance  int64            `json:"balanceCents"`
+	Balances map[string]int64 `json:"balancesCents"`
+	History  []string         `json:"history"`
+	RealName string           `json:"realName"`
+	Email    string           `json:"email"`
+}
+
+// userRecord 用户账户中保存在公共账本的部分
+type userRecord struct {
+	Name            string `json:"name"`
+	OwnerMSP        string `json:"ownerMsp"`
+	OwnerID         string `json:"ownerId"`
+	CostBasisMethod string `json:"costBasisMethod,omitempty"`
+}
+
+// AccountDetails 开户或更新资料时通过 transient map 传入的私有字段
+type AccountDetails struct {
+	InitialBalance int64  `json:"initialBalanceCents"` // 仅开户时使用
+	RealName       string `json:"realName"`
+	Email          string `json:"email"`
+}
+
+// canReadPrivate 判断调用者所在组织是否为私有数据集合成员
+func canReadPrivate(ctx contractapi.TransactionContextInterface) bool {
+	identity := ctx.GetClientIdentity()
+	if identity == nil {
+		return false
+	}
+	mspID, err := identity.GetMSPID()
+	return err == nil && mspID == PrivateDataMSPID
+}
+
+// loadPrivate 从私有数据集合读取余额、历史和个人资料填入账户。
+// 私有记录不存在时保留公共记录中的旧字段（旧版本账户），下一次写回时自动迁移到集合中。
+func loadPrivate(ctx contractapi.TransactionContextInterface, user *UserAccount) error {
+	key, err := userKey(ctx, user.Name)
+	if err != nil {
+		return err
+	}
+	privateJSON, err := ctx.GetStub().GetPrivateData(UserPrivateCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to read private data of user %s: %v", user.Name, err)
+	}
+	if privateJSON != nil {
+		var private UserPrivate
+		if err := json.Unmarshal(privateJSON, &private); err != nil {
+			return err
+		}
+		user.Balance = private.Balance
+		user.Balances = private.Balances
+		user.History = private.History
+		user.RealName = private.RealName
+		user.Email = private.Email
+	}
+	if user.Balances == nil {
+		user.Balances = map[string]int64{}
+	}
+	if user.History == nil {
+		user.History = []string{}
+	}
+	return nil
+}
+
+// fillPrivate 供查询函数使用：集合成员组织中账户的绑定身份和管理员看到私有字段，其他调用者看到的私有字段为空。
+// 集合成员组织内的所有客户端都能读到私有数据，因此还要按账户归属过滤
+func fillPrivate(ctx contractapi.TransactionContextInterface, user *UserAccount) error {
+	if canReadPrivate(ctx) && requireOwner(ctx, user) == nil {
+		return loadPrivate(ctx, user)
+	}
+	user.Balance = 0
+	user.Balances = map[string]int64{}
+	user.History = []string{}
+	user.RealName = ""
+	user.Email = ""
+	return nil
+}
+
+// writePrivate 将账户的私有字段写入私有数据集合
+func writePrivate(ctx contractapi.TransactionContextInterface, key string, user *UserAccount) error {
+	private := UserPrivate{
+		DocType:  userObjectType,
+		Name:     user.Name,
+		Balance:  user.Balance,
+		Balances: user.Balances,
+		History:  user.History,
+		RealName: user.RealName,
+		Email:    user.Email,
+	}
+	privateJSON, err := json.Marshal(private)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutPrivateData(UserPrivateCollection, key, privateJSON)
+}
+
+// transientAccountDetails 读取 transient map 中的账户资料
+func transientAccountDetails(ctx contractapi.TransactionContextInterface) (*AccountDetails, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transient data: %v", err)
+	}
+	detailsJSON, ok := transient[TransientAccountKey]
+	if !ok {
+		return nil, fmt.Errorf("%s must be provided in the transient map", TransientAccountKey)
+	}
+
+	var details AccountDetails
+	if err := json.Unmarshal(detailsJSON, &details); err != nil {
+		return nil, fmt.Errorf("failed to decode %s from the transient map: %v", TransientAccountKey, err)
+	}
+	return &details, nil
+}
+
+// transientAmount 读取 transient map 中的金额（分）
+func transientAmount(ctx contractapi.TransactionContextInterface) (int64, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transient data: %v", err)
+	}
+	amountBytes, ok := transient[TransientAmountKey]
+	if !ok {
+		return 0, fmt.Errorf("%s must be provided in the transient map", TransientAmountKey)
+	}
+
+	amount, err := strconv.ParseInt(string(amountBytes), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %s in the transient map", amountBytes)
+	}
+	return amount, nil
+}
+
+// UpdateAccountDetails 更新账户的个人资料，资料通过 transient map 的 account 键传入
+func (s *StockSmartContract) UpdateAccountDetails(ctx contractapi.TransactionContextInterface, username string) error {
+	details, err := transientAccountDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return err
+	}
+
+	user.RealName = details.RealName
+	user.Email = details.Email
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventAccountUpdated, Username: username})
+}
+
+// GetUserPrivateHash 返回公共账本上记录的用户私有数据哈希（十六进制 SHA-256），任何组织都可以用它核对私有数据
+func (s *StockSmartContract) GetUserPrivateHash(ctx contractapi.TransactionContextInterface, username string) (string, error) {
+	key, err := userKey(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	hash, err := ctx.GetStub().GetPrivateDataHash(UserPrivateCollection, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read private data hash of user %s: %v", username, err)
+	}
+	if hash == nil {
+		return "", fmt.Errorf("user %s has no private data", username)
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// MigrateUserPrivateData 管理员将旧账户保存在公共账本上的余额和历史迁移到私有数据集合，返回迁移的账户数
+func (s *StockSmartContract) MigrateUserPrivateData(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(userObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		// 新格式的公共记录只有 name、ownerMsp、ownerId、costBasisMethod 等非私有字段
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(queryResponse.Value, &fields); err != nil {
+			return 0, err
+		}
+		if _, ok := fields["balanceCents"]; !ok {
+			if _, ok := fields["history"]; !ok {
+				continue
+			}
+		}
+
+		var user UserAccount
+		if err := json.Unmarshal(queryResponse.Value, &user); err != nil {
+			return 0, err
+		}
+		if err := loadPrivate(ctx, &user); err != nil {
+			return 0, err
+		}
+		if err := writeUser(ctx, &user); err != nil {
+			return 0, fmt.Errorf("failed to migrate user %s: %v", user.Name, err)
+		}
+		migrated++
+	}
+
+	return migrated, emitEvent(ctx, StockEvent{Type: EventPrivateDataMigrated, Count: migrated})
+}
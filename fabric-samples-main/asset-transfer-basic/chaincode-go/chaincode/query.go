@@ -0,0 +1,349 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 富查询依赖 CouchDB 状态数据库，索引定义随链码包发布：
+//   - META-INF/statedb/couchdb/indexes：公共账本上的 holding、stock 记录；
+//   - META-INF/statedb/couchdb/collections/stockUserPrivate/indexes：私有数据集合中的用户余额。
+//
+// 查询条件为 CouchDB 的 selector（JSON 对象），链码在外层加上 docType 条件，只在对应类型的记录中查找。
+// 富查询的结果在提交时不会重新校验，只用于查询，不要在交易函数中依据查询结果修改状态。
+
+// selectorOperators 允许在查询条件中使用的运算符
+var selectorOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$size": true, "$all": true, "$elemMatch": true,
+	"$and": true, "$or": true, "$nor": true, "$not": true,
+}
+
+// HoldingPage 持仓查询的分页结果，Bookmark 为空表示没有下一页
+type HoldingPage struct {
+	Holdings []Holding `json:"holdings"`
+	Bookmark string    `json:"bookmark"`
+}
+
+// StockQueryPage 股票查询的分页结果，Bookmark 为空表示没有下一页
+type StockQueryPage struct {
+	Stocks   []StockToken `json:"stocks"`
+	Bookmark string       `json:"bookmark"`
+}
+
+// UserBalance 用户各币种的现金余额，取自私有数据集合
+type UserBalance struct {
+	Name     string           `json:"name"`          // 用户名
+	Balance  int64            `json:"balanceCents"`  // 基准币种（USD）余额（分）
+	Balances map[string]int64 `json:"balancesCents"` // 其他币种余额（分）
+}
+
+// UserBalancePage 余额查询的分页结果，Bookmark 为本页最后一个用户名，为空表示没有下一页
+type UserBalancePage struct {
+	Users    []UserBalance `json:"users"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// checkSelector 校验查询条件只使用允许的运算符
+func checkSelector(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if strings.HasPrefix(key, "$") && !selectorOperators[key] {
+				return fmt.Errorf("unsupported selector operator %s", key)
+			}
+			if err := checkSelector(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := checkSelector(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// richQuery 将客户端的查询条件与 docType 及附加条件组合为 CouchDB 查询语句，sort 为排序字段，可为空
+func richQuery(docType string, selector string, extra []map[string]interface{}, sort ...string) (string, error) {
+	clauses := []interface{}{map[string]interface{}{"docType": docType}}
+	if strings.TrimSpace(selector) != "" {
+		var clientSelector map[string]interface{}
+		if err := json.Unmarshal([]byte(selector), &clientSelector); err != nil {
+			return "", fmt.Errorf("selector must be a JSON object: %v", err)
+		}
+		if err := checkSelector(clientSelector); err != nil {
+			return "", err
+		}
+		clauses = append(clauses, clientSelector)
+	}
+	for _, clause := range extra {
+		clauses = append(clauses, clause)
+	}
+
+	query := map[string]interface{}{"selector": map[string]interface{}{"$and": clauses}}
+	if len(sort) > 0 {
+		order := make([]map[string]string, 0, len(sort))
+		for _, field := range sort {
+			order = append(order, map[string]string{field: "asc"})
+		}
+		query["sort"] = order
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(queryJSON), nil
+}
+
+// collectHoldings 读取查询结果中的持仓记录
+func collectHoldings(resultsIterator shim.StateQueryIteratorInterface) ([]Holding, error) {
+	holdings := []Holding{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var holding Holding
+		if err := json.Unmarshal(queryResponse.Value, &holding); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, nil
+}
+
+// collectStocks 读取查询结果中的股票记录
+func collectStocks(resultsIterator shim.StateQueryIteratorInterface) ([]StockToken, error) {
+	stocks := []StockToken{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var stock StockToken
+		if err := json.Unmarshal(queryResponse.Value, &stock); err != nil {
+			return nil, err
+		}
+		stocks = append(stocks, stock)
+	}
+	return stocks, nil
+}
+
+// QueryHoldings 按查询条件返回持仓记录，字段为 username、symbol、quantity，
+// 例如持有 TSLA 超过 100 股：{"symbol": "TSLA", "quantity": {"$gt": 100}}
+func (s *StockSmartContract) QueryHoldings(ctx contractapi.TransactionContextInterface, selector string) ([]Holding, error) {
+	query, err := richQuery(holdingObjectType, selector, nil)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetQueryResult(query)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return collectHoldings(resultsIterator)
+}
+
+// QueryHoldingsPage 分页版本的 QueryHoldings，bookmark 为上一页返回的书签，首页传空串
+func (s *StockSmartContract) QueryHoldingsPage(ctx contractapi.TransactionContextInterface, selector string, pageSize int32, bookmark string) (*HoldingPage, error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+	query, err := richQuery(holdingObjectType, selector, nil)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	holdings, err := collectHoldings(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	page := &HoldingPage{Holdings: holdings}
+	// 本页未取满说明已经到底
+	if metadata != nil && metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+	return page, nil
+}
+
+// QueryStocks 按查询条件返回股票记录，字段为 symbol、priceCents、quantity、supply、currency、status 等，
+// 例如港币计价且正常交易的股票：{"currency": "HKD", "status": "active"}
+func (s *StockSmartContract) QueryStocks(ctx contractapi.TransactionContextInterface, selector string) ([]StockToken, error) {
+	query, err := richQuery(stockObjectType, selector, nil)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetQueryResult(query)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return collectStocks(resultsIterator)
+}
+
+// QueryStocksPage 分页版本的 QueryStocks，bookmark 为上一页返回的书签，首页传空串
+func (s *StockSmartContract) QueryStocksPage(ctx contractapi.TransactionContextInterface, selector string, pageSize int32, bookmark string) (*StockQueryPage, error) {
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+	query, err := richQuery(stockObjectType, selector, nil)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	stocks, err := collectStocks(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	page := &StockQueryPage{Stocks: stocks}
+	if metadata != nil && metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+	return page, nil
+}
+
+// queryUserBalances 在私有数据集合中按用户名顺序查询余额，after 非空时只返回用户名在其之后的记录，limit 为 0 表示不限
+func queryUserBalances(ctx contractapi.TransactionContextInterface, selector string, after string, limit int) ([]UserBalance, bool, error) {
+	var extra []map[string]interface{}
+	if after != "" {
+		extra = append(extra, map[string]interface{}{"name": map[string]interface{}{"$gt": after}})
+	}
+	query, err := richQuery(userObjectType, selector, extra, "docType", "name")
+	if err != nil {
+		return nil, false, err
+	}
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(UserPrivateCollection, query)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query private data: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	users := []UserBalance{}
+	for resultsIterator.HasNext() {
+		if limit > 0 && len(users) == limit {
+			return users, true, nil
+		}
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		var private UserPrivate
+		if err := json.Unmarshal(queryResponse.Value, &private); err != nil {
+			return nil, false, err
+		}
+		if private.Balances == nil {
+			private.Balances = map[string]int64{}
+		}
+		users = append(users, UserBalance{Name: private.Name, Balance: private.Balance, Balances: private.Balances})
+	}
+	return users, false, nil
+}
+
+// QueryUserBalances 管理员按查询条件返回用户余额，按用户名排序，字段为 name、balanceCents、balancesCents.<币种>，
+// 例如 USD 余额低于 1000：{"balanceCents": {"$lt": 100000}}
+func (s *StockSmartContract) QueryUserBalances(ctx contractapi.TransactionContextInterface, selector string) ([]UserBalance, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	users, _, err := queryUserBalances(ctx, selector, "", 0)
+	return users, err
+}
+
+// QueryUserBalancesPage 分页版本的 QueryUserBalances。私有数据不支持 Fabric 的分页查询，
+// 书签为本页最后一个用户名，下一页从其后的用户开始，首页传空串
+func (s *StockSmartContract) QueryUserBalancesPage(ctx contractapi.TransactionContextInterface, selector string, pageSize int32, bookmark string) (*UserBalancePage, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := checkPageSize(pageSize); err != nil {
+		return nil, err
+	}
+	users, more, err := queryUserBalances(ctx, selector, bookmark, int(pageSize))
+	if err != nil {
+		return nil, err
+	}
+	page := &UserBalancePage{Users: users}
+	if more {
+		page.Bookmark = users[len(users)-1].Name
+	}
+	return page, nil
+}
+
+// MigrateQueryFields 管理员为升级前写入的股票、持仓和私有余额记录补上 docType 字段，
+// 使其能被富查询检索，返回重写的股票和用户数
+func (s *StockSmartContract) MigrateQueryFields(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	stocksIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(stockObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer stocksIterator.Close()
+
+	migrated := 0
+	for stocksIterator.HasNext() {
+		queryResponse, err := stocksIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		var stock StockToken
+		if err := json.Unmarshal(queryResponse.Value, &stock); err != nil {
+			return 0, err
+		}
+		if stock.DocType == stockObjectType {
+			continue
+		}
+		if err := writeStock(ctx, &stock); err != nil {
+			return 0, fmt.Errorf("failed to migrate stock %s: %v", stock.Symbol, err)
+		}
+		migrated++
+	}
+
+	// 用户整体重写：私有记录和全部持仓都带上 docType
+	usersIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(userObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer usersIterator.Close()
+	for usersIterator.HasNext() {
+		queryResponse, err := usersIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		var record userRecord
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return 0, err
+		}
+		user, err := readUser(ctx, record.Name)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeUser(ctx, user); err != nil {
+			return 0, fmt.Errorf("failed to migrate user %s: %v", user.Name, err)
+		}
+		migrated++
+	}
+
+	return migrated, emitEvent(ctx, StockEvent{Type: EventQueryFieldsMigrated, Count: migrated})
+}
@@ -0,0 +1,125 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Position 用户对某只股票的可用持仓，不含挂卖单冻结的股份（见 GetOrderBook）
+type Position struct {
+	Username string `json:"username"` // 用户名
+	Symbol   string `json:"symbol"`   // 股票代码
+	Quantity int    `json:"quantity"` // 持有数量
+}
+
+// GetUserStocks 返回用户的全部持仓，按股票代码排序，一次查询完成
+func (s *StockSmartContract) GetUserStocks(ctx contractapi.TransactionContextInterface, username string) ([]Position, error) {
+	exists, err := userExists(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdingObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	positions := []Position{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var holding Holding
+		if err := json.Unmarshal(queryResponse.Value, &holding); err != nil {
+			return nil, err
+		}
+		if holding.Quantity > 0 {
+			positions = append(positions, Position{Username: holding.Username, Symbol: holding.Symbol, Quantity: holding.Quantity})
+		}
+	}
+	return positions, nil
+}
+
+// holders 按股东索引读取某只股票的全部持仓，按用户名排序
+func holders(ctx contractapi.TransactionContextInterface, symbol string) ([]Position, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holderObjectType, []string{symbol})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	positions := []Position{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		username := string(queryResponse.Value)
+		key, err := holdingKey(ctx, username, symbol)
+		if err != nil {
+			return nil, err
+		}
+		holdingJSON, err := ctx.GetStub().GetState(key)
+		if err != nil || holdingJSON == nil {
+			return nil, fmt.Errorf("holding %s of user %s not found", symbol, username)
+		}
+		var holding Holding
+		if err := json.Unmarshal(holdingJSON, &holding); err != nil {
+			return nil, err
+		}
+		positions = append(positions, Position{Username: username, Symbol: symbol, Quantity: holding.Quantity})
+	}
+	return positions, nil
+}
+
+// GetStockHolders 返回某只股票的股东名册（可用持仓），按用户名排序，一次查询完成
+func (s *StockSmartContract) GetStockHolders(ctx contractapi.TransactionContextInterface, stockID string) ([]Position, error) {
+	if _, err := readStock(ctx, stockID); err != nil {
+		return nil, err
+	}
+	return holders(ctx, stockID)
+}
+
+// MigrateHolderIndex 管理员根据现有持仓重建股东索引，升级前的账本需要执行一次，返回写入的索引数
+func (s *StockSmartContract) MigrateHolderIndex(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdingObjectType, []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var holding Holding
+		if err := json.Unmarshal(queryResponse.Value, &holding); err != nil {
+			return 0, err
+		}
+		if holding.Quantity == 0 {
+			continue
+		}
+		if err := writeHolderIndex(ctx, holding.Symbol, holding.Username, holding.Quantity); err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	return migrated, emitEvent(ctx, StockEvent{Type: EventHolderIndexMigrated, Count: migrated})
+}
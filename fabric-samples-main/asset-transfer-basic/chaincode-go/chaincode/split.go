@@ -0,0 +1,153 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// MaxSplitTerm 拆股比例分子、分母的上限
+const MaxSplitTerm = 1000
+
+// SplitResult 拆股（或合股）结果
+type SplitResult struct {
+	Symbol      string `json:"symbol"`          // 股票代码
+	Numerator   int    `json:"numerator"`       // 每 denominator 股变为 numerator 股
+	Denominator int    `json:"denominator"`     // 同上
+	OldPrice    int64  `json:"oldPriceCents"`   // 拆股前股价（分）
+	NewPrice    int64  `json:"newPriceCents"`   // 拆股后股价（分）
+	Holders     int    `json:"holders"`         // 调整持仓的股东数
+	Cancelled   int    `json:"cancelledOrders"` // 拆股前撤销的挂单数
+	CashInLieu  int64  `json:"cashInLieuCents"` // 零股折现总额（分）
+}
+
+// SplitStock 管理员对股票按 numerator:denominator 拆股（numerator > denominator）或合股（numerator < denominator），
+// 在一笔交易内完成以下调整：
+//   - 撤销该股票全部未成交挂单，释放冻结的现金和股票，挂单价格按旧股价计算，拆股后需重新下单；
+//   - 每个股东的持股变为 持股 × numerator ÷ denominator 向下取整，不足一股的零股按拆股前股价折现计入余额；
+//   - 股东的成本批次按同一比例折算，总成本不变，零股折现计入已实现盈亏；
+//   - 发行方流通量连同股东的零股一起按比例折算，向下取整，发行总量同样按比例向下取整，两者折算后仍然相符；
+//   - 股价变为 原股价 × denominator ÷ numerator，四舍五入到分。
+func (s *StockSmartContract) SplitStock(ctx contractapi.TransactionContextInterface, stockID string, numerator int, denominator int) (*SplitResult, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if numerator <= 0 || denominator <= 0 || numerator > MaxSplitTerm || denominator > MaxSplitTerm {
+		return nil, fmt.Errorf("split ratio terms must be between 1 and %d", MaxSplitTerm)
+	}
+	if numerator == denominator {
+		return nil, fmt.Errorf("split ratio must not be 1:1")
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Status == StockDelisted {
+		return nil, fmt.Errorf("stock %s is delisted", stockID)
+	}
+
+	newPrice, err := scaleCents(stock.Price, int64(denominator), int64(numerator))
+	if err != nil {
+		return nil, err
+	}
+	if newPrice <= 0 {
+		return nil, fmt.Errorf("split would make the price of %s less than one cent", stockID)
+	}
+
+	result := &SplitResult{
+		Symbol:      stockID,
+		Numerator:   numerator,
+		Denominator: denominator,
+		OldPrice:    stock.Price,
+		NewPrice:    newPrice,
+	}
+
+	// 先读取已提交状态中的股东（含挂单用户），再撤单，撤单释放的股票在账户缓存中归还持仓
+	_, holders, err := stockPositions(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := newAccountCache(ctx)
+	orders, err := bookOrders(ctx, stockID)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		if err := s.cancelOrder(ctx, accounts, order); err != nil {
+			return nil, err
+		}
+	}
+	result.Cancelled = len(orders)
+
+	// 零股（以新股份计）的分子之和，最终并入发行方流通量
+	fractions := int64(0)
+	for _, username := range holders {
+		user, err := accounts.get(username)
+		if err != nil {
+			return nil, err
+		}
+		quantity := user.Stocks[stockID]
+		if quantity <= 0 {
+			continue
+		}
+
+		scaled := int64(quantity) * int64(numerator)
+		newQuantity := int(scaled / int64(denominator))
+		remainder := scaled % int64(denominator)
+		fractions += remainder
+
+		// 零股 remainder/denominator 股新股，按拆股前股价折合 remainder/numerator 股旧股
+		cash, err := scaleCents(stock.Price, remainder, int64(numerator))
+		if err != nil {
+			return nil, err
+		}
+		if err := user.addBalance(stockCurrency(stock), cash); err != nil {
+			return nil, err
+		}
+		if result.CashInLieu, err = addCents(result.CashInLieu, cash); err != nil {
+			return nil, err
+		}
+
+		user.Stocks[stockID] = newQuantity
+		basis, err := accounts.costBasis(username, stockID)
+		if err != nil {
+			return nil, err
+		}
+		if err := basis.split(numerator, denominator, stock.Price); err != nil {
+			return nil, err
+		}
+		line := fmt.Sprintf("Split %d:%d %s: %d -> %d shares", numerator, denominator, stockID, quantity, newQuantity)
+		if cash > 0 {
+			line += fmt.Sprintf(", cash in lieu %s", formatMoney(stockCurrency(stock), cash))
+		}
+		user.History = append(user.History, line)
+		result.Holders++
+	}
+
+	stock.Quantity = int((int64(stock.Quantity)*int64(numerator) + fractions) / int64(denominator))
+	stock.Supply = int(int64(stock.Supply) * int64(numerator) / int64(denominator))
+	stock.Price = newPrice
+	if stock.ReferencePrice > 0 {
+		if stock.ReferencePrice, err = scaleCents(stock.ReferencePrice, int64(denominator), int64(numerator)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := accounts.flush(); err != nil {
+		return nil, err
+	}
+	if err := writeStock(ctx, stock); err != nil {
+		return nil, err
+	}
+	if err := recordPriceTick(ctx, stockID, TickSplit, newPrice); err != nil {
+		return nil, err
+	}
+
+	event := StockEvent{Type: EventStockSplit, Symbol: stockID, Price: newPrice, Split: result}
+	if err := emitEvent(ctx, event); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,358 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 账本中的对象类型，所有记录都以 CreateCompositeKey(objectType, attrs) 作为键，
+// 按类型列举时使用 GetStateByPartialCompositeKey，互不干扰。
+const (
+	stockObjectType   = "stock"   // 股票：[symbol]
+	userObjectType    = "user"    // 用户账户：[username]
+	holdingObjectType = "holding" // 用户持仓：[username, symbol]
+	holderObjectType  = "holder"  // 股东索引：[symbol, username]，值为用户名
+	orderObjectType   = "order"   // 订单：[orderID]
+	fillObjectType    = "fill"    // 成交：[fillID]
+	bookObjectType    = "book"    // 挂单索引：[symbol, side, price, time, orderID]
+	tradeObjectType   = "trade"   // 交易记录：[username, time, tradeID]
+	closedObjectType  = "closed"  // 销户墓碑：[username]
+
+	dividendObjectType        = "dividend"        // 分红宣布：[declarationID]
+	dividendPaymentObjectType = "dividendPayment" // 派息记录：[username, declarationID]
+	configObjectType          = "config"          // 合约配置：[name]
+	fxObjectType              = "fx"              // 汇率：[currency]
+	costBasisObjectType       = "costBasis"       // 持仓成本批次：[username, symbol]
+	tickObjectType            = "tick"            // 价格记录：[symbol, time, tickID]
+	clientOrderObjectType     = "clientOrder"     // 客户端订单号：[username, clientOrderID]
+	userOrderObjectType       = "userOrder"       // 用户挂单索引：[username, orderID]，值为订单号
+	cashEntryObjectType       = "cashEntry"       // 现金流水：[username, time, entryID]，金额在私有数据集合的同名键下
+)
+
+// 对外接口中仍以 "stock_"+symbol、"user_"+username 作为结果集的键，保持与旧版本兼容
+const (
+	stockResultPrefix = "stock_"
+	userResultPrefix  = "user_"
+)
+
+// Holding 表示某个用户对某只股票的持仓，单独存储在 holding 类型的键下
+type Holding struct {
+	DocType  string `json:"docType"`  // 记录类型 holding，供富查询区分
+	Username string `json:"username"` // 用户名
+	Symbol   string `json:"symbol"`   // 股票代码
+	Quantity int    `json:"quantity"` // 持有数量
+}
+
+func stockKey(ctx contractapi.TransactionContextInterface, symbol string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(stockObjectType, []string{symbol})
+}
+
+func userKey(ctx contractapi.TransactionContextInterface, username string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(userObjectType, []string{username})
+}
+
+func holdingKey(ctx contractapi.TransactionContextInterface, username string, symbol string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(holdingObjectType, []string{username, symbol})
+}
+
+func holderKey(ctx contractapi.TransactionContextInterface, symbol string, username string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(holderObjectType, []string{symbol, username})
+}
+
+func orderKey(ctx contractapi.TransactionContextInterface, orderID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(orderObjectType, []string{orderID})
+}
+
+func closedKey(ctx contractapi.TransactionContextInterface, username string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(closedObjectType, []string{username})
+}
+
+func fillKey(ctx contractapi.TransactionContextInterface, fillID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(fillObjectType, []string{fillID})
+}
+
+// putJSON 将对象序列化后写入账本
+func putJSON(ctx contractapi.TransactionContextInterface, key string, value interface{}) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, valueJSON)
+}
+
+// readStock 读取股票信息
+func readStock(ctx contractapi.TransactionContextInterface, symbol string) (*StockToken, error) {
+	key, err := stockKey(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	stockJSON, err := ctx.GetStub().GetState(key)
+	if err != nil || stockJSON == nil {
+		return nil, fmt.Errorf("stock %s not found", symbol)
+	}
+
+	var stock StockToken
+	if err := json.Unmarshal(stockJSON, &stock); err != nil {
+		return nil, err
+	}
+	return &stock, nil
+}
+
+// stockExists 判断股票是否存在
+func stockExists(ctx contractapi.TransactionContextInterface, symbol string) (bool, error) {
+	key, err := stockKey(ctx, symbol)
+	if err != nil {
+		return false, err
+	}
+	stockJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return stockJSON != nil, nil
+}
+
+// writeStock 写入股票信息
+func writeStock(ctx contractapi.TransactionContextInterface, stock *StockToken) error {
+	key, err := stockKey(ctx, stock.Symbol)
+	if err != nil {
+		return err
+	}
+	stock.DocType = stockObjectType
+	return putJSON(ctx, key, stock)
+}
+
+// readUser 读取用户账户，并从 holding 记录中组装 Stocks、从私有数据集合中读取余额等私有字段。
+// 调用者所在组织不是集合成员时读取失败，因此只用于需要余额的交易函数。
+func readUser(ctx contractapi.TransactionContextInterface, username string) (*UserAccount, error) {
+	key, err := userKey(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	userJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+	if userJSON == nil {
+		closed, err := readClosedAccount(ctx, username)
+		if err == nil && closed != nil {
+			return nil, fmt.Errorf("account %s is closed", username)
+		}
+		return nil, fmt.Errorf("user %s not found", username)
+	}
+
+	var user UserAccount
+	if err := json.Unmarshal(userJSON, &user); err != nil {
+		return nil, err
+	}
+	if err := loadPrivate(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	user.Stocks, err = readHoldings(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// userExists 判断用户是否存在
+func userExists(ctx contractapi.TransactionContextInterface, username string) (bool, error) {
+	key, err := userKey(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	userJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	return userJSON != nil, nil
+}
+
+// readHoldings 读取用户的全部持仓
+func readHoldings(ctx contractapi.TransactionContextInterface, username string) (map[string]int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdingObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	stocks := map[string]int{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var holding Holding
+		if err := json.Unmarshal(queryResponse.Value, &holding); err != nil {
+			return nil, err
+		}
+		stocks[holding.Symbol] = holding.Quantity
+	}
+	return stocks, nil
+}
+
+// writeHolderIndex 维护股东索引：持仓为 0 时删除索引，否则写入
+func writeHolderIndex(ctx contractapi.TransactionContextInterface, symbol string, username string, quantity int) error {
+	key, err := holderKey(ctx, symbol, username)
+	if err != nil {
+		return err
+	}
+	if quantity == 0 {
+		err = ctx.GetStub().DelState(key)
+	} else {
+		err = ctx.GetStub().PutState(key, []byte(username))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update holder index %s of user %s: %v", symbol, username, err)
+	}
+	return nil
+}
+
+// writeUser 写入用户账户：公共记录只含账户名和绑定身份，余额等私有字段写入私有数据集合，
+// 持仓逐只写入 holding 记录并同步股东索引，数量为 0 的持仓被删除
+func writeUser(ctx contractapi.TransactionContextInterface, user *UserAccount) error {
+	key, err := userKey(ctx, user.Name)
+	if err != nil {
+		return err
+	}
+	record := userRecord{Name: user.Name, OwnerMSP: user.OwnerMSP, OwnerID: user.OwnerID, CostBasisMethod: user.CostBasisMethod}
+	if err := putJSON(ctx, key, record); err != nil {
+		return fmt.Errorf("failed to update user %s: %v", user.Name, err)
+	}
+	if err := writePrivate(ctx, key, user); err != nil {
+		return fmt.Errorf("failed to update private data of user %s: %v", user.Name, err)
+	}
+
+	for symbol, quantity := range user.Stocks {
+		key, err := holdingKey(ctx, user.Name, symbol)
+		if err != nil {
+			return err
+		}
+		if quantity == 0 {
+			err = ctx.GetStub().DelState(key)
+		} else {
+			err = putJSON(ctx, key, Holding{DocType: holdingObjectType, Username: user.Name, Symbol: symbol, Quantity: quantity})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update holding %s of user %s: %v", symbol, user.Name, err)
+		}
+		if err := writeHolderIndex(ctx, symbol, user.Name, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUser 删除用户账户及其全部持仓和成本记录
+func deleteUser(ctx contractapi.TransactionContextInterface, username string) error {
+	key, err := userKey(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+	if err := ctx.GetStub().DelPrivateData(UserPrivateCollection, key); err != nil {
+		return err
+	}
+
+	stocks, err := readHoldings(ctx, username)
+	if err != nil {
+		return err
+	}
+	for symbol := range stocks {
+		key, err := holdingKey(ctx, username, symbol)
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return err
+		}
+		if err := writeHolderIndex(ctx, symbol, username, 0); err != nil {
+			return err
+		}
+	}
+
+	bases, err := readCostBases(ctx, username)
+	if err != nil {
+		return err
+	}
+	for symbol := range bases {
+		key, err := costBasisKey(ctx, username, symbol)
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountCache 在一笔交易内缓存用户账户和持仓成本记录。
+// Fabric 中 GetState 读不到本交易尚未提交的写入，多次变更涉及同一用户时必须在内存中累计后统一写回。
+type accountCache struct {
+	ctx        contractapi.TransactionContextInterface
+	accounts   map[string]*UserAccount
+	order      []string
+	bases      map[string]*CostBasis
+	basisOrder []string
+}
+
+func newAccountCache(ctx contractapi.TransactionContextInterface) *accountCache {
+	return &accountCache{ctx: ctx, accounts: make(map[string]*UserAccount), bases: make(map[string]*CostBasis)}
+}
+
+// get 读取用户账户，同一交易内多次读取返回同一对象
+func (c *accountCache) get(username string) (*UserAccount, error) {
+	if user, ok := c.accounts[username]; ok {
+		return user, nil
+	}
+
+	user, err := readUser(c.ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	c.accounts[username] = user
+	c.order = append(c.order, username)
+	return user, nil
+}
+
+// costBasis 读取用户某只股票的成本记录，同一交易内多次读取返回同一对象
+func (c *accountCache) costBasis(username string, symbol string) (*CostBasis, error) {
+	key, err := costBasisKey(c.ctx, username, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if basis, ok := c.bases[key]; ok {
+		return basis, nil
+	}
+
+	basis, err := readCostBasis(c.ctx, username, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	c.bases[key] = basis
+	c.basisOrder = append(c.basisOrder, key)
+	return basis, nil
+}
+
+// flush 将缓存中的账户和成本记录写回账本
+func (c *accountCache) flush() error {
+	for _, username := range c.order {
+		if err := writeUser(c.ctx, c.accounts[username]); err != nil {
+			return err
+		}
+	}
+	for _, key := range c.basisOrder {
+		if err := writeCostBasis(c.ctx, c.bases[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
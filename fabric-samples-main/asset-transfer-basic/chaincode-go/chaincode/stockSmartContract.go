@@ -3,23 +3,38 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
 // StockToken 表示股票代币的基本信息
 type StockToken struct {
-	Symbol   string  `json:"symbol"`   // 股票代码
-	Price    float64 `json:"price"`    // 当前股价
-	Quantity int     `json:"quantity"` // 持有数量
+	DocType        string `json:"docType"`             // 记录类型 stock，供富查询区分
+	Symbol         string `json:"symbol"`              // 股票代码
+	Price          int64  `json:"priceCents"`          // 当前股价（分）
+	Quantity       int    `json:"quantity"`            // 发行方尚未售出的数量（流通池）
+	Supply         int    `json:"supply"`              // 发行总量，拆股时按比例调整；旧记录为 0 表示未记录
+	Currency       string `json:"currency"`            // 计价币种，旧记录为空视为 USD
+	Status         string `json:"status"`              // 交易状态：active / halted / delisted，旧记录为空视为 active
+	HaltReason     string `json:"haltReason"`          // 停牌原因代码，未停牌时为空
+	ReferencePrice int64  `json:"referencePriceCents"` // 熔断参考价（分），规则见 rollReferencePrice
+	ReferenceDate  string `json:"referenceDate"`       // 参考价所属的交易日（UTC 日期 YYYY-MM-DD），旧记录为空
 }
 
-// UserAccount 表示一个用户的账户信息
+// UserAccount 表示一个用户的账户信息。
+// Balance、Balances、History、RealName、Email 保存在私有数据集合中（见 privacy.go），查询时只对集合成员组织返回
 type UserAccount struct {
-	Name     string         `json:"name"`     // 用户名
-	Stocks   map[string]int `json:"stocks"`   // 持有的股票代币: key=stockID, value=数量
-	Balance  float64        `json:"balance"`  // 可用余额
-	History  []string       `json:"history"`  // 交易历史 ⬅️ 本字段必须初始化
+	Name            string           `json:"name"`            // 用户名
+	Stocks          map[string]int   `json:"stocks"`          // 持有的股票代币: key=stockID, value=数量
+	Balance         int64            `json:"balanceCents"`    // 基准币种（USD）可用余额（分）
+	Balances        map[string]int64 `json:"balancesCents"`   // 其他币种可用余额（分）: key=币种 ⬅️ 本字段必须初始化
+	History         []string         `json:"history"`         // 账户变动历史（开户、存取款），买卖和转让见 Trade ⬅️ 本字段必须初始化
+	OwnerMSP        string           `json:"ownerMsp"`        // 账户绑定身份的 MSP ID，为空表示未绑定
+	OwnerID         string           `json:"ownerId"`         // 账户绑定身份的证书 ID（cid.GetID）
+	CostBasisMethod string           `json:"costBasisMethod"` // 成本计算方法：fifo / average，为空视为 fifo
+	RealName        string           `json:"realName"`        // 真实姓名
+	Email           string           `json:"email"`           // 邮箱
 }
 
 // StockSmartContract 实现股票代币化逻辑
@@ -27,25 +42,48 @@ type StockSmartContract struct {
 	contractapi.Contract
 }
 
-// InitLedger 初始化账本，发行多种股票并设置默认价格
+// ledgerInitialized 判断账本中是否已有股票、用户或合约配置记录
+func ledgerInitialized(ctx contractapi.TransactionContextInterface) (bool, error) {
+	for _, objectType := range []string{stockObjectType, userObjectType, configObjectType} {
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+		if err != nil {
+			return false, err
+		}
+		found := resultsIterator.HasNext()
+		resultsIterator.Close()
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// InitLedger 管理员初始化空账本，发行多种股票并设置默认价格和汇率。
+// 账本中已有股票、用户或配置时拒绝执行，避免重置余额、发行总量、成本批次和账户绑定
 func (s *StockSmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	// 初始化多种股票
-	stocks := []StockToken{
-		{Symbol: "TSLA", Price: 180.5, Quantity: 1000000},   // 特斯拉
-		{Symbol: "BABA", Price: 85.2, Quantity: 2000000},    // 阿里巴巴
-		{Symbol: "0700.HK", Price: 320.0, Quantity: 500000}, // 腾讯
-		{Symbol: "AAPL", Price: 150.0, Quantity: 1500000},   // 苹果
-		{Symbol: "META", Price: 280.7, Quantity: 800000},    // Meta(Facebook)
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	initialized, err := ledgerInitialized(ctx)
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return fmt.Errorf("ledger is already initialized")
 	}
 
-	// 将所有股票存入账本，使用 stock_ 前缀
-	for _, stock := range stocks {
-		stockJSON, _ := json.Marshal(stock)
-		stockKey := "stock_" + stock.Symbol
-		err := ctx.GetStub().PutState(stockKey, stockJSON)
-		if err != nil {
-			return fmt.Errorf("failed to put stock %s into ledger: %v", stock.Symbol, err)
-		}
+	// 港股以港币计价，1 HKD = 0.128 USD
+	if _, err := writeFXRate(ctx, "HKD", 128000); err != nil {
+		return err
+	}
+
+	// 初始化多种股票
+	stocks := []StockToken{
+		{Symbol: "TSLA", Price: 18050, Quantity: 1000000, Currency: "USD", Status: StockActive},   // 特斯拉
+		{Symbol: "BABA", Price: 8520, Quantity: 2000000, Currency: "USD", Status: StockActive},    // 阿里巴巴
+		{Symbol: "0700.HK", Price: 32000, Quantity: 500000, Currency: "HKD", Status: StockActive}, // 腾讯
+		{Symbol: "AAPL", Price: 15000, Quantity: 1500000, Currency: "USD", Status: StockActive},   // 苹果
+		{Symbol: "META", Price: 28070, Quantity: 800000, Currency: "USD", Status: StockActive},    // Meta(Facebook)
 	}
 
 	// 初始化多个测试用户
@@ -53,88 +91,112 @@ func (s *StockSmartContract) InitLedger(ctx contractapi.TransactionContextInterf
 		{
 			Name:    "Alice",
 			Stocks:  map[string]int{"TSLA": 100, "AAPL": 50},
-			Balance: 50000.0,
+			Balance: 5000000,
 			History: []string{"Initial account setup"},
 		},
 		{
 			Name:    "Bob",
 			Stocks:  map[string]int{"BABA": 200, "META": 80},
-			Balance: 75000.0,
+			Balance: 7500000,
 			History: []string{"Initial account setup"},
 		},
 		{
 			Name:    "Charlie",
 			Stocks:  map[string]int{"0700.HK": 150, "TSLA": 75},
-			Balance: 60000.0,
+			Balance: 6000000,
 			History: []string{"Initial account setup"},
 		},
 		{
 			Name:    "David",
 			Stocks:  map[string]int{"AAPL": 120, "META": 60},
-			Balance: 45000.0,
+			Balance: 4500000,
 			History: []string{"Initial account setup"},
 		},
 		{
 			Name:    "Eve",
 			Stocks:  map[string]int{"BABA": 180, "0700.HK": 90},
-			Balance: 55000.0,
+			Balance: 5500000,
 			History: []string{"Initial account setup"},
 		},
 	}
 
-	// 将所有用户存入账本
+	// 发行总量为流通池与初始持仓之和
+	held := make(map[string]int, len(stocks))
 	for _, user := range users {
-		userKey := "user_" + user.Name
-		userJSON, _ := json.Marshal(user)
-		err := ctx.GetStub().PutState(userKey, userJSON)
-		if err != nil {
-			return fmt.Errorf("failed to initialize user %s: %v", user.Name, err)
+		for symbol, quantity := range user.Stocks {
+			held[symbol] += quantity
 		}
 	}
 
-	return nil
-}
-
-// GetAllAssets 返回账本中的所有资产（股票和用户账户）
-func (s *StockSmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface) (map[string]interface{}, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	// 将所有股票存入账本，并以发行价作为第一条价格记录
+	ticks, err := newTradeLog(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resultsIterator.Close()
-
-	assets := make(map[string]interface{})
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
+	for i := range stocks {
+		stocks[i].Supply = stocks[i].Quantity + held[stocks[i].Symbol]
+		err := writeStock(ctx, &stocks[i])
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to put stock %s into ledger: %v", stocks[i].Symbol, err)
 		}
+		if err := ticks.recordTick(stocks[i].Symbol, TickListing, stocks[i].Price, 0); err != nil {
+			return err
+		}
+	}
 
-		key := queryResponse.Key
-		// 根据键名判断数据类型
-		if len(key) > 6 && key[:6] == "stock_" {
-			var stock StockToken
-			err = json.Unmarshal(queryResponse.Value, &stock)
+	// 将所有用户及其持仓存入账本，初始持仓按发行价记为一个成本批次
+	prices := make(map[string]int64, len(stocks))
+	for _, stock := range stocks {
+		prices[stock.Symbol] = stock.Price
+	}
+	for i := range users {
+		err := writeUser(ctx, &users[i])
+		if err != nil {
+			return fmt.Errorf("failed to initialize user %s: %v", users[i].Name, err)
+		}
+		for symbol, quantity := range users[i].Stocks {
+			cost, err := mulCents(prices[symbol], quantity)
 			if err != nil {
-				continue
+				return err
 			}
-			assets[key] = stock
-		} else if len(key) > 5 && key[:5] == "user_" {
-			var user UserAccount
-			err = json.Unmarshal(queryResponse.Value, &user)
+			lot, err := newLot(ctx, quantity, cost)
 			if err != nil {
-				continue
+				return err
+			}
+			if err := writeCostBasis(ctx, &CostBasis{Username: users[i].Name, Symbol: symbol, Lots: []Lot{lot}}); err != nil {
+				return fmt.Errorf("failed to initialize cost basis of user %s: %v", users[i].Name, err)
 			}
-			assets[key] = user
 		}
 	}
 
+	return emitEvent(ctx, StockEvent{Type: EventLedgerInitialized})
+}
+
+// GetAllAssets 返回账本中的所有资产（股票和用户账户）
+func (s *StockSmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface) (map[string]interface{}, error) {
+	stocks, err := s.GetAllStock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.GetAllUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make(map[string]interface{})
+	for key, stock := range stocks {
+		assets[key] = stock
+	}
+	for key, user := range users {
+		assets[key] = user
+	}
+
 	return assets, nil
 }
 
 // GetAllStock 返回账本中的所有股票信息
 func (s *StockSmartContract) GetAllStock(ctx contractapi.TransactionContextInterface) (map[string]StockToken, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(stockObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
@@ -147,16 +209,12 @@ func (s *StockSmartContract) GetAllStock(ctx contractapi.TransactionContextInter
 			return nil, err
 		}
 
-		key := queryResponse.Key
-		// 只处理股票数据（使用 stock_ 前缀）
-		if len(key) > 6 && key[:6] == "stock_" {
-			var stock StockToken
-			err = json.Unmarshal(queryResponse.Value, &stock)
-			if err != nil {
-				continue
-			}
-			stocks[key] = stock
+		var stock StockToken
+		err = json.Unmarshal(queryResponse.Value, &stock)
+		if err != nil {
+			continue
 		}
+		stocks[stockResultPrefix+stock.Symbol] = stock
 	}
 
 	return stocks, nil
@@ -164,7 +222,7 @@ func (s *StockSmartContract) GetAllStock(ctx contractapi.TransactionContextInter
 
 // GetAllUser 返回账本中的所有用户信息
 func (s *StockSmartContract) GetAllUser(ctx contractapi.TransactionContextInterface) (map[string]UserAccount, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(userObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
@@ -177,179 +235,575 @@ func (s *StockSmartContract) GetAllUser(ctx contractapi.TransactionContextInterf
 			return nil, err
 		}
 
-		key := queryResponse.Key
-		// 只处理用户数据
-		if len(key) > 5 && key[:5] == "user_" {
-			var user UserAccount
-			err = json.Unmarshal(queryResponse.Value, &user)
-			if err != nil {
-				continue
-			}
-			users[key] = user
+		var user UserAccount
+		err = json.Unmarshal(queryResponse.Value, &user)
+		if err != nil {
+			continue
+		}
+		if err := fillPrivate(ctx, &user); err != nil {
+			return nil, err
+		}
+		user.Stocks, err = readHoldings(ctx, user.Name)
+		if err != nil {
+			return nil, err
 		}
+		users[userResultPrefix+user.Name] = user
 	}
 
 	return users, nil
 }
 
-// BuyStock 用户买入股票
-func (s *StockSmartContract) BuyStock(ctx contractapi.TransactionContextInterface, username string, stockID string, amount int, payment float64) error {
-	stockKey := "stock_" + stockID
-	stockJSON, err := ctx.GetStub().GetState(stockKey)
-	if err != nil || stockJSON == nil {
-		return fmt.Errorf("stock %s not found", stockID)
+// BuyStock 用户从流通池买入股票，以股票计价币种的现金支付。
+// payment 单位为分，须与成交金额和手续费之和完全一致（可先调用 QuoteFee 询价），多付或少付均拒绝交易。
+// clientOrderID 为客户端订单号，可为空；以相同订单号重复提交同一请求时不会再次买入（见 ClientOrder）
+func (s *StockSmartContract) BuyStock(ctx contractapi.TransactionContextInterface, username string, stockID string, amount int, payment int64, clientOrderID string) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive")
 	}
 
-	var stock StockToken
-	json.Unmarshal(stockJSON, &stock)
-
-	userKey := "user_" + username
-	userJSON, err := ctx.GetStub().GetState(userKey)
-	if err != nil || userJSON == nil {
-		return fmt.Errorf("user %s not found", username)
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return err
+	}
+	request := fmt.Sprintf("%s|%d|%d", stockID, amount, payment)
+	previous, err := replayClientOrder(ctx, username, clientOrderID, "BuyStock", request)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		return nil
 	}
 
-	var user UserAccount
-	json.Unmarshal(userJSON, &user)
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	if err := checkTradable(stock); err != nil {
+		return err
+	}
 
-	// 确保 History 字段不为 nil
-	if user.History == nil {
-		user.History = []string{}
+	if stock.Price <= 0 {
+		return fmt.Errorf("stock %s has no valid price", stockID)
+	}
+	if stock.Quantity < amount {
+		return fmt.Errorf("insufficient float of %s. Available: %d", stockID, stock.Quantity)
 	}
 
-	totalCost := stock.Price * float64(amount)
-	if payment < totalCost {
-		return fmt.Errorf("insufficient payment. Required: %.2f", totalCost)
+	totalCost, err := mulCents(stock.Price, amount)
+	if err != nil {
+		return err
+	}
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+	fee, err := schedule.fee(stockID, totalCost)
+	if err != nil {
+		return err
+	}
+	required, err := addCents(totalCost, fee)
+	if err != nil {
+		return err
+	}
+	if payment < required {
+		return fmt.Errorf("insufficient payment. Required: %s", FormatCents(required))
+	}
+	if payment > required {
+		return fmt.Errorf("overpayment rejected. Required: %s, payment: %s", FormatCents(required), FormatCents(payment))
 	}
 
-	// 更新用户持仓
+	// 更新用户持仓，以股票计价币种的现金支付
+	currency := stockCurrency(stock)
+	if user.balanceIn(currency) < required {
+		return fmt.Errorf("insufficient balance. Required: %s", formatAmount(currency, required))
+	}
 	user.Stocks[stockID] += amount
-	user.Balance -= totalCost
-	user.History = append(user.History, fmt.Sprintf("Bought %d shares of %s for $%.2f", amount, stockID, totalCost))
+	if err := user.addBalance(currency, -totalCost); err != nil {
+		return err
+	}
+	if err := chargeFee(accounts, schedule, user, currency, fee); err != nil {
+		return err
+	}
+	if err := accounts.acquireLot(username, stockID, amount, required); err != nil {
+		return err
+	}
 
 	// 更新股票总流通量
 	stock.Quantity -= amount
 
 	// 写回状态
-	userJSON, _ = json.Marshal(user)
-	stockJSON, _ = json.Marshal(stock)
+	err = accounts.flush()
+	if err != nil {
+		return err
+	}
+	err = writeStock(ctx, stock)
+	if err != nil {
+		return err
+	}
 
-	err = ctx.GetStub().PutState(userKey, userJSON)
+	trades, err := newTradeLog(ctx)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(stockKey, stockJSON)
-	return err
-}
+	err = trades.record(Trade{Username: username, Side: TradeBuy, Symbol: stockID, Quantity: amount, Price: stock.Price, Currency: currency, Amount: totalCost, Fee: fee})
+	if err != nil {
+		return err
+	}
+	if err := trades.recordTick(stockID, TickTrade, stock.Price, amount); err != nil {
+		return err
+	}
 
-// SellStock 用户卖出股票
-func (s *StockSmartContract) SellStock(ctx contractapi.TransactionContextInterface, username string, stockID string, amount int) (float64, error) {
-	stockKey := "stock_" + stockID
-	stockJSON, err := ctx.GetStub().GetState(stockKey)
-	if err != nil || stockJSON == nil {
-		return 0, fmt.Errorf("stock %s not found", stockID)
+	if err := recordClientOrder(ctx, username, clientOrderID, "BuyStock", request, nil); err != nil {
+		return err
 	}
 
-	var stock StockToken
-	json.Unmarshal(stockJSON, &stock)
+	return emitEvent(ctx, StockEvent{Type: EventStockBought, Username: username, Symbol: stockID, Quantity: amount, Price: stock.Price, Currency: currency, Amount: totalCost, Fee: fee})
+}
 
-	userKey := "user_" + username
-	userJSON, err := ctx.GetStub().GetState(userKey)
-	if err != nil || userJSON == nil {
-		return 0, fmt.Errorf("user %s not found", username)
+// SellStock 用户卖出股票，返回扣除手续费后的卖出所得（分，股票计价币种），已实现盈亏记入交易记录。
+// clientOrderID 为客户端订单号，可为空；以相同订单号重复提交同一请求时不会再次卖出，返回原交易的所得
+func (s *StockSmartContract) SellStock(ctx contractapi.TransactionContextInterface, username string, stockID string, amount int, clientOrderID string) (int64, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive")
 	}
 
-	var user UserAccount
-	json.Unmarshal(userJSON, &user)
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return 0, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return 0, err
+	}
+	request := fmt.Sprintf("%s|%d", stockID, amount)
+	previous, err := replayClientOrder(ctx, username, clientOrderID, "SellStock", request)
+	if err != nil {
+		return 0, err
+	}
+	if previous != nil {
+		var proceeds int64
+		if err := json.Unmarshal([]byte(previous.Result), &proceeds); err != nil {
+			return 0, err
+		}
+		return proceeds, nil
+	}
 
-	// 确保 History 字段不为 nil
-	if user.History == nil {
-		user.History = []string{}
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkTradable(stock); err != nil {
+		return 0, err
 	}
 
 	if user.Stocks[stockID] < amount {
 		return 0, fmt.Errorf("insufficient shares to sell")
 	}
 
-	revenue := stock.Price * float64(amount)
+	revenue, err := mulCents(stock.Price, amount)
+	if err != nil {
+		return 0, err
+	}
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fee, err := schedule.fee(stockID, revenue)
+	if err != nil {
+		return 0, err
+	}
 
-	// 更新用户持仓
+	// 更新用户持仓，所得计入股票计价币种的现金
+	currency := stockCurrency(stock)
 	user.Stocks[stockID] -= amount
-	user.Balance += revenue
-	user.History = append(user.History, fmt.Sprintf("Sold %d shares of %s for $%.2f", amount, stockID, revenue))
+	if err := user.addBalance(currency, revenue); err != nil {
+		return 0, err
+	}
+	if err := chargeFee(accounts, schedule, user, currency, fee); err != nil {
+		return 0, err
+	}
+	realized, err := accounts.disposeLots(user, stockID, amount, revenue-fee)
+	if err != nil {
+		return 0, err
+	}
 
 	// 更新股票总流通量
 	stock.Quantity += amount
 
 	// 写回状态
-	userJSON, _ = json.Marshal(user)
-	stockJSON, _ = json.Marshal(stock)
+	err = accounts.flush()
+	if err != nil {
+		return 0, err
+	}
+	err = writeStock(ctx, stock)
+	if err != nil {
+		return 0, err
+	}
 
-	err = ctx.GetStub().PutState(userKey, userJSON)
+	trades, err := newTradeLog(ctx)
 	if err != nil {
 		return 0, err
 	}
-	err = ctx.GetStub().PutState(stockKey, stockJSON)
+	err = trades.record(Trade{Username: username, Side: TradeSell, Symbol: stockID, Quantity: amount, Price: stock.Price, Currency: currency, Amount: revenue, Fee: fee, Realized: realized})
+	if err != nil {
+		return 0, err
+	}
+	if err := trades.recordTick(stockID, TickTrade, stock.Price, amount); err != nil {
+		return 0, err
+	}
 
-	return revenue, err
+	if err := recordClientOrder(ctx, username, clientOrderID, "SellStock", request, revenue-fee); err != nil {
+		return 0, err
+	}
+
+	err = emitEvent(ctx, StockEvent{Type: EventStockSold, Username: username, Symbol: stockID, Quantity: amount, Price: stock.Price, Currency: currency, Amount: revenue, Fee: fee})
+
+	return revenue - fee, err
 }
 
-// GetStockPrice 查询当前股价
-func (s *StockSmartContract) GetStockPrice(ctx contractapi.TransactionContextInterface, stockID string) (float64, error) {
-	stockKey := "stock_" + stockID
-	stockJSON, err := ctx.GetStub().GetState(stockKey)
-	if err != nil || stockJSON == nil {
-		return 0, fmt.Errorf("stock %s not found", stockID)
+// GetStockPrice 查询当前股价（分）
+func (s *StockSmartContract) GetStockPrice(ctx contractapi.TransactionContextInterface, stockID string) (int64, error) {
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return 0, err
 	}
-
-	var stock StockToken
-	json.Unmarshal(stockJSON, &stock)
 	return stock.Price, nil
 }
 
 // GetUserStockCount 查询用户持有某股票的数量
 func (s *StockSmartContract) GetUserStockCount(ctx contractapi.TransactionContextInterface, username string, stockID string) (int, error) {
-	userKey := "user_" + username
-	userJSON, err := ctx.GetStub().GetState(userKey)
-	if err != nil || userJSON == nil {
+	exists, err := userExists(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
 		return 0, fmt.Errorf("user %s not found", username)
 	}
 
-	var user UserAccount
-	json.Unmarshal(userJSON, &user)
+	key, err := holdingKey(ctx, username, stockID)
+	if err != nil {
+		return 0, err
+	}
+	holdingJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if holdingJSON == nil {
+		return 0, nil
+	}
 
-	return user.Stocks[stockID], nil
+	var holding Holding
+	json.Unmarshal(holdingJSON, &holding)
+	return holding.Quantity, nil
 }
 
-// GetUserTotalValue 查询用户总资产（市值）
-func (s *StockSmartContract) GetUserTotalValue(ctx contractapi.TransactionContextInterface, username string) (float64, error) {
-	userKey := "user_" + username
-	userJSON, err := ctx.GetStub().GetState(userKey)
-	if err != nil || userJSON == nil {
-		return 0, fmt.Errorf("user %s not found", username)
+// GetUserTotalValue 查询用户总资产（市值，分），各币种现金和持仓按汇率折算为基准币种，明细见 GetUserValuation
+func (s *StockSmartContract) GetUserTotalValue(ctx contractapi.TransactionContextInterface, username string) (int64, error) {
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return 0, err
 	}
 
-	var user UserAccount
-	json.Unmarshal(userJSON, &user)
+	result, err := valuation(ctx, user, DefaultCurrency)
+	if err != nil {
+		return 0, err
+	}
+	return result.Total, nil
+}
+
+// CloseAccount 销户。payoutAccount 为空时，账户仍有持仓、余额或未成交挂单则拒绝销户；
+// 否则先撤销挂单，按现价将持仓卖回发行方（不收手续费），再把各币种余额转入 payoutAccount。
+// 当前的手续费账户不能销户。
+// 销户后删除账户和持仓记录，并写入墓碑记录，用户名不能再次开户。
+func (s *StockSmartContract) CloseAccount(ctx contractapi.TransactionContextInterface, username string, payoutAccount string) error {
+	accounts := newAccountCache(ctx)
+	user, err := accounts.get(username)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return err
+	}
+	schedule, err := readFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+	if schedule.Collector == username {
+		return fmt.Errorf("account %s is the fee collector", username)
+	}
+
+	orders, err := openOrders(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return err
+	}
+
+	if payoutAccount == "" {
+		if len(orders) > 0 {
+			return fmt.Errorf("account %s has open orders", username)
+		}
+		for _, quantity := range user.Stocks {
+			if quantity > 0 {
+				return fmt.Errorf("account %s still holds shares", username)
+			}
+		}
+		for _, currency := range user.currencies() {
+			if user.balanceIn(currency) != 0 {
+				return fmt.Errorf("account %s still has a cash balance", username)
+			}
+		}
+	} else {
+		if payoutAccount == username {
+			return fmt.Errorf("cannot pay out to the account being closed")
+		}
+		payee, err := accounts.get(payoutAccount)
+		if err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			if err := s.cancelOrder(ctx, accounts, order); err != nil {
+				return err
+			}
+		}
+		if err := liquidateHoldings(ctx, accounts, trades, user); err != nil {
+			return err
+		}
+
+		// 各币种余额分别转入收款账户
+		for _, currency := range user.currencies() {
+			payout := user.balanceIn(currency)
+			if payout <= 0 {
+				continue
+			}
+			if err := payee.addBalance(currency, payout); err != nil {
+				return err
+			}
+			if err := user.addBalance(currency, -payout); err != nil {
+				return err
+			}
+			payee.History = append(payee.History, fmt.Sprintf("Received %s from closed account %s", formatMoney(currency, payout), username))
+			if err := trades.recordTransfer(username, payoutAccount, "", 0, currency); err != nil {
+				return err
+			}
+			if err := trades.recordCashTransfer(username, payoutAccount, currency, payout); err != nil {
+				return err
+			}
+		}
+		if err := accounts.flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteUser(ctx, username); err != nil {
+		return err
+	}
+	if err := writeClosedAccount(ctx, user, payoutAccount, trades.timestamp); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventAccountClosed, Username: username, Counterparty: payoutAccount})
+}
+
+// legacyStockToken 旧版本账本中以 float64 存储股价的股票记录
+type legacyStockToken struct {
+	StockToken
+	LegacyPrice *float64 `json:"price"`
+}
 
-	total := user.Balance
-	for stockID, count := range user.Stocks {
-		stockKey := "stock_" + stockID
-		stockJSON, err := ctx.GetStub().GetState(stockKey)
-		if err != nil || stockJSON == nil {
+// legacyUserAccount 旧版本账本中以 float64 存储余额的用户记录
+type legacyUserAccount struct {
+	UserAccount
+	LegacyBalance *float64 `json:"balance"`
+}
+
+// decodeStockRecord 解析股票记录，旧版本的浮点股价会被转换为分，legacy 表示记录是否为旧格式
+func decodeStockRecord(value []byte) (*StockToken, bool, error) {
+	var record legacyStockToken
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, false, err
+	}
+	if record.LegacyPrice == nil {
+		return &record.StockToken, false, nil
+	}
+
+	price, err := floatToCents(*record.LegacyPrice)
+	if err != nil {
+		return nil, false, err
+	}
+	record.StockToken.Price = price
+	return &record.StockToken, true, nil
+}
+
+// decodeUserRecord 解析用户记录，旧版本的浮点余额会被转换为分，legacy 表示记录是否为旧格式
+func decodeUserRecord(value []byte) (*UserAccount, bool, error) {
+	var record legacyUserAccount
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, false, err
+	}
+	if record.LegacyBalance == nil {
+		return &record.UserAccount, false, nil
+	}
+
+	balance, err := floatToCents(*record.LegacyBalance)
+	if err != nil {
+		return nil, false, err
+	}
+	record.UserAccount.Balance = balance
+	return &record.UserAccount, true, nil
+}
+
+// MigrateLegacyAmounts 管理员将旧账本中以 float64 存储的股价和余额迁移为分，返回迁移的记录数
+func (s *StockSmartContract) MigrateLegacyAmounts(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		key := queryResponse.Key
+		var record interface{}
+		if len(key) > 6 && key[:6] == "stock_" {
+			stock, legacy, err := decodeStockRecord(queryResponse.Value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			if !legacy {
+				continue
+			}
+			record = stock
+		} else if len(key) > 5 && key[:5] == "user_" {
+			user, legacy, err := decodeUserRecord(queryResponse.Value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			if !legacy {
+				continue
+			}
+			record = user
+		} else {
 			continue
 		}
-		var stock StockToken
-		json.Unmarshal(stockJSON, &stock)
-		total += stock.Price * float64(count)
+
+		if err := putJSON(ctx, key, record); err != nil {
+			return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+		}
+		migrated++
 	}
 
-	return total, nil
+	return migrated, emitEvent(ctx, StockEvent{Type: EventAmountsMigrated, Count: migrated})
 }
 
-// CloseAccount 销户：删除用户的所有持仓和账户信息
-func (s *StockSmartContract) CloseAccount(ctx contractapi.TransactionContextInterface, username string) error {
-	userKey := "user_" + username
-	err := ctx.GetStub().DelState(userKey)
-	return err
-}
\ No newline at end of file
+// MigrateStorageLayout 管理员将旧版本以字符串拼接为键（stock_、user_、order_、fill_、book_ 前缀）的记录
+// 迁移到复合键布局：用户持仓拆分为独立的 holding 记录，挂单索引根据未成交订单重建，旧键全部删除。
+// 旧记录中的浮点金额同时转换为分。返回迁移的记录数。
+func (s *StockSmartContract) MigrateStorageLayout(ctx contractapi.TransactionContextInterface) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+
+	// 范围查询只返回普通键，不包含复合键
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		key := queryResponse.Key
+		switch {
+		case strings.HasPrefix(key, "stock_"):
+			stock, _, err := decodeStockRecord(queryResponse.Value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			err = writeStock(ctx, stock)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+		case strings.HasPrefix(key, "user_"):
+			user, _, err := decodeUserRecord(queryResponse.Value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			if user.History == nil {
+				user.History = []string{}
+			}
+			err = writeUser(ctx, user)
+			if err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+		case strings.HasPrefix(key, "order_"):
+			var order Order
+			if err := json.Unmarshal(queryResponse.Value, &order); err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			if err := writeOrder(ctx, &order); err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			if order.Status == OrderOpen {
+				nanos, err := orderNanos(&order)
+				if err != nil {
+					return 0, err
+				}
+				bookEntry, err := bookKey(ctx, &order, nanos)
+				if err != nil {
+					return 0, err
+				}
+				if err := ctx.GetStub().PutState(bookEntry, []byte(order.ID)); err != nil {
+					return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+				}
+			}
+		case strings.HasPrefix(key, "fill_"):
+			var fill Fill
+			if err := json.Unmarshal(queryResponse.Value, &fill); err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+			newKey, err := fillKey(ctx, fill.ID)
+			if err != nil {
+				return 0, err
+			}
+			if err := putJSON(ctx, newKey, fill); err != nil {
+				return 0, fmt.Errorf("failed to migrate %s: %v", key, err)
+			}
+		case strings.HasPrefix(key, "book_"):
+			// 挂单索引由未成交订单重建，旧索引直接删除
+		default:
+			continue
+		}
+
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return 0, fmt.Errorf("failed to delete %s: %v", key, err)
+		}
+		migrated++
+	}
+
+	return migrated, emitEvent(ctx, StockEvent{Type: EventLayoutMigrated, Count: migrated})
+}
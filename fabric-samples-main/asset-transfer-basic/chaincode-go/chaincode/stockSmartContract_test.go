@@ -0,0 +1,2175 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newStockLedger 构造一个基于内存 map 的账本，供股票合约测试使用
+func newStockLedger() (*mocks.TransactionContext, *mocks.ChaincodeStub, map[string][]byte) {
+	state := make(map[string][]byte)
+	chaincodeStub := &mocks.ChaincodeStub{}
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	// 与 Fabric 一致：每笔交易对同一个键只保留最后一次写入作为一个历史版本
+	history := make(map[string][]*queryresult.KeyModification)
+	recordHistory := func(key string, value []byte, isDelete bool) {
+		timestamp, _ := chaincodeStub.GetTxTimestamp()
+		modification := &queryresult.KeyModification{
+			TxId:      chaincodeStub.GetTxID(),
+			Value:     value,
+			IsDelete:  isDelete,
+			Timestamp: timestamp,
+		}
+		versions := history[key]
+		if len(versions) > 0 && versions[len(versions)-1].TxId == modification.TxId {
+			versions = versions[:len(versions)-1]
+		}
+		history[key] = append(versions, modification)
+	}
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		recordHistory(key, value, false)
+		return nil
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		delete(state, key)
+		recordHistory(key, nil, true)
+		return nil
+	}
+	// Fabric v2 的 peer 按时间倒序返回历史版本
+	chaincodeStub.GetHistoryForKeyStub = func(key string) (shim.HistoryQueryIteratorInterface, error) {
+		versions := history[key]
+		reversed := make([]*queryresult.KeyModification, 0, len(versions))
+		for i := len(versions) - 1; i >= 0; i-- {
+			reversed = append(reversed, versions[i])
+		}
+		return &historyIterator{modifications: reversed}, nil
+	}
+	// 与 Fabric 一致：范围查询只返回普通键，复合键只能通过前缀查询获得
+	chaincodeStub.GetStateByRangeStub = func(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+		var kvs []*queryresult.KV
+		for key, value := range state {
+			if !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey) {
+				kvs = append(kvs, &queryresult.KV{Key: key, Value: value})
+			}
+		}
+		return newIterator(kvs), nil
+	}
+	chaincodeStub.CreateCompositeKeyStub = shim.CreateCompositeKey
+	chaincodeStub.GetStateByPartialCompositeKeyStub = func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			return nil, err
+		}
+		return newIterator(scanPrefix(state, prefix)), nil
+	}
+	// 私有数据与公共状态存放在同一个 map 中，键带有集合名前缀，不会被范围查询和前缀查询扫描到
+	chaincodeStub.GetPrivateDataStub = func(collection string, key string) ([]byte, error) {
+		return state[privateKey(collection, key)], nil
+	}
+	chaincodeStub.PutPrivateDataStub = func(collection string, key string, value []byte) error {
+		state[privateKey(collection, key)] = value
+		return nil
+	}
+	chaincodeStub.DelPrivateDataStub = func(collection string, key string) error {
+		delete(state, privateKey(collection, key))
+		return nil
+	}
+	chaincodeStub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		value, ok := state[privateKey(collection, key)]
+		if !ok {
+			return nil, nil
+		}
+		hash := sha256.Sum256(value)
+		return hash[:], nil
+	}
+	chaincodeStub.GetStateByPartialCompositeKeyWithPaginationStub = func(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 书签为下一页第一条记录的键
+		kvs := scanPrefix(state, prefix)
+		sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+		var pageKVs []*queryresult.KV
+		next := ""
+		for _, kv := range kvs {
+			if kv.Key < bookmark {
+				continue
+			}
+			if int32(len(pageKVs)) == pageSize {
+				next = kv.Key
+				break
+			}
+			pageKVs = append(pageKVs, kv)
+		}
+		metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(pageKVs)), Bookmark: next}
+		return newIterator(pageKVs), metadata, nil
+	}
+	// 富查询在公共状态或私有数据集合上按 selector 过滤，结果按键排序（用户余额的键顺序即用户名顺序）
+	publicKVs := func() []*queryresult.KV {
+		var kvs []*queryresult.KV
+		for key, value := range state {
+			if !strings.HasPrefix(key, "\x00private\x00") {
+				kvs = append(kvs, &queryresult.KV{Key: key, Value: value})
+			}
+		}
+		return kvs
+	}
+	chaincodeStub.GetQueryResultStub = func(query string) (shim.StateQueryIteratorInterface, error) {
+		kvs, err := couchQuery(publicKVs(), query)
+		return newIterator(kvs), err
+	}
+	chaincodeStub.GetQueryResultWithPaginationStub = func(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		kvs, err := couchQuery(publicKVs(), query)
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+		var pageKVs []*queryresult.KV
+		next := ""
+		for _, kv := range kvs {
+			if kv.Key < bookmark {
+				continue
+			}
+			if int32(len(pageKVs)) == pageSize {
+				next = kv.Key
+				break
+			}
+			pageKVs = append(pageKVs, kv)
+		}
+		metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(pageKVs)), Bookmark: next}
+		return newIterator(pageKVs), metadata, nil
+	}
+	chaincodeStub.GetPrivateDataQueryResultStub = func(collection string, query string) (shim.StateQueryIteratorInterface, error) {
+		prefix := privateKey(collection, "")
+		var kvs []*queryresult.KV
+		for _, kv := range scanPrefix(state, prefix) {
+			kvs = append(kvs, &queryresult.KV{Key: strings.TrimPrefix(kv.Key, prefix), Value: kv.Value})
+		}
+		kvs, err := couchQuery(kvs, query)
+		return newIterator(kvs), err
+	}
+	setTx(chaincodeStub, 0)
+
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+	// 默认以管理员身份调用，可以操作任何账户；需要校验权限的测试自行切换身份
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	return transactionContext, chaincodeStub, state
+}
+
+// setTx 设置当前模拟交易的 txID 和时间戳，n 越大时间越晚
+func setTx(chaincodeStub *mocks.ChaincodeStub, n int) {
+	chaincodeStub.GetTxIDReturns(fmt.Sprintf("tx%03d", n))
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(time.Date(2024, 1, 1, 0, 0, n, 0, time.UTC)), nil)
+}
+
+func privateKey(collection string, key string) string {
+	return "\x00private\x00" + collection + "\x00" + key
+}
+
+// withAccount 设置开户或更新资料时 transient map 中的账户资料
+func withAccount(chaincodeStub *mocks.ChaincodeStub, initialBalance int64, realName string, email string) {
+	details, _ := json.Marshal(chaincode.AccountDetails{InitialBalance: initialBalance, RealName: realName, Email: email})
+	chaincodeStub.GetTransientReturns(map[string][]byte{chaincode.TransientAccountKey: details}, nil)
+}
+
+// withAmount 设置出入金时 transient map 中的金额（分）
+func withAmount(chaincodeStub *mocks.ChaincodeStub, amount int64) {
+	chaincodeStub.GetTransientReturns(map[string][]byte{chaincode.TransientAmountKey: []byte(fmt.Sprint(amount))}, nil)
+}
+
+// fakeIdentity 模拟调用者证书身份
+type fakeIdentity struct {
+	mspID string
+	id    string
+	attrs map[string]string
+	ous   []string
+}
+
+func (f *fakeIdentity) GetID() (string, error)    { return f.id, nil }
+func (f *fakeIdentity) GetMSPID() (string, error) { return f.mspID, nil }
+func (f *fakeIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := f.attrs[attrName]
+	return value, found, nil
+}
+func (f *fakeIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	if f.attrs[attrName] != attrValue {
+		return fmt.Errorf("attribute %s is not %s", attrName, attrValue)
+	}
+	return nil
+}
+func (f *fakeIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: f.ous}}, nil
+}
+
+var (
+	adminIdentity  = &fakeIdentity{mspID: "Org1MSP", id: "admin", ous: []string{"admin"}}
+	clientIdentity = &fakeIdentity{mspID: "Org1MSP", id: "user1", ous: []string{"client"}}
+)
+
+// scanPrefix 返回以 prefix 开头的所有记录
+func scanPrefix(state map[string][]byte, prefix string) []*queryresult.KV {
+	var kvs []*queryresult.KV
+	for key, value := range state {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	return kvs
+}
+
+// newIterator 按键排序返回一个模拟的结果迭代器
+func newIterator(kvs []*queryresult.KV) *mocks.StateQueryIterator {
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	iterator := &mocks.StateQueryIterator{}
+	index := 0
+	iterator.HasNextStub = func() bool { return index < len(kvs) }
+	iterator.NextStub = func() (*queryresult.KV, error) {
+		kv := kvs[index]
+		index++
+		return kv, nil
+	}
+	return iterator
+}
+
+// historyIterator 模拟 GetHistoryForKey 返回的迭代器
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+	index         int
+}
+
+func (h *historyIterator) HasNext() bool { return h.index < len(h.modifications) }
+func (h *historyIterator) Close() error  { return nil }
+func (h *historyIterator) Next() (*queryresult.KeyModification, error) {
+	modification := h.modifications[h.index]
+	h.index++
+	return modification, nil
+}
+
+// couchQuery 在测试状态上执行 CouchDB 查询的 selector 部分，只支持链码和测试用到的运算符
+func couchQuery(kvs []*queryresult.KV, query string) ([]*queryresult.KV, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, err
+	}
+	var matched []*queryresult.KV
+	for _, kv := range kvs {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(kv.Value, &doc); err != nil {
+			continue
+		}
+		if matchSelector(doc, parsed.Selector) {
+			matched = append(matched, kv)
+		}
+	}
+	return matched, nil
+}
+
+func matchSelector(doc map[string]interface{}, selector map[string]interface{}) bool {
+	for field, condition := range selector {
+		switch field {
+		case "$and":
+			for _, clause := range condition.([]interface{}) {
+				if !matchSelector(doc, clause.(map[string]interface{})) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+			for _, clause := range condition.([]interface{}) {
+				matched = matched || matchSelector(doc, clause.(map[string]interface{}))
+			}
+			if !matched {
+				return false
+			}
+		default:
+			var value interface{} = doc
+			for _, part := range strings.Split(field, ".") {
+				object, ok := value.(map[string]interface{})
+				if !ok {
+					value = nil
+					break
+				}
+				value = object[part]
+			}
+			if !matchCondition(value, condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchCondition(value interface{}, condition interface{}) bool {
+	operators, ok := condition.(map[string]interface{})
+	if !ok {
+		return value == condition
+	}
+	for operator, argument := range operators {
+		switch operator {
+		case "$eq":
+			if value != argument {
+				return false
+			}
+		case "$ne":
+			if value == argument {
+				return false
+			}
+		case "$in":
+			found := false
+			for _, candidate := range argument.([]interface{}) {
+				found = found || value == candidate
+			}
+			if !found {
+				return false
+			}
+		case "$exists":
+			if (value != nil) != argument.(bool) {
+				return false
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			if value == nil {
+				return false
+			}
+			var cmp int
+			switch v := value.(type) {
+			case float64:
+				if bound := argument.(float64); v < bound {
+					cmp = -1
+				} else if v > bound {
+					cmp = 1
+				}
+			case string:
+				cmp = strings.Compare(v, argument.(string))
+			}
+			if (operator == "$gt" && cmp <= 0) || (operator == "$gte" && cmp < 0) || (operator == "$lt" && cmp >= 0) || (operator == "$lte" && cmp > 0) {
+				return false
+			}
+		default:
+			panic("unsupported operator " + operator)
+		}
+	}
+	return true
+}
+
+func compositeKey(t *testing.T, objectType string, attributes ...string) string {
+	key, err := shim.CreateCompositeKey(objectType, attributes)
+	require.NoError(t, err)
+	return key
+}
+
+// readUser 读取用户记录，叠加私有数据集合中的字段，并从 holding 记录组装持仓
+func readUser(t *testing.T, state map[string][]byte, username string) chaincode.UserAccount {
+	key := compositeKey(t, "user", username)
+	var user chaincode.UserAccount
+	require.NoError(t, json.Unmarshal(state[key], &user))
+	if privateJSON, ok := state[privateKey(chaincode.UserPrivateCollection, key)]; ok {
+		require.NoError(t, json.Unmarshal(privateJSON, &user))
+	}
+
+	user.Stocks = map[string]int{}
+	for _, kv := range scanPrefix(state, compositeKey(t, "holding", username)) {
+		var holding chaincode.Holding
+		require.NoError(t, json.Unmarshal(kv.Value, &holding))
+		user.Stocks[holding.Symbol] = holding.Quantity
+	}
+	return user
+}
+
+func readStock(t *testing.T, state map[string][]byte, stockID string) chaincode.StockToken {
+	var stock chaincode.StockToken
+	require.NoError(t, json.Unmarshal(state[compositeKey(t, "stock", stockID)], &stock))
+	return stock
+}
+
+func TestBuyAndSellStockInCents(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	err := stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180400, "")
+	require.EqualError(t, err, "insufficient payment. Required: 1805.00")
+
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(5000000-180500), readUser(t, state, "Alice").Balance)
+
+	// 反复买卖后余额必须精确回到原值
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, stockContract.BuyStock(transactionContext, "Bob", "META", 3, 84210, ""))
+		revenue, err := stockContract.SellStock(transactionContext, "Bob", "META", 3, "")
+		require.NoError(t, err)
+		require.Equal(t, int64(84210), revenue)
+	}
+	require.Equal(t, int64(7500000), readUser(t, state, "Bob").Balance)
+
+	total, err := stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, int64(5000000-180500+110*18050+50*15000), total)
+}
+
+func TestMigrateLegacyAmounts(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	state["stock_TSLA"] = []byte(`{"symbol":"TSLA","price":180.506,"quantity":10}`)
+	state["user_Alice"] = []byte(`{"name":"Alice","stocks":{"TSLA":1},"balance":49999.994,"history":[]}`)
+	state["stock_AAPL"] = []byte(`{"symbol":"AAPL","priceCents":15000,"quantity":10}`)
+
+	stockContract := chaincode.StockSmartContract{}
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err := stockContract.MigrateLegacyAmounts(transactionContext)
+	require.EqualError(t, err, "caller is not an admin")
+
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	migrated, err := stockContract.MigrateLegacyAmounts(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 2, migrated)
+
+	require.Contains(t, string(state["stock_TSLA"]), `"priceCents":18051`)
+	require.NotContains(t, string(state["stock_TSLA"]), `"price":`)
+	require.Contains(t, string(state["user_Alice"]), `"balanceCents":4999999`)
+	require.Contains(t, string(state["stock_AAPL"]), `"priceCents":15000`)
+
+	migrated, err = stockContract.MigrateLegacyAmounts(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 0, migrated)
+}
+
+func TestPlaceOrderMatchesByPriceTimePriority(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// Charlie 和 Alice 依次挂出 TSLA 卖单，Charlie 价格更高
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 30, 18200, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 2)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideSell, 20, 18100, "")
+	require.NoError(t, err)
+	require.Equal(t, 80, readUser(t, state, "Alice").Stocks["TSLA"])
+
+	book, err := stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, book.Asks, 2)
+	require.Equal(t, "Alice", book.Asks[0].Username)
+	require.Empty(t, book.Bids)
+
+	// Bob 以 182.50 买入 40 股：先吃 Alice 的 20 股，再吃 Charlie 的 20 股
+	setTx(chaincodeStub, 3)
+	result, err := stockContract.PlaceOrder(transactionContext, "Bob", "TSLA", chaincode.SideBuy, 40, 18250, "")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.OrderFilled, result.Order.Status)
+	require.Len(t, result.Fills, 2)
+	require.Equal(t, "Alice", result.Fills[0].Seller)
+	require.Equal(t, int64(18100), result.Fills[0].Price)
+	require.Equal(t, "Charlie", result.Fills[1].Seller)
+	require.Equal(t, 20, result.Fills[1].Quantity)
+
+	bob := readUser(t, state, "Bob")
+	require.Equal(t, 40, bob.Stocks["TSLA"])
+	require.Equal(t, int64(7500000-20*18100-20*18200), bob.Balance)
+	require.Equal(t, int64(5000000+20*18100), readUser(t, state, "Alice").Balance)
+
+	book, err = stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, book.Asks, 1)
+	require.Equal(t, 10, book.Asks[0].Remaining)
+
+	// Charlie 撤销剩余卖单，股票退回
+	err = stockContract.CancelOrder(transactionContext, "Bob", "tx001")
+	require.EqualError(t, err, "order tx001 does not belong to user Bob")
+	require.NoError(t, stockContract.CancelOrder(transactionContext, "Charlie", "tx001"))
+	require.Equal(t, 75-20, readUser(t, state, "Charlie").Stocks["TSLA"])
+
+	book, err = stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Empty(t, book.Asks)
+}
+
+func TestAdminListingAndPrices(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err := stockContract.SetStockPrice(transactionContext, "TSLA", 19000)
+	require.EqualError(t, err, "caller is not an admin")
+
+	transactionContext.GetClientIdentityReturns(&fakeIdentity{mspID: "Org2MSP", ous: []string{"admin"}})
+	err = stockContract.ListStock(transactionContext, "NVDA", 45000, 1000, "")
+	require.EqualError(t, err, "caller from Org2MSP is not authorized to perform admin operations")
+
+	// 带 stock.admin 属性的非 admin OU 证书同样视为管理员
+	transactionContext.GetClientIdentityReturns(&fakeIdentity{mspID: "Org1MSP", attrs: map[string]string{"stock.admin": "true"}})
+	require.NoError(t, stockContract.ListStock(transactionContext, "NVDA", 45000, 1000, ""))
+	err = stockContract.ListStock(transactionContext, "NVDA", 45000, 1000, "")
+	require.EqualError(t, err, "stock NVDA already exists")
+
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	stock, err := stockContract.SetStockPrice(transactionContext, "NVDA", 46000)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockActive, stock.Status)
+	require.Equal(t, int64(46000), readStock(t, state, "NVDA").Price)
+
+	// 退市时撤销挂单并退回冻结的股票
+	setTx(chaincodeStub, 1)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideSell, 10, 19000, "")
+	require.NoError(t, err)
+	require.NoError(t, stockContract.DelistStock(transactionContext, "TSLA"))
+	require.Equal(t, chaincode.StockDelisted, readStock(t, state, "TSLA").Status)
+	require.Equal(t, 100, readUser(t, state, "Alice").Stocks["TSLA"])
+
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18050, "")
+	require.EqualError(t, err, "stock TSLA is delisted")
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 1, "")
+	require.EqualError(t, err, "stock TSLA is delisted")
+}
+
+func TestTradingHaltsAndCircuitBreaker(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	err := stockContract.HaltStock(transactionContext, "TSLA", chaincode.HaltCircuitBreaker)
+	require.EqualError(t, err, "invalid halt reason circuit_breaker")
+	require.NoError(t, stockContract.HaltStock(transactionContext, "TSLA", chaincode.HaltNewsPending))
+	err = stockContract.HaltStock(transactionContext, "TSLA", chaincode.HaltNewsPending)
+	require.EqualError(t, err, "stock TSLA is already halted")
+
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18050, "")
+	require.EqualError(t, err, "stock TSLA is halted (news_pending)")
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 1, "")
+	require.EqualError(t, err, "stock TSLA is halted (news_pending)")
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideSell, 1, 18050, "")
+	require.EqualError(t, err, "stock TSLA is halted (news_pending)")
+
+	// 停牌期间调价不触发熔断，复牌后以当前价格为参考价
+	_, err = stockContract.SetStockPrice(transactionContext, "TSLA", 25000)
+	require.NoError(t, err)
+	require.NoError(t, stockContract.ResumeStock(transactionContext, "TSLA"))
+	tsla := readStock(t, state, "TSLA")
+	require.Equal(t, chaincode.StockActive, tsla.Status)
+	require.Empty(t, tsla.HaltReason)
+	require.Equal(t, int64(25000), tsla.ReferencePrice)
+	err = stockContract.ResumeStock(transactionContext, "TSLA")
+	require.EqualError(t, err, "stock TSLA is not halted")
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 25000, ""))
+
+	// 默认阈值 10%：偏离参考价 10% 以内正常调价，超过则自动停牌
+	stock, err := stockContract.SetStockPrice(transactionContext, "TSLA", 27500)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockActive, stock.Status)
+	stock, err = stockContract.SetStockPrice(transactionContext, "TSLA", 22499)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockHalted, stock.Status)
+	require.Equal(t, chaincode.HaltCircuitBreaker, stock.HaltReason)
+	name, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.EventStockHalted, name)
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 22499, "")
+	require.EqualError(t, err, "stock TSLA is halted (circuit_breaker)")
+
+	// 未设置参考价的旧记录以调价前的价格为参考价；阈值为 0 时关闭熔断
+	require.NoError(t, stockContract.SetCircuitBreaker(transactionContext, 500))
+	stock, err = stockContract.SetStockPrice(transactionContext, "BABA", 9000)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockHalted, stock.Status)
+	require.Equal(t, int64(8520), stock.ReferencePrice)
+	require.NoError(t, stockContract.SetCircuitBreaker(transactionContext, 0))
+	stock, err = stockContract.SetStockPrice(transactionContext, "AAPL", 30000)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockActive, stock.Status)
+	config, err := stockContract.GetCircuitBreaker(transactionContext)
+	require.NoError(t, err)
+	require.Zero(t, config.ThresholdBasisPoints)
+
+	err = stockContract.SetCircuitBreaker(transactionContext, -1)
+	require.EqualError(t, err, "circuit breaker threshold must be between 0 and 10000 basis points")
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	err = stockContract.HaltStock(transactionContext, "AAPL", chaincode.HaltRegulatory)
+	require.EqualError(t, err, "caller is not an admin")
+}
+
+func TestCreateUserDepositAndWithdraw(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+
+	err := stockContract.CreateUser(transactionContext, "Frank")
+	require.EqualError(t, err, "account must be provided in the transient map")
+	withAccount(chaincodeStub, 100000, "", "")
+	require.NoError(t, stockContract.CreateUser(transactionContext, "Frank"))
+	err = stockContract.CreateUser(transactionContext, "Frank")
+	require.EqualError(t, err, "user Frank already exists")
+	withAccount(chaincodeStub, -1, "", "")
+	err = stockContract.CreateUser(transactionContext, "Grace")
+	require.EqualError(t, err, "initial balance must not be negative")
+
+	withAmount(chaincodeStub, 2550)
+	balance, err := stockContract.Deposit(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	require.Equal(t, int64(102550), balance)
+
+	_, err = stockContract.Deposit(transactionContext, "Frank", "", "gift")
+	require.EqualError(t, err, "invalid reason code gift")
+
+	withAmount(chaincodeStub, 102551)
+	_, err = stockContract.Withdraw(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.EqualError(t, err, "insufficient balance. Available: 1025.50")
+
+	withAmount(chaincodeStub, 2550)
+	balance, err = stockContract.Withdraw(transactionContext, "Frank", "", chaincode.ReasonFee)
+	require.NoError(t, err)
+	require.Equal(t, int64(100000), balance)
+
+	frank := readUser(t, state, "Frank")
+	require.Equal(t, int64(100000), frank.Balance)
+	require.Len(t, frank.History, 3)
+	require.Equal(t, "Withdrew $25.50 (fee)", frank.History[2])
+}
+
+func TestTransferSharesAndCash(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	err := stockContract.TransferShares(transactionContext, "Alice", "Bob", "TSLA", 101)
+	require.EqualError(t, err, "insufficient shares to transfer")
+	err = stockContract.TransferShares(transactionContext, "Alice", "Alice", "TSLA", 1)
+	require.EqualError(t, err, "cannot transfer to the same account")
+	err = stockContract.TransferShares(transactionContext, "Alice", "Nobody", "TSLA", 1)
+	require.EqualError(t, err, "user Nobody not found")
+
+	require.NoError(t, stockContract.TransferShares(transactionContext, "Alice", "Bob", "TSLA", 40))
+	setTx(chaincodeStub, 1)
+	withAmount(chaincodeStub, 722000)
+	require.NoError(t, stockContract.TransferCash(transactionContext, "Bob", "Alice", ""))
+
+	alice := readUser(t, state, "Alice")
+	bob := readUser(t, state, "Bob")
+	require.Equal(t, 60, alice.Stocks["TSLA"])
+	require.Equal(t, 40, bob.Stocks["TSLA"])
+	require.Equal(t, int64(5722000), alice.Balance)
+	require.Equal(t, int64(6778000), bob.Balance)
+	require.Equal(t, []string{"Initial account setup", "Received $7220.00 from Bob"}, alice.History)
+	require.Equal(t, "Transferred $7220.00 to Alice", bob.History[len(bob.History)-1])
+
+	trades, err := stockContract.GetUserTrades(transactionContext, "Bob", "", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	require.Equal(t, chaincode.TradeTransferIn, trades[0].Side)
+	require.Equal(t, "TSLA", trades[0].Symbol)
+	require.Equal(t, 40, trades[0].Quantity)
+	require.Equal(t, "Alice", trades[0].Counterparty)
+	require.Equal(t, chaincode.TradeTransferOut, trades[1].Side)
+	require.Equal(t, "USD", trades[1].Currency)
+	require.Zero(t, trades[1].Amount)
+
+	// 转账金额不出现在公共的交易记录和事件中
+	eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.EventCashTransferred, eventName)
+	require.NotContains(t, string(payload), "amountCents")
+
+	withAmount(chaincodeStub, 6778001)
+	err = stockContract.TransferCash(transactionContext, "Bob", "Alice", "")
+	require.EqualError(t, err, "insufficient balance. Available: 67780.00")
+}
+
+func TestMigrateStorageLayout(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	state["stock_TSLA"] = []byte(`{"symbol":"TSLA","price":180.5,"quantity":10}`)
+	state["user_Alice"] = []byte(`{"name":"Alice","stocks":{"TSLA":5,"AAPL":0},"balanceCents":100,"history":["Initial account setup"]}`)
+	state["order_tx001"] = []byte(`{"id":"tx001","username":"Alice","symbol":"TSLA","side":"sell","priceCents":19000,"quantity":2,"remaining":2,"status":"open","timestamp":"2024-01-01T00:00:01Z"}`)
+	state["book_TSLA_S_0000000000000019000_00000000001704067201000000000_tx001"] = []byte("tx001")
+
+	stockContract := chaincode.StockSmartContract{}
+	migrated, err := stockContract.MigrateStorageLayout(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 4, migrated)
+
+	for key := range state {
+		require.True(t, strings.HasPrefix(key, "\x00"), "legacy key %q left behind", key)
+	}
+	require.Equal(t, int64(18050), readStock(t, state, "TSLA").Price)
+	require.Equal(t, map[string]int{"TSLA": 5}, readUser(t, state, "Alice").Stocks)
+
+	users, err := stockContract.GetAllUser(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 5, users["user_Alice"].Stocks["TSLA"])
+
+	book, err := stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, book.Asks, 1)
+	require.Equal(t, "tx001", book.Asks[0].ID)
+
+	stocks, err := stockContract.GetAllStock(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stock_TSLA"}, keys(stocks))
+}
+
+func TestPaginatedListing(t *testing.T) {
+	transactionContext, _, _ := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	var stockKeys []string
+	bookmark := ""
+	for {
+		page, err := stockContract.GetStocksPage(transactionContext, 2, bookmark)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Stocks), 2)
+		stockKeys = append(stockKeys, keys(page.Stocks)...)
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	require.Equal(t, []string{"stock_0700.HK", "stock_AAPL", "stock_BABA", "stock_META", "stock_TSLA"}, stockKeys)
+
+	users, err := stockContract.GetUsersPage(transactionContext, 3, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user_Alice", "user_Bob", "user_Charlie"}, keys(users.Users))
+	require.Equal(t, 100, users.Users["user_Alice"].Stocks["TSLA"])
+	require.NotEmpty(t, users.Bookmark)
+
+	// 资产分页跨越股票和用户两种类型
+	var assetKeys []string
+	bookmark = ""
+	pages := 0
+	for {
+		page, err := stockContract.GetAssetsPage(transactionContext, 4, bookmark)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Assets), 4)
+		assetKeys = append(assetKeys, keys(page.Assets)...)
+		pages++
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	require.Equal(t, 3, pages)
+	require.Len(t, assetKeys, 10)
+	require.Equal(t, "user_Eve", assetKeys[9])
+
+	_, err = stockContract.GetStocksPage(transactionContext, 0, "")
+	require.EqualError(t, err, "page size must be between 1 and 200")
+}
+
+func TestGetUserTradesByTimeRange(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, ""))
+	setTx(chaincodeStub, 2)
+	_, err := stockContract.PlaceOrder(transactionContext, "Bob", "BABA", chaincode.SideSell, 5, 9000, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "BABA", chaincode.SideBuy, 5, 9500, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 4)
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 4, "")
+	require.NoError(t, err)
+
+	trades, err := stockContract.GetUserTrades(transactionContext, "Alice", "", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 3)
+	require.Equal(t, chaincode.Trade{
+		ID: "tx001_000", TxID: "tx001", Username: "Alice", Side: chaincode.TradeBuy, Symbol: "TSLA",
+		Quantity: 10, Price: 18050, Currency: "USD", Amount: 180500, Counterparty: "", Timestamp: "2024-01-01T00:00:01Z",
+	}, trades[0])
+	require.Equal(t, chaincode.TradeBuy, trades[1].Side)
+	require.Equal(t, "Bob", trades[1].Counterparty)
+	require.Equal(t, int64(9000), trades[1].Price)
+	require.Equal(t, chaincode.TradeSell, trades[2].Side)
+
+	trades, err = stockContract.GetUserTrades(transactionContext, "Alice", "2024-01-01T00:00:02Z", "2024-01-01T00:00:04Z")
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.Equal(t, "tx003", trades[0].TxID)
+
+	trades, err = stockContract.GetUserTrades(transactionContext, "Bob", "2024-01-01T00:00:03Z", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.Equal(t, chaincode.TradeSell, trades[0].Side)
+	require.Equal(t, "Alice", trades[0].Counterparty)
+
+	_, err = stockContract.GetUserTrades(transactionContext, "Alice", "yesterday", "")
+	require.EqualError(t, err, "invalid time yesterday, must be RFC3339")
+	_, err = stockContract.GetUserTrades(transactionContext, "Nobody", "", "")
+	require.EqualError(t, err, "user Nobody not found")
+}
+
+func TestGetUserAndStockHistory(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, ""))
+	setTx(chaincodeStub, 2)
+	withAmount(chaincodeStub, 10000)
+	_, err := stockContract.Withdraw(transactionContext, "Alice", "", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 3)
+	require.NoError(t, stockContract.CloseAccount(transactionContext, "Alice", "Bob"))
+
+	versions, err := stockContract.GetUserHistory(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	require.Equal(t, "tx000", versions[0].TxID)
+	require.Equal(t, "Alice", versions[0].Value.Name)
+	require.Equal(t, "tx001", versions[1].TxID)
+	require.Equal(t, "2024-01-01T00:00:01Z", versions[1].Timestamp)
+	// 余额变动通过同一交易写入的交易记录追溯
+	require.Equal(t, []string{"tx001_000"}, versions[1].TradeIDs)
+	require.Empty(t, versions[2].TradeIDs)
+	require.Len(t, versions[3].TradeIDs, 3)
+	// 出金和销户转出余额写入现金流水
+	require.Empty(t, versions[1].CashEntryIDs)
+	require.Equal(t, []string{"tx002_000"}, versions[2].CashEntryIDs)
+	require.Len(t, versions[3].CashEntryIDs, 1)
+	require.Equal(t, "tx002", versions[2].TxID)
+	// 余额保存在私有数据集合中，不出现在公共记录的历史里
+	require.Zero(t, versions[2].Value.Balance)
+	require.True(t, versions[3].IsDelete)
+	require.Equal(t, "tx003", versions[3].TxID)
+
+	stockVersions, err := stockContract.GetStockHistory(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, stockVersions, 3)
+	require.Equal(t, 1000000, stockVersions[0].Value.Quantity)
+	require.Equal(t, 999990, stockVersions[1].Value.Quantity)
+	require.Equal(t, 1000100, stockVersions[2].Value.Quantity)
+
+	_, err = stockContract.GetStockHistory(transactionContext, "NVDA")
+	require.EqualError(t, err, "stock NVDA not found")
+}
+
+func TestStateChangesEmitEvents(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	lastEvent := func() (string, chaincode.StockEvent) {
+		name, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+		var event chaincode.StockEvent
+		require.NoError(t, json.Unmarshal(payload, &event))
+		return name, event
+	}
+
+	name, _ := lastEvent()
+	require.Equal(t, chaincode.EventLedgerInitialized, name)
+
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, ""))
+	name, event := lastEvent()
+	require.Equal(t, chaincode.EventStockBought, name)
+	require.Equal(t, chaincode.StockEvent{
+		Type: chaincode.EventStockBought, TxID: "tx001", Username: "Alice", Symbol: "TSLA",
+		Quantity: 10, Price: 18050, Currency: "USD", Amount: 180500,
+	}, event)
+
+	setTx(chaincodeStub, 2)
+	_, err := stockContract.SellStock(transactionContext, "Alice", "TSLA", 4, "")
+	require.NoError(t, err)
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventStockSold, name)
+	require.Equal(t, int64(72200), event.Amount)
+
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.PlaceOrder(transactionContext, "Bob", "BABA", chaincode.SideSell, 5, 9000, "")
+	require.NoError(t, err)
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventOrderPlaced, name)
+	require.Equal(t, "tx003", event.Order.ID)
+	require.Empty(t, event.Fills)
+
+	setTx(chaincodeStub, 4)
+	require.NoError(t, stockContract.CloseAccount(transactionContext, "Charlie", "Alice"))
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventAccountClosed, name)
+	require.Equal(t, "Charlie", event.Username)
+	require.Equal(t, "Alice", event.Counterparty)
+
+	// 失败的交易不发出事件
+	calls := chaincodeStub.SetEventCallCount()
+	require.Error(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 1, ""))
+	require.Equal(t, calls, chaincodeStub.SetEventCallCount())
+
+	// 配置类事件的取值放在各自的字段中，不复用价格、数量等字段
+	setTx(chaincodeStub, 5)
+	require.NoError(t, stockContract.SetFXRate(transactionContext, "HKD", 129000))
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventFXRateSet, name)
+	require.Zero(t, event.Price)
+	require.Equal(t, &chaincode.FXRate{Currency: "HKD", Rate: 129000, UpdatedAt: "2024-01-01T00:00:05Z"}, event.FXRate)
+
+	setTx(chaincodeStub, 6)
+	require.NoError(t, stockContract.SetCircuitBreaker(transactionContext, 0))
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventCircuitBreakerSet, name)
+	require.Zero(t, event.Count)
+	require.Equal(t, &chaincode.CircuitBreaker{ThresholdBasisPoints: 0}, event.CircuitBreaker)
+
+	setTx(chaincodeStub, 7)
+	_, err = stockContract.SplitStock(transactionContext, "META", 2, 1)
+	require.NoError(t, err)
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventStockSplit, name)
+	require.Empty(t, event.Reason)
+	require.Equal(t, 2, event.Split.Numerator)
+	require.Equal(t, 1, event.Split.Denominator)
+	require.Equal(t, event.Split.NewPrice, event.Price)
+
+	setTx(chaincodeStub, 8)
+	require.NoError(t, stockContract.SetCostBasisMethod(transactionContext, "Bob", chaincode.CostBasisAverage))
+	name, event = lastEvent()
+	require.Equal(t, chaincode.EventCostBasisMethodSet, name)
+	require.Empty(t, event.Reason)
+	require.Equal(t, chaincode.CostBasisAverage, event.CostBasisMethod)
+}
+
+func TestAccountsBoundToCallerIdentity(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 用户只能开立零余额账户，入金由管理员完成
+	frankIdentity := &fakeIdentity{mspID: "Org1MSP", id: "frank", ous: []string{"client"}}
+	transactionContext.GetClientIdentityReturns(frankIdentity)
+	withAccount(chaincodeStub, 100000, "", "")
+	require.EqualError(t, stockContract.CreateUser(transactionContext, "Frank"), "caller is not an admin")
+	withAccount(chaincodeStub, 0, "", "")
+	require.NoError(t, stockContract.CreateUser(transactionContext, "Frank"))
+	frank := readUser(t, state, "Frank")
+	require.Equal(t, "Org1MSP", frank.OwnerMSP)
+	require.Equal(t, "frank", frank.OwnerID)
+	withAmount(chaincodeStub, 100000)
+	_, err := stockContract.Deposit(transactionContext, "Frank", "", chaincode.ReasonPromotion)
+	require.EqualError(t, err, "caller is not an admin")
+	_, err = stockContract.Deposit(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.EqualError(t, err, "caller is not an admin")
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	_, err = stockContract.Deposit(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	transactionContext.GetClientIdentityReturns(frankIdentity)
+
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Frank", "BABA", 10, 85200, ""))
+
+	// 其他身份不能操作 Frank 的账户
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	err = stockContract.BuyStock(transactionContext, "Frank", "BABA", 1, 8520, "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.SellStock(transactionContext, "Frank", "BABA", 1, "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.Withdraw(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	err = stockContract.TransferCash(transactionContext, "Frank", "Alice", "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.PlaceOrder(transactionContext, "Frank", "BABA", chaincode.SideSell, 1, 9000, "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	err = stockContract.CloseAccount(transactionContext, "Frank", "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+
+	// 未绑定的演示账户只能由管理员操作，绑定后归属指定身份
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18050, "")
+	require.EqualError(t, err, "account Alice is not bound to an identity")
+	err = stockContract.BindAccount(transactionContext, "Alice", "Org1MSP", "user1")
+	require.EqualError(t, err, "caller is not an admin")
+
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	require.NoError(t, stockContract.BindAccount(transactionContext, "Alice", "Org1MSP", "user1"))
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18050, ""))
+
+	caller, err := stockContract.WhoAmI(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.CallerIdentity{MSPID: "Org1MSP", ID: "user1"}, caller)
+}
+
+func TestCloseAccount(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 没有持仓和余额的账户可以直接销户，用户名不能再次开户
+	withAccount(chaincodeStub, 0, "", "")
+	require.NoError(t, stockContract.CreateUser(transactionContext, "Frank"))
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.CloseAccount(transactionContext, "Frank", ""))
+	closed, err := stockContract.GetClosedAccount(transactionContext, "Frank")
+	require.NoError(t, err)
+	require.Equal(t, "tx001", closed.TxID)
+	require.Equal(t, "admin", closed.OwnerID)
+	err = stockContract.CreateUser(transactionContext, "Frank")
+	require.EqualError(t, err, "username Frank belongs to a closed account and cannot be reused")
+	err = stockContract.BuyStock(transactionContext, "Frank", "TSLA", 1, 18050, "")
+	require.EqualError(t, err, "account Frank is closed")
+	_, err = stockContract.GetClosedAccount(transactionContext, "Alice")
+	require.EqualError(t, err, "account Alice is not closed")
+
+	// 仍有挂单、持仓或余额时拒绝直接销户
+	setTx(chaincodeStub, 2)
+	order, err := stockContract.PlaceOrder(transactionContext, "Bob", "BABA", chaincode.SideSell, 5, 9000, "")
+	require.NoError(t, err)
+	err = stockContract.CloseAccount(transactionContext, "Bob", "")
+	require.EqualError(t, err, "account Bob has open orders")
+	err = stockContract.CloseAccount(transactionContext, "Alice", "")
+	require.EqualError(t, err, "account Alice still holds shares")
+	err = stockContract.CloseAccount(transactionContext, "Bob", "Bob")
+	require.EqualError(t, err, "cannot pay out to the account being closed")
+	err = stockContract.CloseAccount(transactionContext, "Bob", "Frank")
+	require.EqualError(t, err, "account Frank is closed")
+
+	// 指定收款账户时撤单、按现价清仓并转出余额
+	setTx(chaincodeStub, 3)
+	require.NoError(t, stockContract.CloseAccount(transactionContext, "Bob", "Alice"))
+	require.NotContains(t, state, compositeKey(t, "user", "Bob"))
+	require.Empty(t, scanPrefix(state, compositeKey(t, "holding", "Bob")))
+	require.Equal(t, int64(5000000+7500000+200*8520+80*28070), readUser(t, state, "Alice").Balance)
+	require.Equal(t, 2000200, readStock(t, state, "BABA").Quantity)
+	require.Equal(t, 800080, readStock(t, state, "META").Quantity)
+
+	cancelled, err := stockContract.GetOrder(transactionContext, order.Order.ID)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.OrderCancelled, cancelled.Status)
+
+	trades, err := stockContract.GetUserTrades(transactionContext, "Alice", "", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.Equal(t, chaincode.TradeTransferIn, trades[0].Side)
+	require.Equal(t, "Bob", trades[0].Counterparty)
+	require.Zero(t, trades[0].Amount)
+	require.Equal(t, "Received $114496.00 from closed account Bob", readUser(t, state, "Alice").History[1])
+}
+
+func TestDeclareDividend(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// Charlie 挂卖单冻结的 25 股仍参与派息
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 25, 99999, "")
+	require.NoError(t, err)
+
+	setTx(chaincodeStub, 2)
+	_, err = stockContract.DeclareDividend(transactionContext, "TSLA", 125, "2024-01-02")
+	require.EqualError(t, err, "record date 2024-01-02 is in the future")
+	_, err = stockContract.DeclareDividend(transactionContext, "TSLA", 0, "2024-01-01")
+	require.EqualError(t, err, "dividend per share must be positive")
+	_, err = stockContract.DeclareDividend(transactionContext, "TSLA", 125, "20240101")
+	require.EqualError(t, err, "invalid record date 20240101, must be YYYY-MM-DD")
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err = stockContract.DeclareDividend(transactionContext, "TSLA", 125, "2024-01-01")
+	require.EqualError(t, err, "caller is not an admin")
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+
+	declaration, err := stockContract.DeclareDividend(transactionContext, "TSLA", 125, "2024-01-01")
+	require.NoError(t, err)
+	require.Equal(t, "TSLA_2024-01-01", declaration.ID)
+	require.Equal(t, 2, declaration.Holders)
+	require.Equal(t, 175, declaration.TotalShares)
+	require.Equal(t, int64(175*125), declaration.Total)
+	require.Equal(t, int64(5000000+100*125), readUser(t, state, "Alice").Balance)
+	require.Equal(t, int64(6000000+75*125), readUser(t, state, "Charlie").Balance)
+	require.Equal(t, "Dividend $125.00 on 100 TSLA", readUser(t, state, "Alice").History[1])
+
+	name, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.EventDividendDeclared, name)
+
+	// 同一宣布重复提交不会重复派息
+	setTx(chaincodeStub, 3)
+	again, err := stockContract.DeclareDividend(transactionContext, "TSLA", 125, "2024-01-01")
+	require.NoError(t, err)
+	require.Equal(t, "tx002", again.TxID)
+	require.Equal(t, int64(5000000+100*125), readUser(t, state, "Alice").Balance)
+
+	// 每股派息不同的重复宣布被拒绝，已退市的股票不能分红
+	_, err = stockContract.DeclareDividend(transactionContext, "TSLA", 150, "2024-01-01")
+	require.EqualError(t, err, "dividend TSLA_2024-01-01 was already declared by transaction tx002 with $1.25 per share")
+	require.Equal(t, int64(5000000+100*125), readUser(t, state, "Alice").Balance)
+	require.NoError(t, stockContract.DelistStock(transactionContext, "META"))
+	_, err = stockContract.DeclareDividend(transactionContext, "META", 100, "2024-01-01")
+	require.EqualError(t, err, "stock META is delisted")
+
+	payments, err := stockContract.GetUserDividends(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Len(t, payments, 1)
+	require.Equal(t, "TSLA_2024-01-01", payments[0].DeclarationID)
+	require.Equal(t, 100, payments[0].Shares)
+	require.Equal(t, int64(12500), payments[0].Amount)
+
+	payments, err = stockContract.GetUserDividends(transactionContext, "Bob")
+	require.NoError(t, err)
+	require.Empty(t, payments)
+
+	stored, err := stockContract.GetDividend(transactionContext, "TSLA_2024-01-01")
+	require.NoError(t, err)
+	require.Equal(t, declaration, stored)
+}
+
+func TestSplitStock(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 25, 99999, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 2)
+	_, err = stockContract.PlaceOrder(transactionContext, "Bob", "TSLA", chaincode.SideBuy, 1, 100, "")
+	require.NoError(t, err)
+
+	_, err = stockContract.SplitStock(transactionContext, "TSLA", 2, 2)
+	require.EqualError(t, err, "split ratio must not be 1:1")
+	_, err = stockContract.SplitStock(transactionContext, "TSLA", 0, 2)
+	require.EqualError(t, err, "split ratio terms must be between 1 and 1000")
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err = stockContract.SplitStock(transactionContext, "TSLA", 3, 2)
+	require.EqualError(t, err, "caller is not an admin")
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+
+	// 3:2 拆股：挂单全部撤销，Charlie 的 75 股变为 112 股，半股按拆股前股价折现
+	setTx(chaincodeStub, 3)
+	result, err := stockContract.SplitStock(transactionContext, "TSLA", 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.SplitResult{
+		Symbol: "TSLA", Numerator: 3, Denominator: 2, OldPrice: 18050, NewPrice: 12033,
+		Holders: 2, Cancelled: 2, CashInLieu: 6017,
+	}, result)
+	require.Equal(t, 150, readUser(t, state, "Alice").Stocks["TSLA"])
+	charlie := readUser(t, state, "Charlie")
+	require.Equal(t, 112, charlie.Stocks["TSLA"])
+	require.Equal(t, int64(6000000+6017), charlie.Balance)
+	require.Equal(t, "Split 3:2 TSLA: 75 -> 112 shares, cash in lieu $60.17", charlie.History[1])
+	require.Equal(t, int64(7500000), readUser(t, state, "Bob").Balance)
+	tsla := readStock(t, state, "TSLA")
+	require.Equal(t, int64(12033), tsla.Price)
+	require.Equal(t, 1500000, tsla.Quantity)
+
+	book, err := stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Empty(t, book.Bids)
+	require.Empty(t, book.Asks)
+
+	// 1:7 合股
+	setTx(chaincodeStub, 4)
+	result, err = stockContract.SplitStock(transactionContext, "BABA", 1, 7)
+	require.NoError(t, err)
+	require.Equal(t, int64(59640), result.NewPrice)
+	require.Equal(t, int64(4*8520+5*8520), result.CashInLieu)
+	require.Equal(t, 28, readUser(t, state, "Bob").Stocks["BABA"])
+	require.Equal(t, 25, readUser(t, state, "Eve").Stocks["BABA"])
+	require.Equal(t, 285715, readStock(t, state, "BABA").Quantity)
+}
+
+func TestUserPrivateData(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	withAccount(chaincodeStub, 100000, "Frank Li", "frank@example.com")
+	require.NoError(t, stockContract.CreateUser(transactionContext, "Frank"))
+
+	// 公共记录中只有账户名和绑定身份
+	var public map[string]interface{}
+	require.NoError(t, json.Unmarshal(state[compositeKey(t, "user", "Frank")], &public))
+	require.Equal(t, []string{"name", "ownerId", "ownerMsp"}, keys(public))
+	frank := readUser(t, state, "Frank")
+	require.Equal(t, int64(100000), frank.Balance)
+	require.Equal(t, "Frank Li", frank.RealName)
+
+	withAccount(chaincodeStub, 0, "Frank Li", "li@example.com")
+	require.NoError(t, stockContract.UpdateAccountDetails(transactionContext, "Frank"))
+	require.Equal(t, "li@example.com", readUser(t, state, "Frank").Email)
+	require.Equal(t, int64(100000), readUser(t, state, "Frank").Balance)
+
+	users, err := stockContract.GetAllUser(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, int64(100000), users["user_Frank"].Balance)
+
+	// 非集合成员组织只能看到公共字段
+	transactionContext.GetClientIdentityReturns(&fakeIdentity{mspID: "Org2MSP", id: "auditor"})
+	users, err = stockContract.GetAllUser(transactionContext)
+	require.NoError(t, err)
+	require.Zero(t, users["user_Frank"].Balance)
+	require.Empty(t, users["user_Frank"].Email)
+	require.Empty(t, users["user_Frank"].History)
+	require.Equal(t, 100, users["user_Alice"].Stocks["TSLA"])
+
+	// 集合成员组织内的其他客户端同样只能看到自己账户的私有字段
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	require.NoError(t, stockContract.BindAccount(transactionContext, "Alice", "Org1MSP", "user1"))
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	users, err = stockContract.GetAllUser(transactionContext)
+	require.NoError(t, err)
+	require.Zero(t, users["user_Frank"].Balance)
+	require.Equal(t, int64(5000000), users["user_Alice"].Balance)
+	_, err = stockContract.GetUserTotalValue(transactionContext, "Frank")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.GetUserValuation(transactionContext, "Frank", "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.GetUserPnL(transactionContext, "Frank")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.GetUserTrades(transactionContext, "Frank", "", "")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.GetClientOrder(transactionContext, "Frank", "any")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+	_, err = stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.NoError(t, err)
+	transactionContext.GetClientIdentityReturns(&fakeIdentity{mspID: "Org2MSP", id: "auditor"})
+
+	hash, err := stockContract.GetUserPrivateHash(transactionContext, "Frank")
+	require.NoError(t, err)
+	expected := sha256.Sum256(state[privateKey(chaincode.UserPrivateCollection, compositeKey(t, "user", "Frank"))])
+	require.Equal(t, fmt.Sprintf("%x", expected), hash)
+	_, err = stockContract.GetUserPrivateHash(transactionContext, "Nobody")
+	require.EqualError(t, err, "user Nobody has no private data")
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+
+	// 旧账户的余额和历史保存在公共记录中，迁移后移入私有数据集合
+	aliceKey := compositeKey(t, "user", "Alice")
+	delete(state, privateKey(chaincode.UserPrivateCollection, aliceKey))
+	state[aliceKey] = []byte(`{"name":"Alice","balanceCents":5000000,"history":["Initial account setup"],"ownerMsp":"","ownerId":""}`)
+	migrated, err := stockContract.MigrateUserPrivateData(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 1, migrated)
+	require.NoError(t, json.Unmarshal(state[aliceKey], &public))
+	require.NotContains(t, public, "balanceCents")
+	alice := readUser(t, state, "Alice")
+	require.Equal(t, int64(5000000), alice.Balance)
+	require.Equal(t, []string{"Initial account setup"}, alice.History)
+
+	migrated, err = stockContract.MigrateUserPrivateData(transactionContext)
+	require.NoError(t, err)
+	require.Zero(t, migrated)
+}
+
+func keys[V any](m map[string]V) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestTradeFees(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	err := stockContract.SetFeeSchedule(transactionContext, "Nobody", 100, 25, 500)
+	require.EqualError(t, err, "fee collector Nobody not found")
+	err = stockContract.SetSymbolFee(transactionContext, "AAPL", 0, 0, 500)
+	require.EqualError(t, err, "fee collector is not configured")
+	err = stockContract.SetFeeSchedule(transactionContext, "Eve", 100, 10001, 0)
+	require.EqualError(t, err, "fee rate must be between 0 and 10000 basis points")
+
+	// 默认费率：每笔 1.00 加成交金额的 0.25%，最低 5.00；AAPL 单独按每笔 5.00 收取
+	require.NoError(t, stockContract.SetFeeSchedule(transactionContext, "Eve", 100, 25, 500))
+	require.NoError(t, stockContract.SetSymbolFee(transactionContext, "AAPL", 0, 0, 500))
+
+	quote, err := stockContract.QuoteFee(transactionContext, "TSLA", chaincode.SideBuy, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(180500), quote.Notional)
+	require.Equal(t, int64(551), quote.Fee)
+	require.Equal(t, int64(181051), quote.Total)
+	quote, err = stockContract.QuoteFee(transactionContext, "AAPL", chaincode.SideSell, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(15000-500), quote.Total)
+
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, "")
+	require.EqualError(t, err, "insufficient payment. Required: 1810.51")
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 181051, ""))
+	setTx(chaincodeStub, 2)
+	proceeds, err := stockContract.SellStock(transactionContext, "Alice", "AAPL", 1, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(14500), proceeds)
+	require.Equal(t, int64(5000000-181051+14500), readUser(t, state, "Alice").Balance)
+
+	trades, err := stockContract.GetUserTrades(transactionContext, "Alice", "", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	require.Equal(t, int64(551), trades[0].Fee)
+	require.Equal(t, int64(15000), trades[1].Amount)
+	require.Equal(t, int64(500), trades[1].Fee)
+
+	// 撮合成交买卖双方各付手续费；买单按全部委托金额预留手续费，撤单时退回未使用的部分
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 10, 18000, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 4)
+	result, err := stockContract.PlaceOrder(transactionContext, "Bob", "TSLA", chaincode.SideBuy, 20, 18100, "")
+	require.NoError(t, err)
+	require.Len(t, result.Fills, 1)
+	require.Equal(t, int64(550), result.Fills[0].BuyerFee)
+	require.Equal(t, int64(550), result.Fills[0].SellerFee)
+	require.Equal(t, int64(1005-550), result.Order.FeeReserved)
+	require.Equal(t, int64(7500000-20*18100-1005+10*100), readUser(t, state, "Bob").Balance)
+	require.Equal(t, int64(6000000+180000-550), readUser(t, state, "Charlie").Balance)
+
+	require.NoError(t, stockContract.CancelOrder(transactionContext, "Bob", "tx004"))
+	require.Equal(t, int64(7500000-180000-550), readUser(t, state, "Bob").Balance)
+	require.Equal(t, int64(5500000+551+500+550+550), readUser(t, state, "Eve").Balance)
+
+	require.NoError(t, stockContract.RemoveSymbolFee(transactionContext, "AAPL"))
+	err = stockContract.RemoveSymbolFee(transactionContext, "AAPL")
+	require.EqualError(t, err, "stock AAPL has no fee override")
+	schedule, err := stockContract.GetFeeSchedule(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "Eve", schedule.Collector)
+	require.Empty(t, schedule.Overrides)
+
+	err = stockContract.CloseAccount(transactionContext, "Eve", "Alice")
+	require.EqualError(t, err, "account Eve is the fee collector")
+}
+
+func TestMultiCurrencyAccounts(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	rates, err := stockContract.GetFXRates(transactionContext)
+	require.NoError(t, err)
+	require.Len(t, rates, 1)
+	require.Equal(t, "HKD", rates[0].Currency)
+	require.Equal(t, "HKD", readStock(t, state, "0700.HK").Currency)
+
+	err = stockContract.SetFXRate(transactionContext, "USD", 1000000)
+	require.EqualError(t, err, "the rate of the base currency USD is fixed")
+	err = stockContract.SetFXRate(transactionContext, "jpy", 6700)
+	require.EqualError(t, err, "invalid currency jpy")
+	err = stockContract.ListStock(transactionContext, "7203.T", 250000, 1000, "JPY")
+	require.EqualError(t, err, "no FX rate for JPY")
+	require.NoError(t, stockContract.SetFXRate(transactionContext, "JPY", 6700))
+	require.NoError(t, stockContract.ListStock(transactionContext, "7203.T", 250000, 1000, "JPY"))
+	require.Equal(t, "JPY", readStock(t, state, "7203.T").Currency)
+
+	// 港股以港币现金买入，美元余额不受影响
+	err = stockContract.BuyStock(transactionContext, "Alice", "0700.HK", 10, 320000, "")
+	require.EqualError(t, err, "insufficient balance. Required: 3200.00 HKD")
+	withAmount(chaincodeStub, 1000000)
+	balance, err := stockContract.Deposit(transactionContext, "Alice", "HKD", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000000), balance)
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "0700.HK", 10, 320000, ""))
+	alice := readUser(t, state, "Alice")
+	require.Equal(t, int64(5000000), alice.Balance)
+	require.Equal(t, map[string]int64{"HKD": 680000}, alice.Balances)
+	require.Equal(t, "Deposited HKD 10000.00 (bank_transfer)", alice.History[len(alice.History)-1])
+
+	trades, err := stockContract.GetUserTrades(transactionContext, "Alice", "", "")
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	require.Equal(t, "HKD", trades[0].Currency)
+
+	setTx(chaincodeStub, 2)
+	withAmount(chaincodeStub, 80000)
+	require.NoError(t, stockContract.TransferCash(transactionContext, "Alice", "Bob", "HKD"))
+	require.Equal(t, int64(80000), readUser(t, state, "Bob").Balances["HKD"])
+	withAmount(chaincodeStub, 700000)
+	err = stockContract.TransferCash(transactionContext, "Alice", "Bob", "HKD")
+	require.EqualError(t, err, "insufficient balance. Available: 6000.00 HKD")
+
+	// 估值按汇率折算：1 HKD = 0.128 USD，四舍五入到分
+	valuation, err := stockContract.GetUserValuation(transactionContext, "Alice", "")
+	require.NoError(t, err)
+	require.Equal(t, "USD", valuation.Currency)
+	require.Equal(t, int64(5000000+76800+40960+750000+1805000), valuation.Total)
+	require.Len(t, valuation.Lines, 5)
+	require.Equal(t, chaincode.ValuationLine{Currency: "HKD", Value: 600000, Converted: 76800}, valuation.Lines[1])
+	require.Equal(t, chaincode.ValuationLine{Symbol: "0700.HK", Quantity: 10, Currency: "HKD", Value: 320000, Converted: 40960}, valuation.Lines[2])
+	total, err := stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, valuation.Total, total)
+
+	valuation, err = stockContract.GetUserValuation(transactionContext, "Alice", "HKD")
+	require.NoError(t, err)
+	require.Equal(t, int64(39062500+600000+320000+5859375+14101563), valuation.Total)
+	_, err = stockContract.GetUserValuation(transactionContext, "Alice", "EUR")
+	require.EqualError(t, err, "no FX rate for EUR")
+
+	withAmount(chaincodeStub, 600000)
+	balance, err = stockContract.Withdraw(transactionContext, "Alice", "HKD", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	require.Zero(t, balance)
+	require.Empty(t, readUser(t, state, "Alice").Balances)
+}
+
+func TestCostBasisAndPnL(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 先进先出：初始的 100 股（成本 180.50）先卖出，再卖出 tx002 买入批次中的 20 股
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.SetStockPrice(transactionContext, "TSLA", 19000)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 2)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 50, 950000, ""))
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 120, "")
+	require.NoError(t, err)
+	trades, err := stockContract.GetUserTrades(transactionContext, "Alice", "", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(2280000-1805000-380000), trades[1].Realized)
+
+	setTx(chaincodeStub, 4)
+	_, err = stockContract.SetStockPrice(transactionContext, "TSLA", 19500)
+	require.NoError(t, err)
+	pnl, err := stockContract.GetUserPnL(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.CostBasisFIFO, pnl.Method)
+	require.Len(t, pnl.Positions, 2)
+	require.Equal(t, "AAPL", pnl.Positions[0].Symbol)
+	require.Equal(t, chaincode.PositionPnL{
+		Symbol: "TSLA", Currency: "USD", Quantity: 30, Price: 19500,
+		Cost: 570000, Value: 585000, Realized: 95000, Unrealized: 15000,
+	}, pnl.Positions[1])
+
+	// 转让时成本随股票转入接收方，撮合成交时卖方结转成本
+	setTx(chaincodeStub, 5)
+	require.NoError(t, stockContract.TransferShares(transactionContext, "Alice", "David", "TSLA", 10))
+	setTx(chaincodeStub, 6)
+	_, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 5, 19500, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 7)
+	_, err = stockContract.PlaceOrder(transactionContext, "David", "TSLA", chaincode.SideBuy, 5, 19500, "")
+	require.NoError(t, err)
+	pnl, err = stockContract.GetUserPnL(transactionContext, "David")
+	require.NoError(t, err)
+	require.Equal(t, "TSLA", pnl.Positions[2].Symbol)
+	require.Equal(t, 15, pnl.Positions[2].Quantity)
+	require.Equal(t, int64(190000+97500), pnl.Positions[2].Cost)
+	pnl, err = stockContract.GetUserPnL(transactionContext, "Charlie")
+	require.NoError(t, err)
+	require.Equal(t, int64(5*19500-5*18050), pnl.Positions[1].Realized)
+
+	// 移动平均：300 股平均成本 86.80，卖出 150 股
+	err = stockContract.SetCostBasisMethod(transactionContext, "Bob", "lifo")
+	require.EqualError(t, err, "invalid cost basis method lifo, must be fifo or average")
+	require.NoError(t, stockContract.SetCostBasisMethod(transactionContext, "Bob", chaincode.CostBasisAverage))
+	setTx(chaincodeStub, 8)
+	_, err = stockContract.SetStockPrice(transactionContext, "BABA", 9000)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 9)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Bob", "BABA", 100, 900000, ""))
+	setTx(chaincodeStub, 10)
+	_, err = stockContract.SellStock(transactionContext, "Bob", "BABA", 150, "")
+	require.NoError(t, err)
+
+	// 没有成本记录的持仓不计入盈亏
+	delete(state, compositeKey(t, "costBasis", "Eve", "BABA"))
+
+	// 1:7 合股：Bob 的 150 股变为 21 股，3/7 股零股折现，结转对应成本
+	setTx(chaincodeStub, 11)
+	_, err = stockContract.SplitStock(transactionContext, "BABA", 1, 7)
+	require.NoError(t, err)
+	pnl, err = stockContract.GetUserPnL(transactionContext, "Bob")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.CostBasisAverage, pnl.Method)
+	require.Equal(t, chaincode.PositionPnL{
+		Symbol: "BABA", Currency: "USD", Quantity: 21, Price: 63000,
+		Cost: 2604000 - 1302000 - 26040, Value: 21 * 63000, Realized: 48000 + 27000 - 26040, Unrealized: 21*63000 - 1275960,
+	}, pnl.Positions[0])
+	pnl, err = stockContract.GetUserPnL(transactionContext, "Eve")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.PositionPnL{Symbol: "BABA", Currency: "USD", Quantity: 25, Untracked: 25, Price: 63000}, pnl.Positions[1])
+}
+
+func TestPriceBars(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	at := func(n int, hour int, minute int, second int) {
+		chaincodeStub.GetTxIDReturns(fmt.Sprintf("tx%03d", n))
+		chaincodeStub.GetTxTimestampReturns(timestamppb.New(time.Date(2024, 1, 1, hour, minute, second, 0, time.UTC)), nil)
+	}
+
+	// 调价、直接买入和撮合成交都写入价格记录，成交计入成交量
+	at(1, 0, 0, 30)
+	_, err := stockContract.SetStockPrice(transactionContext, "TSLA", 18500)
+	require.NoError(t, err)
+	at(2, 0, 1, 10)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 185000, ""))
+	at(3, 0, 1, 20)
+	_, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 5, 18300, "")
+	require.NoError(t, err)
+	at(4, 0, 1, 40)
+	_, err = stockContract.PlaceOrder(transactionContext, "Bob", "TSLA", chaincode.SideBuy, 5, 18400, "")
+	require.NoError(t, err)
+	at(5, 1, 0, 5)
+	_, err = stockContract.SetStockPrice(transactionContext, "TSLA", 18000)
+	require.NoError(t, err)
+
+	bars, err := stockContract.GetPriceBars(transactionContext, "TSLA", "1m", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.PriceBar{
+		{Start: "2024-01-01T00:00:00Z", Open: 18050, High: 18500, Low: 18050, Close: 18500, Ticks: 2},
+		{Start: "2024-01-01T00:01:00Z", Open: 18500, High: 18500, Low: 18300, Close: 18300, Volume: 15, Ticks: 2},
+		{Start: "2024-01-01T01:00:00Z", Open: 18000, High: 18000, Low: 18000, Close: 18000, Ticks: 1},
+	}, bars)
+
+	bars, err = stockContract.GetPriceBars(transactionContext, "TSLA", "1h", "", "")
+	require.NoError(t, err)
+	require.Len(t, bars, 2)
+	require.Equal(t, chaincode.PriceBar{Start: "2024-01-01T00:00:00Z", Open: 18050, High: 18500, Low: 18050, Close: 18300, Volume: 15, Ticks: 4}, bars[0])
+
+	bars, err = stockContract.GetPriceBars(transactionContext, "TSLA", "1d", "2024-01-01T00:01:00Z", "2024-01-01T01:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.PriceBar{{Start: "2024-01-01T00:00:00Z", Open: 18500, High: 18500, Low: 18300, Close: 18300, Volume: 15, Ticks: 2}}, bars)
+
+	bars, err = stockContract.GetPriceBars(transactionContext, "AAPL", "1d", "", "")
+	require.NoError(t, err)
+	require.Len(t, bars, 1)
+	_, err = stockContract.GetPriceBars(transactionContext, "TSLA", "5m", "", "")
+	require.EqualError(t, err, "invalid interval 5m, must be 1m, 1h or 1d")
+	_, err = stockContract.GetPriceBars(transactionContext, "NOPE", "1d", "", "")
+	require.EqualError(t, err, "stock NOPE not found")
+}
+
+func TestLedgerInvariantsAndAudit(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+	require.Equal(t, 1000175, readStock(t, state, "TSLA").Supply)
+
+	// 数量必须为正，付款必须与应付金额一致，余额和流通池不足时拒绝
+	require.EqualError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 0, 0, ""), "amount must be positive")
+	require.EqualError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", -1, 0, ""), "amount must be positive")
+	_, err := stockContract.SellStock(transactionContext, "Alice", "TSLA", -5, "")
+	require.EqualError(t, err, "amount must be positive")
+	require.EqualError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18051, ""), "overpayment rejected. Required: 180.50, payment: 180.51")
+	require.EqualError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 300, 5415000, ""), "insufficient balance. Required: 54150.00")
+	require.NoError(t, stockContract.ListStock(transactionContext, "XYZ", 100, 10, "USD"))
+	require.EqualError(t, stockContract.BuyStock(transactionContext, "Alice", "XYZ", 11, 1100, ""), "insufficient float of XYZ. Available: 10")
+	require.Equal(t, int64(5000000), readUser(t, state, "Alice").Balance)
+
+	// 买入、挂卖单和拆股后股份总量仍与发行总量相符
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "XYZ", 10, 1000, ""))
+	_, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 5, 19000, "")
+	require.NoError(t, err)
+	_, err = stockContract.SplitStock(transactionContext, "AAPL", 3, 2)
+	require.NoError(t, err)
+
+	report, err := stockContract.AuditLedger(transactionContext)
+	require.NoError(t, err)
+	require.Empty(t, report.Violations)
+	require.Equal(t, 5, report.Users)
+	require.Len(t, report.Stocks, 6)
+	require.Equal(t, chaincode.SupplyAudit{Symbol: "TSLA", Supply: 1000175, Float: 1000000, Held: 170, Escrowed: 5, Total: 1000175, Balanced: true}, report.Stocks[4])
+	require.Equal(t, chaincode.SupplyAudit{Symbol: "XYZ", Supply: 10, Float: 0, Held: 10, Total: 10, Balanced: true}, report.Stocks[5])
+	require.Equal(t, 2250255, report.Stocks[1].Supply)
+
+	// 绕过合约篡改持仓，或缺少发行总量的旧记录，均被报告
+	holdingJSON, err := json.Marshal(chaincode.Holding{Username: "Bob", Symbol: "TSLA", Quantity: 7})
+	require.NoError(t, err)
+	state[compositeKey(t, "holding", "Bob", "TSLA")] = holdingJSON
+	legacyJSON, err := json.Marshal(chaincode.StockToken{Symbol: "OLD", Price: 100, Quantity: 50})
+	require.NoError(t, err)
+	state[compositeKey(t, "stock", "OLD")] = legacyJSON
+
+	report, err = stockContract.AuditLedger(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"stock OLD has no recorded supply, found 50 shares",
+		"stock TSLA supply mismatch: issued 1000175, found 1000182 (float 1000000, held 177, escrowed 5)",
+	}, report.Violations)
+}
+
+func TestClientOrderIDsAreIdempotent(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 超时重试的买入只执行一次
+	setTx(chaincodeStub, 1)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, "buy-1"))
+	setTx(chaincodeStub, 2)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 10, 180500, "buy-1"))
+	alice := readUser(t, state, "Alice")
+	require.Equal(t, int64(5000000-180500), alice.Balance)
+	require.Equal(t, 110, alice.Stocks["TSLA"])
+
+	record, err := stockContract.GetClientOrder(transactionContext, "Alice", "buy-1")
+	require.NoError(t, err)
+	require.Equal(t, "tx001", record.TxID)
+	require.Equal(t, "BuyStock", record.Function)
+
+	// 同一订单号用于不同请求时拒绝，其他用户可以使用相同的订单号
+	err = stockContract.BuyStock(transactionContext, "Alice", "TSLA", 11, 198550, "buy-1")
+	require.EqualError(t, err, "client order ID buy-1 was already used by transaction tx001 for a different request")
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 10, "buy-1")
+	require.EqualError(t, err, "client order ID buy-1 was already used by transaction tx001 for a different request")
+	setTx(chaincodeStub, 3)
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Bob", "TSLA", 1, 18050, "buy-1"))
+	err = stockContract.BuyStock(transactionContext, "Bob", "TSLA", 1, 18050, strings.Repeat("x", 65))
+	require.EqualError(t, err, "client order ID must be at most 64 characters")
+
+	// 重复卖出返回原交易的所得，股价变化后也不再执行
+	setTx(chaincodeStub, 4)
+	revenue, err := stockContract.SellStock(transactionContext, "Alice", "TSLA", 5, "sell-1")
+	require.NoError(t, err)
+	_, err = stockContract.SetStockPrice(transactionContext, "TSLA", 18100)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 5)
+	replayed, err := stockContract.SellStock(transactionContext, "Alice", "TSLA", 5, "sell-1")
+	require.NoError(t, err)
+	require.Equal(t, int64(90250), revenue)
+	require.Equal(t, revenue, replayed)
+	require.Equal(t, 105, readUser(t, state, "Alice").Stocks["TSLA"])
+
+	// 重复下单返回原订单，账本上只有一笔挂单
+	setTx(chaincodeStub, 6)
+	placed, err := stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 10, 19000, "ord-1")
+	require.NoError(t, err)
+	require.Equal(t, "ord-1", placed.Order.ClientOrderID)
+	setTx(chaincodeStub, 7)
+	again, err := stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 10, 19000, "ord-1")
+	require.NoError(t, err)
+	require.Equal(t, placed, again)
+	book, err := stockContract.GetOrderBook(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, book.Asks, 1)
+	require.Equal(t, 65, readUser(t, state, "Charlie").Stocks["TSLA"])
+
+	_, err = stockContract.GetClientOrder(transactionContext, "Charlie", "ord-2")
+	require.EqualError(t, err, "client order ord-2 of user Charlie not found")
+}
+
+func TestRichQueries(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 持有 TSLA 超过 80 股的用户
+	holdings, err := stockContract.QueryHoldings(transactionContext, `{"symbol": "TSLA", "quantity": {"$gt": 80}}`)
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Holding{{DocType: "holding", Username: "Alice", Symbol: "TSLA", Quantity: 100}}, holdings)
+
+	page, err := stockContract.QueryHoldingsPage(transactionContext, `{"symbol": {"$in": ["TSLA", "AAPL"]}}`, 2, "")
+	require.NoError(t, err)
+	require.Len(t, page.Holdings, 2)
+	require.Equal(t, "Alice", page.Holdings[1].Username)
+	require.NotEmpty(t, page.Bookmark)
+	page, err = stockContract.QueryHoldingsPage(transactionContext, `{"symbol": {"$in": ["TSLA", "AAPL"]}}`, 2, page.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Charlie", "David"}, []string{page.Holdings[0].Username, page.Holdings[1].Username})
+	require.Empty(t, page.Bookmark)
+
+	stocks, err := stockContract.QueryStocks(transactionContext, `{"currency": "HKD", "status": "active"}`)
+	require.NoError(t, err)
+	require.Len(t, stocks, 1)
+	require.Equal(t, "0700.HK", stocks[0].Symbol)
+	stockPage, err := stockContract.QueryStocksPage(transactionContext, "", 10, "")
+	require.NoError(t, err)
+	require.Len(t, stockPage.Stocks, 5)
+	require.Empty(t, stockPage.Bookmark)
+
+	// USD 余额低于 55000.00 的用户，按用户名排序
+	balances, err := stockContract.QueryUserBalances(transactionContext, `{"balanceCents": {"$lt": 5500000}}`)
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.UserBalance{
+		{Name: "Alice", Balance: 5000000, Balances: map[string]int64{}},
+		{Name: "David", Balance: 4500000, Balances: map[string]int64{}},
+	}, balances)
+
+	var names []string
+	bookmark := ""
+	for {
+		balancePage, err := stockContract.QueryUserBalancesPage(transactionContext, "", 2, bookmark)
+		require.NoError(t, err)
+		for _, user := range balancePage.Users {
+			names = append(names, user.Name)
+		}
+		if bookmark = balancePage.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, []string{"Alice", "Bob", "Charlie", "David", "Eve"}, names)
+
+	_, err = stockContract.QueryHoldings(transactionContext, `{"symbol": {"$regex": "^T"}}`)
+	require.EqualError(t, err, "unsupported selector operator $regex")
+	_, err = stockContract.QueryStocks(transactionContext, `["TSLA"]`)
+	require.ErrorContains(t, err, "selector must be a JSON object")
+	_, err = stockContract.QueryStocksPage(transactionContext, "", 0, "")
+	require.EqualError(t, err, "page size must be between 1 and 200")
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err = stockContract.QueryUserBalances(transactionContext, "")
+	require.Error(t, err)
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+
+	// 升级前的记录没有 docType，迁移后才能被查询到
+	legacyJSON, err := json.Marshal(map[string]interface{}{"symbol": "OLD", "priceCents": 100, "quantity": 50, "supply": 50})
+	require.NoError(t, err)
+	state[compositeKey(t, "stock", "OLD")] = legacyJSON
+	stocks, err = stockContract.QueryStocks(transactionContext, `{"symbol": "OLD"}`)
+	require.NoError(t, err)
+	require.Empty(t, stocks)
+
+	migrated, err := stockContract.MigrateQueryFields(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 6, migrated)
+	stocks, err = stockContract.QueryStocks(transactionContext, `{"symbol": "OLD"}`)
+	require.NoError(t, err)
+	require.Len(t, stocks, 1)
+}
+
+func TestShareholderRegistry(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 用户持仓按股票代码排列，股东名册按用户名排列
+	positions, err := stockContract.GetUserStocks(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Position{
+		{Username: "Alice", Symbol: "AAPL", Quantity: 50},
+		{Username: "Alice", Symbol: "TSLA", Quantity: 100},
+	}, positions)
+	holders, err := stockContract.GetStockHolders(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Position{
+		{Username: "Alice", Symbol: "TSLA", Quantity: 100},
+		{Username: "Charlie", Symbol: "TSLA", Quantity: 75},
+	}, holders)
+	_, err = stockContract.GetUserStocks(transactionContext, "Mallory")
+	require.EqualError(t, err, "user Mallory not found")
+	_, err = stockContract.GetStockHolders(transactionContext, "NOPE")
+	require.Error(t, err)
+
+	// 买入、清仓卖出和转让后索引随持仓更新
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Bob", "TSLA", 1, 18050, ""))
+	_, err = stockContract.SellStock(transactionContext, "Alice", "TSLA", 100, "")
+	require.NoError(t, err)
+	require.NoError(t, stockContract.TransferShares(transactionContext, "Charlie", "David", "TSLA", 75))
+	holders, err = stockContract.GetStockHolders(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Position{
+		{Username: "Bob", Symbol: "TSLA", Quantity: 1},
+		{Username: "David", Symbol: "TSLA", Quantity: 75},
+	}, holders)
+	positions, err = stockContract.GetUserStocks(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, []chaincode.Position{{Username: "Alice", Symbol: "AAPL", Quantity: 50}}, positions)
+
+	// 升级前的账本没有索引，迁移后股东名册完整
+	for key := range state {
+		if strings.HasPrefix(key, compositeKey(t, "holder")) {
+			delete(state, key)
+		}
+	}
+	holders, err = stockContract.GetStockHolders(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Empty(t, holders)
+	migrated, err := stockContract.MigrateHolderIndex(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 10, migrated)
+	holders, err = stockContract.GetStockHolders(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, holders, 2)
+}
+
+func TestSubmitBasket(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 先卖后买，卖出所得抵扣买入支出
+	setTx(chaincodeStub, 1)
+	legs := `[{"symbol": "AAPL", "side": "sell", "quantity": 50, "limitPriceCents": 14900},
+		{"symbol": "BABA", "side": "buy", "quantity": 100, "limitPriceCents": 8600},
+		{"symbol": "TSLA", "side": "buy", "quantity": 10, "limitPriceCents": 18050}]`
+	result, err := stockContract.SubmitBasket(transactionContext, "Alice", legs, "basket-1")
+	require.NoError(t, err)
+	require.Len(t, result.Legs, 3)
+	require.Equal(t, "AAPL", result.Legs[0].Symbol)
+	require.Equal(t, int64(750000), result.Legs[0].Amount)
+	require.Equal(t, chaincode.LegResult{Symbol: "TSLA", Side: chaincode.SideBuy, Quantity: 10, Price: 18050, Currency: "USD", Amount: 180500}, result.Legs[2])
+	require.Equal(t, map[string]int64{"USD": -282500}, result.Net)
+	alice := readUser(t, state, "Alice")
+	require.Equal(t, int64(5000000-282500), alice.Balance)
+	require.Equal(t, 100, alice.Stocks["BABA"])
+	require.Equal(t, 110, alice.Stocks["TSLA"])
+	require.Zero(t, alice.Stocks["AAPL"])
+	require.Equal(t, 1500050, readStock(t, state, "AAPL").Quantity)
+
+	// 重复提交返回原结果，不再执行
+	setTx(chaincodeStub, 2)
+	replayed, err := stockContract.SubmitBasket(transactionContext, "Alice", strings.Join(strings.Fields(legs), ""), "basket-1")
+	require.NoError(t, err)
+	require.Equal(t, result, replayed)
+	require.Equal(t, int64(5000000-282500), readUser(t, state, "Alice").Balance)
+
+	// 任一股票不满足条件时整个篮子不成交
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "META", "side": "buy", "quantity": 1, "limitPriceCents": 30000},
+		{"symbol": "TSLA", "side": "buy", "quantity": 1, "limitPriceCents": 18000}]`, "")
+	require.EqualError(t, err, "leg 2: price of TSLA is 180.50, above the limit of 180.00")
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "META", "side": "buy", "quantity": 1, "limitPriceCents": 30000},
+		{"symbol": "BABA", "side": "sell", "quantity": 201, "limitPriceCents": 8000}]`, "")
+	require.EqualError(t, err, "leg 2: insufficient shares of BABA to sell")
+	bob := readUser(t, state, "Bob")
+	require.Equal(t, int64(7500000), bob.Balance)
+	require.Equal(t, 80, bob.Stocks["META"])
+
+	// 现金按币种合并核对
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "TSLA", "side": "buy", "quantity": 400, "limitPriceCents": 18050},
+		{"symbol": "META", "side": "buy", "quantity": 10, "limitPriceCents": 28070}]`, "")
+	require.EqualError(t, err, "insufficient USD balance for basket. Required: 75007.00, available: 75000.00")
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "TSLA", "side": "buy", "quantity": 400, "limitPriceCents": 18050},
+		{"symbol": "META", "side": "buy", "quantity": 10, "limitPriceCents": 28070},
+		{"symbol": "BABA", "side": "sell", "quantity": 1, "limitPriceCents": 8520}]`, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(7820), readUser(t, state, "Bob").Balance)
+
+	// 篮子格式校验
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[]`, "")
+	require.EqualError(t, err, "basket must have between 1 and 20 legs")
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "TSLA", "side": "buy", "quantity": 1, "limitPriceCents": 18050},
+		{"symbol": "TSLA", "side": "sell", "quantity": 1, "limitPriceCents": 18050}]`, "")
+	require.EqualError(t, err, "leg 2: stock TSLA appears more than once in the basket")
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "TSLA", "side": "hold", "quantity": 1, "limitPriceCents": 18050}]`, "")
+	require.EqualError(t, err, "leg 1: invalid side hold, must be buy or sell")
+	_, err = stockContract.SubmitBasket(transactionContext, "Bob", `[{"symbol": "TSLA", "side": "buy", "quantity": 0, "limitPriceCents": 18050}]`, "")
+	require.EqualError(t, err, "leg 1: quantity must be positive")
+}
+
+func TestInitLedgerOnlyOnEmptyLedger(t *testing.T) {
+	transactionContext, _, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+
+	// 只有管理员可以初始化
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	require.EqualError(t, stockContract.InitLedger(transactionContext), "caller is not an admin")
+	require.Empty(t, state)
+
+	// 已初始化的账本不能再次重置，账户绑定和余额保持不变
+	transactionContext.GetClientIdentityReturns(adminIdentity)
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+	require.NoError(t, stockContract.BindAccount(transactionContext, "Alice", "Org1MSP", "user1"))
+	require.NoError(t, stockContract.BuyStock(transactionContext, "Alice", "TSLA", 1, 18050, ""))
+	require.EqualError(t, stockContract.InitLedger(transactionContext), "ledger is already initialized")
+	alice := readUser(t, state, "Alice")
+	require.Equal(t, "Org1MSP", alice.OwnerMSP)
+	require.Equal(t, int64(5000000-18050), alice.Balance)
+
+	// 只有配置记录的账本同样视为已初始化
+	transactionContext, _, _ = newStockLedger()
+	require.NoError(t, stockContract.SetCircuitBreaker(transactionContext, 500))
+	require.EqualError(t, stockContract.InitLedger(transactionContext), "ledger is already initialized")
+}
+
+func TestBuyerFeesAreCappedAtReservation(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+	require.NoError(t, stockContract.SetFeeSchedule(transactionContext, "Eve", 0, 0, 500))
+
+	// 买单挂单时只预留一笔最低收费，之后分两笔成交
+	setTx(chaincodeStub, 1)
+	result, err := stockContract.PlaceOrder(transactionContext, "Bob", "TSLA", chaincode.SideBuy, 3, 18000, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(500), result.Order.FeeReserved)
+	require.Equal(t, int64(7500000-3*18000-500), readUser(t, state, "Bob").Balance)
+
+	setTx(chaincodeStub, 2)
+	result, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 1, 18000, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(500), result.Fills[0].BuyerFee)
+	require.Equal(t, int64(500), result.Fills[0].SellerFee)
+
+	// 预留已用完，后续成交不再从买方余额中扣手续费，卖方照常付费
+	setTx(chaincodeStub, 3)
+	result, err = stockContract.PlaceOrder(transactionContext, "Charlie", "TSLA", chaincode.SideSell, 2, 18000, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), result.Fills[0].BuyerFee)
+	require.Equal(t, int64(500), result.Fills[0].SellerFee)
+
+	bob := readUser(t, state, "Bob")
+	require.Equal(t, int64(7500000-3*18000-500), bob.Balance)
+	require.Equal(t, 3, bob.Stocks["TSLA"])
+	order, err := stockContract.GetOrder(transactionContext, "tx001")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.OrderFilled, order.Status)
+	require.Equal(t, int64(0), order.FeeReserved)
+	require.Equal(t, int64(5500000+500+500+500), readUser(t, state, "Eve").Balance)
+}
+
+func TestPnLWithEscrowAndAccountClosure(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 挂卖单冻结的股份加回后再与批次比较，没有成本记录的股份不会被低估
+	delete(state, compositeKey(t, "costBasis", "Eve", "BABA"))
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.PlaceOrder(transactionContext, "Eve", "BABA", chaincode.SideSell, 100, 9000, "")
+	require.NoError(t, err)
+	pnl, err := stockContract.GetUserPnL(transactionContext, "Eve")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.PositionPnL{Symbol: "BABA", Currency: "USD", Quantity: 180, Untracked: 180, Price: 8520}, pnl.Positions[1])
+
+	setTx(chaincodeStub, 2)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideSell, 40, 20000, "")
+	require.NoError(t, err)
+	pnl, err = stockContract.GetUserPnL(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, 100, pnl.Positions[1].Quantity)
+	require.Zero(t, pnl.Positions[1].Untracked)
+
+	// 销户清仓时先结转成本，已实现盈亏记入清仓的交易记录
+	setTx(chaincodeStub, 3)
+	_, err = stockContract.SetStockPrice(transactionContext, "TSLA", 19000)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 4)
+	require.NoError(t, stockContract.CloseAccount(transactionContext, "Alice", "Bob"))
+	require.Empty(t, scanPrefix(state, compositeKey(t, "costBasis", "Alice")))
+
+	realized := map[string]int64{}
+	for _, kv := range scanPrefix(state, compositeKey(t, "trade", "Alice")) {
+		var trade chaincode.Trade
+		require.NoError(t, json.Unmarshal(kv.Value, &trade))
+		if trade.TxID == "tx004" && trade.Side == chaincode.TradeSell {
+			realized[trade.Symbol] = trade.Realized
+		}
+	}
+	require.Equal(t, map[string]int64{"AAPL": 0, "TSLA": 100 * (19000 - 18050)}, realized)
+}
+
+func TestHistoryIncludesLegacyKeys(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newStockLedger()
+	require.NoError(t, chaincodeStub.PutState("stock_TSLA", []byte(`{"symbol":"TSLA","price":180.5,"quantity":10}`)))
+	require.NoError(t, chaincodeStub.PutState("user_Alice", []byte(`{"name":"Alice","stocks":{"TSLA":5},"balance":1.25,"history":["Initial account setup"]}`)))
+
+	stockContract := chaincode.StockSmartContract{}
+	setTx(chaincodeStub, 1)
+	_, err := stockContract.MigrateStorageLayout(transactionContext)
+	require.NoError(t, err)
+
+	// 迁移前旧键下的版本和迁移时的删除一并返回，旧版本的浮点余额转换为分
+	versions, err := stockContract.GetUserHistory(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	require.Equal(t, "tx000", versions[0].TxID)
+	require.Equal(t, int64(125), versions[0].Value.Balance)
+	require.True(t, versions[1].IsDelete)
+	require.Equal(t, "tx001", versions[1].TxID)
+	require.False(t, versions[2].IsDelete)
+	require.Equal(t, "Alice", versions[2].Value.Name)
+
+	stockVersions, err := stockContract.GetStockHistory(transactionContext, "TSLA")
+	require.NoError(t, err)
+	require.Len(t, stockVersions, 3)
+	require.Equal(t, int64(18050), stockVersions[0].Value.Price)
+	require.True(t, stockVersions[1].IsDelete)
+	require.Equal(t, 10, stockVersions[2].Value.Quantity)
+}
+
+func TestCashEntriesExplainBalance(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	setTx(chaincodeStub, 1)
+	withAccount(chaincodeStub, 100000, "Frank Li", "frank@example.com")
+	require.NoError(t, stockContract.CreateUser(transactionContext, "Frank"))
+	setTx(chaincodeStub, 2)
+	withAmount(chaincodeStub, 50000)
+	_, err := stockContract.Deposit(transactionContext, "Frank", "", chaincode.ReasonBankTransfer)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 3)
+	withAmount(chaincodeStub, 20000)
+	_, err = stockContract.Withdraw(transactionContext, "Frank", "", chaincode.ReasonFee)
+	require.NoError(t, err)
+	setTx(chaincodeStub, 4)
+	withAmount(chaincodeStub, 30000)
+	require.NoError(t, stockContract.TransferCash(transactionContext, "Frank", "Bob", ""))
+
+	// 现金流水的金额之和等于余额
+	entries, err := stockContract.GetUserCashEntries(transactionContext, "Frank")
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	kinds := []string{}
+	signed := map[string]int64{
+		chaincode.CashOpening: 1, chaincode.CashDeposit: 1, chaincode.CashTransferIn: 1,
+		chaincode.CashWithdrawal: -1, chaincode.CashTransferOut: -1,
+	}
+	var total int64
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+		total += signed[entry.Kind] * entry.Amount
+	}
+	require.Equal(t, []string{chaincode.CashOpening, chaincode.CashDeposit, chaincode.CashWithdrawal, chaincode.CashTransferOut}, kinds)
+	require.Equal(t, readUser(t, state, "Frank").Balance, total)
+	require.Equal(t, chaincode.ReasonBankTransfer, entries[1].Reason)
+	require.Equal(t, "Bob", entries[3].Counterparty)
+
+	// 公共账本上的流水不含金额，金额在私有数据集合中，查询结果带有其哈希
+	key := compositeKey(t, "cashEntry", "Frank", fmt.Sprintf("%020d", time.Date(2024, 1, 1, 0, 0, 4, 0, time.UTC).UnixNano()), entries[3].ID)
+	var public map[string]interface{}
+	require.NoError(t, json.Unmarshal(state[key], &public))
+	require.Equal(t, float64(0), public["amountCents"])
+	expected := sha256.Sum256(state[privateKey(chaincode.UserPrivateCollection, key)])
+	require.Equal(t, fmt.Sprintf("%x", expected), entries[3].AmountHash)
+
+	versions, err := stockContract.GetUserHistory(transactionContext, "Frank")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	for i, version := range versions {
+		require.Equal(t, []string{entries[i].ID}, version.CashEntryIDs)
+	}
+
+	// 收款方有对应的转入流水
+	bobEntries, err := stockContract.GetUserCashEntries(transactionContext, "Bob")
+	require.NoError(t, err)
+	require.Len(t, bobEntries, 1)
+	require.Equal(t, chaincode.CashTransferIn, bobEntries[0].Kind)
+	require.Equal(t, int64(30000), bobEntries[0].Amount)
+
+	// 账户绑定到非集合成员组织的身份时，本人只能看到哈希；其他客户端不能查询
+	require.NoError(t, stockContract.BindAccount(transactionContext, "Frank", "Org2MSP", "frank"))
+	transactionContext.GetClientIdentityReturns(&fakeIdentity{mspID: "Org2MSP", id: "frank"})
+	entries, err = stockContract.GetUserCashEntries(transactionContext, "Frank")
+	require.NoError(t, err)
+	require.Zero(t, entries[3].Amount)
+	require.Equal(t, fmt.Sprintf("%x", expected), entries[3].AmountHash)
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	_, err = stockContract.GetUserCashEntries(transactionContext, "Frank")
+	require.EqualError(t, err, "caller is not the owner of account Frank")
+}
+
+func TestCircuitBreakerReferenceRollsDaily(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	at := func(n int, day int, hour int) {
+		chaincodeStub.GetTxIDReturns(fmt.Sprintf("tx%03d", n))
+		chaincodeStub.GetTxTimestampReturns(timestamppb.New(time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC)), nil)
+	}
+
+	// 同一交易日内参考价不变，以当日第一次调价前的价格为准
+	at(1, 1, 9)
+	stock, err := stockContract.SetStockPrice(transactionContext, "TSLA", 19500)
+	require.NoError(t, err)
+	require.Equal(t, int64(18050), stock.ReferencePrice)
+	require.Equal(t, "2024-01-01", stock.ReferenceDate)
+	at(2, 1, 15)
+	stock, err = stockContract.SetStockPrice(transactionContext, "TSLA", 19800)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockActive, stock.Status)
+	require.Equal(t, int64(18050), stock.ReferencePrice)
+
+	// 次日参考价滚动为上一交易日最后的股价，累计涨幅不会在第二天触发熔断
+	at(3, 2, 9)
+	stock, err = stockContract.SetStockPrice(transactionContext, "TSLA", 21500)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockActive, stock.Status)
+	require.Equal(t, int64(19800), stock.ReferencePrice)
+	require.Equal(t, "2024-01-02", stock.ReferenceDate)
+	at(4, 2, 10)
+	stock, err = stockContract.SetStockPrice(transactionContext, "TSLA", 17700)
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StockHalted, stock.Status)
+
+	// 复牌和上市时以当时的价格作为当日参考价
+	at(5, 3, 9)
+	require.NoError(t, stockContract.ResumeStock(transactionContext, "TSLA"))
+	tsla := readStock(t, state, "TSLA")
+	require.Equal(t, int64(17700), tsla.ReferencePrice)
+	require.Equal(t, "2024-01-03", tsla.ReferenceDate)
+	require.NoError(t, stockContract.ListStock(transactionContext, "NVDA", 50000, 1000, "USD"))
+	require.Equal(t, "2024-01-03", readStock(t, state, "NVDA").ReferenceDate)
+}
+
+func TestValuationIncludesOrderEscrow(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+	require.NoError(t, stockContract.SetFeeSchedule(transactionContext, "Eve", 0, 0, 500))
+
+	before, err := stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, int64(5000000+100*18050+50*15000), before)
+
+	// 挂单冻结的现金（含预留手续费）和股票仍计入总资产
+	setTx(chaincodeStub, 1)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideBuy, 10, 17000, "")
+	require.NoError(t, err)
+	setTx(chaincodeStub, 2)
+	_, err = stockContract.PlaceOrder(transactionContext, "Alice", "AAPL", chaincode.SideSell, 20, 20000, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(5000000-170000-500), readUser(t, state, "Alice").Balance)
+
+	total, err := stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.NoError(t, err)
+	require.Equal(t, before, total)
+	valuation, err := stockContract.GetUserValuation(transactionContext, "Alice", "")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.ValuationLine{Currency: "USD", Value: 5000000, Converted: 5000000}, valuation.Lines[0])
+	require.Equal(t, chaincode.ValuationLine{Symbol: "AAPL", Quantity: 50, Currency: "USD", Value: 750000, Converted: 750000}, valuation.Lines[1])
+
+	// 股票记录读取失败时返回错误，不再跳过
+	delete(state, compositeKey(t, "stock", "TSLA"))
+	_, err = stockContract.GetUserTotalValue(transactionContext, "Alice")
+	require.Error(t, err)
+}
+
+func TestCloseAccountRequiresTradableHoldings(t *testing.T) {
+	transactionContext, chaincodeStub, state := newStockLedger()
+	stockContract := chaincode.StockSmartContract{}
+	require.NoError(t, stockContract.InitLedger(transactionContext))
+
+	// 挂单写入用户挂单索引，撤单后删除
+	setTx(chaincodeStub, 1)
+	order, err := stockContract.PlaceOrder(transactionContext, "Alice", "TSLA", chaincode.SideSell, 10, 99999, "")
+	require.NoError(t, err)
+	indexKey := compositeKey(t, "userOrder", "Alice", order.Order.ID)
+	require.Contains(t, state, indexKey)
+	delete(state, indexKey)
+	migrated, err := stockContract.MigrateOrderIndex(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 1, migrated)
+	require.Contains(t, state, indexKey)
+	require.NoError(t, stockContract.CancelOrder(transactionContext, "Alice", order.Order.ID))
+	require.NotContains(t, state, indexKey)
+
+	// 停牌或退市的股票不能按最后价格卖回发行方
+	require.NoError(t, stockContract.HaltStock(transactionContext, "TSLA", chaincode.HaltNewsPending))
+	setTx(chaincodeStub, 2)
+	err = stockContract.CloseAccount(transactionContext, "Alice", "Bob")
+	require.EqualError(t, err, "cannot liquidate TSLA: stock TSLA is halted (news_pending)")
+	require.NoError(t, stockContract.ResumeStock(transactionContext, "TSLA"))
+	require.NoError(t, stockContract.DelistStock(transactionContext, "AAPL"))
+	setTx(chaincodeStub, 3)
+	err = stockContract.CloseAccount(transactionContext, "Alice", "Bob")
+	require.EqualError(t, err, "cannot liquidate AAPL: stock AAPL is delisted")
+}
@@ -0,0 +1,151 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// 交易记录方向
+const (
+	TradeBuy         = "buy"
+	TradeSell        = "sell"
+	TradeTransferIn  = "transfer_in"
+	TradeTransferOut = "transfer_out"
+)
+
+// Trade 表示某个用户的一条买卖或转让记录，每条记录单独存储在 trade 类型的键下，
+// 键为 [username, 交易时间纳秒, 记录编号]，按用户前缀查询即按时间先后排列。
+type Trade struct {
+	ID           string `json:"id"`            // 记录编号：txID_序号
+	TxID         string `json:"txId"`          // 产生该记录的交易
+	Username     string `json:"username"`      // 记录所属用户
+	Side         string `json:"side"`          // buy / sell / transfer_in / transfer_out
+	Symbol       string `json:"symbol"`        // 股票代码，现金转账为空
+	Quantity     int    `json:"quantity"`      // 股票数量，现金转账为 0
+	Price        int64  `json:"priceCents"`    // 成交价（分），转让为 0
+	Currency     string `json:"currency"`      // 成交价、金额和手续费的币种，股票转让为空
+	Amount       int64  `json:"amountCents"`   // 成交金额（分），转让和现金转账为 0（转账金额记入双方的现金流水，见 CashEntry）
+	Fee          int64  `json:"feeCents"`      // 本方支付的手续费（分），转让为 0
+	Realized     int64  `json:"realizedCents"` // 卖出的已实现盈亏（分），按成本记录结转，其他记录为 0
+	Counterparty string `json:"counterparty"`  // 对手方用户，直接与发行方买卖时为空
+	Timestamp    string `json:"timestamp"`     // 交易时间（RFC3339）
+}
+
+func tradeKey(ctx contractapi.TransactionContextInterface, trade *Trade, nanos int64) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(tradeObjectType, []string{trade.Username, fmt.Sprintf("%020d", nanos), trade.ID})
+}
+
+// tradeLog 为一笔交易内产生的交易记录和价格记录统一编号，并以交易时间戳作为记录时间
+type tradeLog struct {
+	ctx       contractapi.TransactionContextInterface
+	txID      string
+	nanos     int64
+	timestamp string
+	seq       int
+	tickSeq   int
+}
+
+func newTradeLog(ctx contractapi.TransactionContextInterface) (*tradeLog, error) {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	now := txTime.AsTime()
+	return &tradeLog{
+		ctx:       ctx,
+		txID:      ctx.GetStub().GetTxID(),
+		nanos:     now.UnixNano(),
+		timestamp: now.UTC().Format(time.RFC3339Nano),
+	}, nil
+}
+
+// record 补全记录编号、交易号和时间后写入账本
+func (l *tradeLog) record(trade Trade) error {
+	trade.ID = fmt.Sprintf("%s_%03d", l.txID, l.seq)
+	trade.TxID = l.txID
+	trade.Timestamp = l.timestamp
+	l.seq++
+
+	key, err := tradeKey(l.ctx, &trade, l.nanos)
+	if err != nil {
+		return err
+	}
+	return putJSON(l.ctx, key, trade)
+}
+
+// recordTransfer 为转出方和转入方各写一条转让记录。交易记录在公共账本上，现金转账不记录金额
+func (l *tradeLog) recordTransfer(from string, to string, symbol string, quantity int, currency string) error {
+	if err := l.record(Trade{Username: from, Side: TradeTransferOut, Symbol: symbol, Quantity: quantity, Currency: currency, Counterparty: to}); err != nil {
+		return err
+	}
+	return l.record(Trade{Username: to, Side: TradeTransferIn, Symbol: symbol, Quantity: quantity, Currency: currency, Counterparty: from})
+}
+
+// parseTimeBound 解析查询时间范围，空串表示不限
+func parseTimeBound(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %s, must be RFC3339", value)
+	}
+	return &t, nil
+}
+
+// GetUserTrades 按时间先后返回用户的交易记录。
+// startTime、endTime 为 RFC3339 时间，包含起点不含终点，传空串表示不限。
+// 交易记录带有成交金额、手续费和已实现盈亏，只向账户本人和管理员返回。
+func (s *StockSmartContract) GetUserTrades(ctx contractapi.TransactionContextInterface, username string, startTime string, endTime string) ([]Trade, error) {
+	start, err := parseTimeBound(startTime)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeBound(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := readUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireOwner(ctx, user); err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tradeObjectType, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	trades := []Trade{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var trade Trade
+		if err := json.Unmarshal(queryResponse.Value, &trade); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, trade.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp on trade %s: %v", trade.ID, err)
+		}
+		if start != nil && t.Before(*start) {
+			continue
+		}
+		if end != nil && !t.Before(*end) {
+			continue
+		}
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
@@ -0,0 +1,123 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// loadTransferParties 读取转出方和转入方账户，并做基本校验
+func loadTransferParties(accounts *accountCache, from string, to string) (*UserAccount, *UserAccount, error) {
+	if from == to {
+		return nil, nil, fmt.Errorf("cannot transfer to the same account")
+	}
+	sender, err := accounts.get(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	receiver, err := accounts.get(to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sender, receiver, nil
+}
+
+// TransferShares 用户之间转让股票，转出方必须持有足够数量，股票的成本批次随之转入接收方
+func (s *StockSmartContract) TransferShares(ctx contractapi.TransactionContextInterface, from string, to string, stockID string, amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	stock, err := readStock(ctx, stockID)
+	if err != nil {
+		return err
+	}
+	if err := checkTradable(stock); err != nil {
+		return err
+	}
+
+	accounts := newAccountCache(ctx)
+	sender, receiver, err := loadTransferParties(accounts, from, to)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, sender); err != nil {
+		return err
+	}
+
+	if sender.Stocks[stockID] < amount {
+		return fmt.Errorf("insufficient shares to transfer")
+	}
+
+	sender.Stocks[stockID] -= amount
+	receiver.Stocks[stockID] += amount
+	if err := accounts.transferLots(sender, receiver, stockID, amount); err != nil {
+		return err
+	}
+
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return err
+	}
+	if err := trades.recordTransfer(from, to, stockID, amount, ""); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventSharesTransferred, Username: from, Counterparty: to, Symbol: stockID, Quantity: amount})
+}
+
+// TransferCash 用户之间转账，金额（分）通过 transient map 的 amount 键传入，currency 为空时为基准币种，
+// 转出方该币种余额必须足够。金额只记入双方的私有账户历史，交易记录和事件中只有币种
+func (s *StockSmartContract) TransferCash(ctx contractapi.TransactionContextInterface, from string, to string, currency string) error {
+	amount, err := transientAmount(ctx)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if currency, err = normalizeCurrency(currency); err != nil {
+		return err
+	}
+
+	accounts := newAccountCache(ctx)
+	sender, receiver, err := loadTransferParties(accounts, from, to)
+	if err != nil {
+		return err
+	}
+	if err := requireOwner(ctx, sender); err != nil {
+		return err
+	}
+
+	if sender.balanceIn(currency) < amount {
+		return fmt.Errorf("insufficient balance. Available: %s", formatAmount(currency, sender.balanceIn(currency)))
+	}
+
+	if err := sender.addBalance(currency, -amount); err != nil {
+		return err
+	}
+	if err := receiver.addBalance(currency, amount); err != nil {
+		return err
+	}
+	sender.History = append(sender.History, fmt.Sprintf("Transferred %s to %s", formatMoney(currency, amount), to))
+	receiver.History = append(receiver.History, fmt.Sprintf("Received %s from %s", formatMoney(currency, amount), from))
+
+	if err := accounts.flush(); err != nil {
+		return err
+	}
+
+	trades, err := newTradeLog(ctx)
+	if err != nil {
+		return err
+	}
+	if err := trades.recordTransfer(from, to, "", 0, currency); err != nil {
+		return err
+	}
+	if err := trades.recordCashTransfer(from, to, currency, amount); err != nil {
+		return err
+	}
+	return emitEvent(ctx, StockEvent{Type: EventCashTransferred, Username: from, Counterparty: to, Currency: currency})
+}
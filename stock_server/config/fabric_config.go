@@ -2,6 +2,7 @@ package config
 
 import (
 	"crypto/x509"  
+	"fmt"
 	"os"          
 	"path"        
 	// "github.com/hyperledger/fabric-gateway/pkg/client"
@@ -15,6 +16,8 @@ const (
 	CryptoPath   = "../fabric-samples-main/test-network/organizations/peerOrganizations/org1.example.com"
 	CertPath     = CryptoPath + "/users/User1@org1.example.com/msp/signcerts"
 	KeyPath      = CryptoPath + "/users/User1@org1.example.com/msp/keystore"
+	AdminCertPath = CryptoPath + "/users/Admin@org1.example.com/msp/signcerts"
+	AdminKeyPath  = CryptoPath + "/users/Admin@org1.example.com/msp/keystore"
 	TLSCertPath  = CryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
 	PeerEndpoint = "dns:///localhost:7051"
 	GatewayPeer  = "peer0.org1.example.com"
@@ -37,21 +40,83 @@ func NewGrpcConnection() *grpc.ClientConn {
 }
 
 func NewIdentity() *identity.X509Identity {
-	certPEM, _ := ReadFirstFile(CertPath)
+	return newIdentity(CertPath)
+}
+
+func NewSign() identity.Sign {
+	return newSign(KeyPath)
+}
+
+// NewAdminIdentity 管理员身份，用于上市、调价、退市等需要链码管理员权限的操作
+func NewAdminIdentity() *identity.X509Identity {
+	return newIdentity(AdminCertPath)
+}
+
+func NewAdminSign() identity.Sign {
+	return newSign(AdminKeyPath)
+}
+
+// UserMSPPath 用户的 MSP 目录，按 fabric-ca 登记时的目录结构存放在 CryptoPath/users/<用户名>@org1.example.com 下
+func UserMSPPath(username string) string {
+	return CryptoPath + "/users/" + username + "@org1.example.com/msp"
+}
+
+// LoadUserIdentity 读取用户的证书和私钥，用于以该用户身份签名交易
+func LoadUserIdentity(username string) (*identity.X509Identity, identity.Sign, error) {
+	mspPath := UserMSPPath(username)
+
+	certPEM, err := ReadFirstFile(mspPath + "/signcerts")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate of %s: %w", username, err)
+	}
+	cert, err := identity.CertificateFromPEM(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := identity.NewX509Identity(MspID, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := ReadFirstFile(mspPath + "/keystore")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key of %s: %w", username, err)
+	}
+	key, err := identity.PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return id, sign, nil
+}
+
+func newIdentity(certPath string) *identity.X509Identity {
+	certPEM, _ := ReadFirstFile(certPath)
 	cert, _ := identity.CertificateFromPEM(certPEM)
 	id, _ := identity.NewX509Identity(MspID, cert)
 	return id
 }
 
-func NewSign() identity.Sign {
-	keyPEM, _ := ReadFirstFile(KeyPath)
+func newSign(keyPath string) identity.Sign {
+	keyPEM, _ := ReadFirstFile(keyPath)
 	key, _ := identity.PrivateKeyFromPEM(keyPEM)
 	sign, _ := identity.NewPrivateKeySign(key)
 	return sign
 }
 
 func ReadFirstFile(dirPath string) ([]byte, error) {
-	dir, _ := os.Open(dirPath)
-	files, _ := dir.Readdirnames(1)
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	files, err := dir.Readdirnames(1)
+	if err != nil {
+		return nil, err
+	}
 	return os.ReadFile(path.Join(dirPath, files[0]))
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"sync"
+
+	"server/model"
+)
+
+// subscriberBuffer 每个订阅者的缓冲区大小，客户端消费过慢时丢弃新事件，避免拖慢其他订阅者
+const subscriberBuffer = 64
+
+// Broker 将链码事件分发给所有在线的客户端
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan model.EventInfo]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[chan model.EventInfo]struct{})}
+}
+
+// Subscribe 注册一个订阅者，返回事件通道和取消订阅函数
+func (b *Broker) Subscribe() (<-chan model.EventInfo, func()) {
+	ch := make(chan model.EventInfo, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish 向所有订阅者广播事件
+func (b *Broker) Publish(event model.EventInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
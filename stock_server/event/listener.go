@@ -0,0 +1,46 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+// retryInterval 事件流中断后重新订阅的间隔
+const retryInterval = 5 * time.Second
+
+// Listen 订阅链码事件并转发给 broker，直到 ctx 结束。
+// 事件流中断后从最后处理的事件之后继续订阅，不会重复或遗漏。
+func Listen(ctx context.Context, network *client.Network, chaincodeName string, broker *Broker) {
+	checkpointer := &client.InMemoryCheckpointer{}
+
+	for {
+		events, err := network.ChaincodeEvents(ctx, chaincodeName, client.WithCheckpoint(checkpointer))
+		if err != nil {
+			log.Printf("Failed to subscribe to chaincode events: %v", err)
+		} else {
+			for ev := range events {
+				var ledgerEvent model.StockEvent
+				if err := json.Unmarshal(ev.Payload, &ledgerEvent); err != nil {
+					log.Printf("Failed to parse chaincode event %s in tx %s: %v", ev.EventName, ev.TransactionID, err)
+				} else {
+					info := ledgerEvent.Info()
+					info.BlockNumber = ev.BlockNumber
+					broker.Publish(info)
+				}
+				checkpointer.CheckpointChaincodeEvent(ev)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+			log.Printf("Chaincode event stream closed, resubscribing")
+		}
+	}
+}
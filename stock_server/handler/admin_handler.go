@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+	"server/service"
+)
+
+func ListStock(contract *client.Contract, c *gin.Context) {
+	var req model.ListStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 ListStock 函数，非 USD 计价的股票需要先设置该币种的汇率
+	_, err := contract.SubmitTransaction("ListStock", req.StockID, req.Price.Cents(), strconv.Itoa(req.Quantity), req.Currency)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Stock %s listed successfully", req.StockID)})
+}
+
+func SetStockPrice(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	var req model.SetStockPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SetStockPrice 函数，价格偏离参考价超过熔断阈值时股票自动停牌
+	result, err := contract.SubmitTransaction("SetStockPrice", stockID, req.Price.Cents())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stock model.StockToken
+	if err := json.Unmarshal(result, &stock); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Price of %s set to %s", stockID, req.Price), "stock": stock.Info()})
+}
+
+func DelistStock(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 DelistStock 函数
+	_, err := contract.SubmitTransaction("DelistStock", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Stock %s delisted successfully", stockID)})
+}
+
+func BindAccount(contract *client.Contract, pool *service.ContractPool, c *gin.Context) {
+	username := c.Param("username")
+
+	var req model.BindAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Identity == "" {
+		req.Identity = username
+	}
+
+	userContract, err := pool.For(req.Identity)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 以用户身份调用 WhoAmI，取得链码看到的 MSP ID 和证书 ID
+	result, err := userContract.EvaluateTransaction("WhoAmI")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var caller struct {
+		MSPID string `json:"mspId"`
+		ID    string `json:"id"`
+	}
+	if err := json.Unmarshal(result, &caller); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse identity"})
+		return
+	}
+
+	// 调用智能合约的 BindAccount 函数
+	_, err = contract.SubmitTransaction("BindAccount", username, caller.MSPID, caller.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Account %s bound to %s", username, req.Identity)})
+}
+
+func SplitStock(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	var req model.SplitStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SplitStock 函数
+	result, err := contract.SubmitTransaction("SplitStock", stockID, strconv.Itoa(req.Numerator), strconv.Itoa(req.Denominator))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var split model.SplitResult
+	if err := json.Unmarshal(result, &split); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse split result"})
+		return
+	}
+
+	c.JSON(http.StatusOK, split.Info())
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+// FieldChange 相邻两个版本之间某个字段的变化，新增字段的 From 为 null，删除时 To 为 null
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditVersion 记录的一个历史版本及其相对上一版本的变化
+type AuditVersion struct {
+	TxID         string                 `json:"tx_id"`
+	Timestamp    string                 `json:"timestamp"`
+	IsDelete     bool                   `json:"is_delete"`
+	Value        map[string]interface{} `json:"value"`
+	Changes      map[string]FieldChange `json:"changes"`
+	TradeIDs     []string               `json:"trade_ids,omitempty"`      // 用户记录：同一交易写入的交易记录编号
+	CashEntryIDs []string               `json:"cash_entry_ids,omitempty"` // 用户记录：同一交易写入的现金流水编号
+}
+
+type AuditResponse struct {
+	Versions []AuditVersion `json:"versions"`
+}
+
+// ledgerVersion 与链码中的 UserVersion / StockVersion 对应，Value 按记录类型再解析
+type ledgerVersion struct {
+	TxID         string          `json:"txId"`
+	Timestamp    string          `json:"timestamp"`
+	IsDelete     bool            `json:"isDelete"`
+	Value        json.RawMessage `json:"value"`
+	TradeIDs     []string        `json:"tradeIds"`
+	CashEntryIDs []string        `json:"cashEntryIds"`
+}
+
+func GetUserAudit(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetUserHistory 函数
+	result, err := contract.EvaluateTransaction("GetUserHistory", username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	renderAudit(c, result, func(raw json.RawMessage) (interface{}, error) {
+		var user model.UserAccount
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return nil, err
+		}
+		return user.Info(), nil
+	}, "stocks")
+}
+
+func GetStockAudit(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 GetStockHistory 函数
+	result, err := contract.EvaluateTransaction("GetStockHistory", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	renderAudit(c, result, func(raw json.RawMessage) (interface{}, error) {
+		var stock model.StockToken
+		if err := json.Unmarshal(raw, &stock); err != nil {
+			return nil, err
+		}
+		return stock.Info(), nil
+	})
+}
+
+func AuditLedger(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 AuditLedger 函数
+	result, err := contract.EvaluateTransaction("AuditLedger")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var audit model.LedgerAudit
+	if err := json.Unmarshal(result, &audit); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse audit report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, audit.Info())
+}
+
+// renderAudit 将链码返回的历史版本转换为客户端视图，并逐个计算与上一版本的字段差异。
+// omit 中的字段不参与展示，例如用户记录本身不含持仓，历史版本中的 stocks 恒为空。
+func renderAudit(c *gin.Context, result []byte, view func(raw json.RawMessage) (interface{}, error), omit ...string) {
+	var ledgerVersions []ledgerVersion
+	if err := json.Unmarshal(result, &ledgerVersions); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse history"})
+		return
+	}
+
+	versions := make([]AuditVersion, 0, len(ledgerVersions))
+	previous := map[string]interface{}{}
+	for _, ledger := range ledgerVersions {
+		current := map[string]interface{}{}
+		if !ledger.IsDelete {
+			value, err := view(ledger.Value)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse history"})
+				return
+			}
+			if current, err = toFields(value); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse history"})
+				return
+			}
+			for _, field := range omit {
+				delete(current, field)
+			}
+		}
+
+		version := AuditVersion{
+			TxID:         ledger.TxID,
+			Timestamp:    ledger.Timestamp,
+			IsDelete:     ledger.IsDelete,
+			Changes:      diffFields(previous, current),
+			TradeIDs:     ledger.TradeIDs,
+			CashEntryIDs: ledger.CashEntryIDs,
+		}
+		if !ledger.IsDelete {
+			version.Value = current
+		}
+		versions = append(versions, version)
+		previous = current
+	}
+
+	c.JSON(http.StatusOK, AuditResponse{Versions: versions})
+}
+
+// toFields 将视图对象按 JSON 字段名展开，便于逐字段比较
+func toFields(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// diffFields 返回两个版本之间发生变化的字段
+func diffFields(previous map[string]interface{}, current map[string]interface{}) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	for field, to := range current {
+		if from, ok := previous[field]; !ok || !reflect.DeepEqual(from, to) {
+			changes[field] = FieldChange{From: previous[field], To: to}
+		}
+	}
+	for field, from := range previous {
+		if _, ok := current[field]; !ok {
+			changes[field] = FieldChange{From: from, To: nil}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+func SubmitBasket(contract *client.Contract, c *gin.Context) {
+	var req model.SubmitBasketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	legs := make([]model.BasketLeg, 0, len(req.Legs))
+	for _, leg := range req.Legs {
+		legs = append(legs, model.BasketLeg{Symbol: leg.StockID, Side: leg.Side, Quantity: leg.Amount, LimitPrice: int64(leg.LimitPrice)})
+	}
+	legsJSON, err := json.Marshal(legs)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SubmitBasket 函数，全部股票在同一笔交易内成交，任一失败则整体不成交
+	result, err := contract.SubmitTransaction("SubmitBasket", req.Username, string(legsJSON), c.GetHeader(IdempotencyKeyHeader))
+	if err != nil {
+		abortTradeError(c, err)
+		return
+	}
+
+	var basket model.BasketResult
+	if err := json.Unmarshal(result, &basket); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse basket result"})
+		return
+	}
+
+	c.JSON(http.StatusOK, basket.Info())
+}
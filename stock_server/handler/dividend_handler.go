@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+// dividendConflictPattern 匹配以不同每股派息重复宣布、或股票已退市时链码返回的错误
+var dividendConflictPattern = regexp.MustCompile(`dividend \S+ was already declared|stock \S+ is delisted`)
+
+type UserDividendsResponse struct {
+	Dividends []model.DividendPaymentInfo `json:"dividends"`
+}
+
+func DeclareDividend(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	var req model.DeclareDividendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 DeclareDividend 函数，同一只股票同一登记日重复提交不会重复派息，每股派息不同时返回 409
+	result, err := contract.SubmitTransaction("DeclareDividend", stockID, req.PerShare.Cents(), req.RecordDate)
+	if err != nil {
+		for _, message := range chaincodeMessages(err) {
+			if dividendConflictPattern.MatchString(message) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": message})
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var declaration model.DividendDeclaration
+	if err := json.Unmarshal(result, &declaration); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse dividend"})
+		return
+	}
+
+	c.JSON(http.StatusOK, declaration.Info())
+}
+
+func GetDividend(contract *client.Contract, c *gin.Context) {
+	declarationID := c.Param("declarationID")
+
+	// 调用智能合约的 GetDividend 函数
+	result, err := contract.EvaluateTransaction("GetDividend", declarationID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var declaration model.DividendDeclaration
+	if err := json.Unmarshal(result, &declaration); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse dividend"})
+		return
+	}
+
+	c.JSON(http.StatusOK, declaration.Info())
+}
+
+func GetUserDividends(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetUserDividends 函数
+	result, err := contract.EvaluateTransaction("GetUserDividends", username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payments []model.DividendPayment
+	if err := json.Unmarshal(result, &payments); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse dividends"})
+		return
+	}
+
+	response := UserDividendsResponse{Dividends: make([]model.DividendPaymentInfo, 0, len(payments))}
+	for _, payment := range payments {
+		response.Dividends = append(response.Dividends, payment.Info())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"server/event"
+)
+
+// pingInterval 长连接的心跳间隔，防止代理因空闲断开连接
+const pingInterval = 30 * time.Second
+
+var upgrader = websocket.Upgrader{
+	// 与 HTTP 接口一致，不限制来源
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// StreamEvents 以 Server-Sent Events 推送链码事件，事件名为链码事件名称
+func StreamEvents(broker *event.Broker, c *gin.Context) {
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header("Content-Type", "text/event-stream")
+	// 立即发送响应头，客户端无需等到第一个事件才确认连接建立
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev := <-events:
+			c.SSEvent(ev.Type, ev)
+			return true
+		case <-ticker.C:
+			c.SSEvent("ping", time.Now().UTC().Format(time.RFC3339))
+			return true
+		}
+	})
+}
+
+// StreamEventsWebSocket 以 WebSocket 推送链码事件，每条消息为一个 JSON 事件
+func StreamEventsWebSocket(broker *event.Broker, c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已经写入了错误响应
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	// 客户端只接收不发送，读循环用于感知连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev := <-events:
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingInterval)); err != nil {
+				return
+			}
+		}
+	}
+}
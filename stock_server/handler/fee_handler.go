@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+func SetFeeSchedule(contract *client.Contract, c *gin.Context) {
+	var req model.FeeScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SetFeeSchedule 函数
+	_, err := contract.SubmitTransaction("SetFeeSchedule", req.Collector, req.Flat.Cents(), strconv.Itoa(req.BasisPoints), req.Minimum.Cents())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Fee schedule set, fees collected by %s", req.Collector)})
+}
+
+func SetSymbolFee(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	var req model.FeeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SetSymbolFee 函数
+	_, err := contract.SubmitTransaction("SetSymbolFee", stockID, req.Flat.Cents(), strconv.Itoa(req.BasisPoints), req.Minimum.Cents())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Fee override set for %s", stockID)})
+}
+
+func RemoveSymbolFee(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 RemoveSymbolFee 函数
+	_, err := contract.SubmitTransaction("RemoveSymbolFee", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Fee override removed for %s", stockID)})
+}
+
+func GetFeeSchedule(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 GetFeeSchedule 函数
+	result, err := contract.EvaluateTransaction("GetFeeSchedule")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var schedule model.FeeSchedule
+	if err := json.Unmarshal(result, &schedule); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse fee schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule.Info())
+}
+
+// QuoteFee 预估手续费，查询参数 stock_id、side、amount 必填，price 不传时按当前股价计算
+func QuoteFee(contract *client.Contract, c *gin.Context) {
+	stockID := c.Query("stock_id")
+	side := c.Query("side")
+	amount, err := strconv.Atoi(c.Query("amount"))
+	if stockID == "" || side == "" || err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "stock_id, side and amount are required"})
+		return
+	}
+	var price model.Amount
+	if value := c.Query("price"); value != "" {
+		if price, err = model.ParseAmount(value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// 调用智能合约的 QuoteFee 函数
+	result, err := contract.EvaluateTransaction("QuoteFee", stockID, side, strconv.Itoa(amount), price.Cents())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var quote model.FeeQuote
+	if err := json.Unmarshal(result, &quote); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse fee quote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quote.Info())
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+func SetFXRate(contract *client.Contract, c *gin.Context) {
+	currency := c.Param("currency")
+
+	var req model.FXRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SetFXRate 函数，汇率以 10^6 倍的整数传入
+	_, err := contract.SubmitTransaction("SetFXRate", currency, req.Rate.Micros())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("FX rate of %s set to %s %s", currency, req.Rate, model.DefaultCurrency)})
+}
+
+func GetFXRates(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 GetFXRates 函数
+	result, err := contract.EvaluateTransaction("GetFXRates")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rates []model.FXRate
+	if err := json.Unmarshal(result, &rates); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse FX rates"})
+		return
+	}
+
+	infos := make([]model.FXRateInfo, 0, len(rates))
+	for _, rate := range rates {
+		infos = append(infos, rate.Info())
+	}
+	c.JSON(http.StatusOK, gin.H{"base": model.DefaultCurrency, "rates": infos})
+}
+
+// GetUserValuation 查询用户资产估值，查询参数 currency 为计价币种，不传时为 USD
+func GetUserValuation(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetUserValuation 函数
+	result, err := contract.EvaluateTransaction("GetUserValuation", username, c.Query("currency"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var valuation model.Valuation
+	if err := json.Unmarshal(result, &valuation); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse valuation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, valuation.Info())
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+	"server/model"
+)
+
+// haltedPattern 匹配链码 checkTradable 返回的停牌错误，提取股票代码和停牌原因代码
+var haltedPattern = regexp.MustCompile(`stock (\S+) is halted \((\w+)\)`)
+
+// rejectedPattern 匹配链码对交易参数或余额的校验错误：数量或价格非正、付款与应付金额不符、余额、持股或流通池不足，
+// 以及篮子委托的格式错误和限价不满足
+var rejectedPattern = regexp.MustCompile(`(amount|quantity|price) must be positive|overpayment rejected|insufficient |invalid side|basket must have|legs must be a JSON array|appears more than once in the basket|(above|below) the limit of`)
+
+// reusedKeyPattern 匹配 Idempotency-Key 已用于参数不同的请求时链码返回的错误
+var reusedKeyPattern = regexp.MustCompile(`client order ID \S+ was already used`)
+
+// chaincodeMessages 返回 Gateway 错误及其附带的各 peer 链码错误信息
+func chaincodeMessages(err error) []string {
+	messages := []string{err.Error()}
+	if st, ok := status.FromError(err); ok {
+		for _, detail := range st.Details() {
+			if errorDetail, ok := detail.(*gateway.ErrorDetail); ok {
+				messages = append(messages, errorDetail.GetMessage())
+			}
+		}
+	}
+	return messages
+}
+
+// abortTradeError 交易类接口的错误响应：股票停牌时返回 409 及停牌原因代码，Idempotency-Key 冲突返回 409，
+// 参数或余额校验失败返回 400，其余错误返回 500
+func abortTradeError(c *gin.Context, err error) {
+	for _, message := range chaincodeMessages(err) {
+		if match := haltedPattern.FindStringSubmatch(message); match != nil {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error":  fmt.Sprintf("stock %s is halted", match[1]),
+				"symbol": match[1],
+				"reason": match[2],
+			})
+			return
+		}
+		if reusedKeyPattern.MatchString(message) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": message})
+			return
+		}
+		if rejectedPattern.MatchString(message) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func HaltStock(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	var req model.HaltStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 HaltStock 函数
+	_, err := contract.SubmitTransaction("HaltStock", stockID, req.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Stock %s halted", stockID), "reason": req.Reason})
+}
+
+func ResumeStock(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 ResumeStock 函数
+	_, err := contract.SubmitTransaction("ResumeStock", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Stock %s resumed", stockID)})
+}
+
+func SetCircuitBreaker(contract *client.Contract, c *gin.Context) {
+	var req model.CircuitBreakerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.ThresholdPercent.Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "threshold_percent must be between 0 and 100"})
+		return
+	}
+
+	// 调用智能合约的 SetCircuitBreaker 函数，阈值以基点（万分之一）传入
+	_, err := contract.SubmitTransaction("SetCircuitBreaker", req.ThresholdPercent.BasisPoints())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threshold_percent": req.ThresholdPercent})
+}
+
+func GetCircuitBreaker(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 GetCircuitBreaker 函数
+	result, err := contract.EvaluateTransaction("GetCircuitBreaker")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var config model.CircuitBreaker
+	if err := json.Unmarshal(result, &config); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse circuit breaker"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"threshold_percent": model.Percent(config.ThresholdBasisPoints)})
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+type StockHoldersResponse struct {
+	Symbol  string              `json:"symbol"`
+	Holders []model.HoldingInfo `json:"holders"`
+}
+
+func GetStockHolders(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 GetStockHolders 函数，按股东索引返回该股票的全部持仓
+	result, err := contract.EvaluateTransaction("GetStockHolders", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var positions []model.Holding
+	if err := json.Unmarshal(result, &positions); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stock holders"})
+		return
+	}
+
+	holders := []model.HoldingInfo{}
+	for _, position := range positions {
+		holders = append(holders, position.Info())
+	}
+
+	c.JSON(http.StatusOK, StockHoldersResponse{Symbol: stockID, Holders: holders})
+}
+
+func MigrateHolderIndex(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateHolderIndex 函数，根据现有持仓重建股东索引
+	result, err := contract.SubmitTransaction("MigrateHolderIndex")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+// IdempotencyKeyHeader 客户端为买入、卖出、下单请求携带的幂等键，作为客户端订单号传给链码；
+// 超时后以相同的键重试不会重复执行，返回第一次执行的结果
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+func GetClientOrder(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+	clientOrderID := c.Param("clientOrderID")
+
+	// 调用智能合约的 GetClientOrder 函数
+	result, err := contract.EvaluateTransaction("GetClientOrder", username, clientOrderID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var record model.ClientOrder
+	if err := json.Unmarshal(result, &record); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse client order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record.Info())
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+type PlaceOrderResponse struct {
+	Order model.OrderInfo  `json:"order"`
+	Fills []model.FillInfo `json:"fills"`
+}
+
+type OrderBookResponse struct {
+	Symbol string            `json:"symbol"`
+	Bids   []model.OrderInfo `json:"bids"`
+	Asks   []model.OrderInfo `json:"asks"`
+}
+
+func PlaceOrder(contract *client.Contract, c *gin.Context) {
+	var req model.PlaceOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 PlaceOrder 函数
+	result, err := contract.SubmitTransaction("PlaceOrder", req.Username, req.StockID, req.Side, strconv.Itoa(req.Amount), req.Price.Cents(), c.GetHeader(IdempotencyKeyHeader))
+	if err != nil {
+		abortTradeError(c, err)
+		return
+	}
+
+	var orderResult struct {
+		Order model.Order  `json:"order"`
+		Fills []model.Fill `json:"fills"`
+	}
+	if err := json.Unmarshal(result, &orderResult); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse order result"})
+		return
+	}
+
+	fills := make([]model.FillInfo, 0, len(orderResult.Fills))
+	for _, fill := range orderResult.Fills {
+		fills = append(fills, fill.Info())
+	}
+
+	c.JSON(http.StatusOK, PlaceOrderResponse{Order: orderResult.Order.Info(), Fills: fills})
+}
+
+func CancelOrder(contract *client.Contract, c *gin.Context) {
+	orderID := c.Param("orderID")
+	username := c.Query("username")
+	if username == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+		return
+	}
+
+	// 调用智能合约的 CancelOrder 函数
+	_, err := contract.SubmitTransaction("CancelOrder", username, orderID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Order %s cancelled successfully", orderID)})
+}
+
+func GetOrder(contract *client.Contract, c *gin.Context) {
+	orderID := c.Param("orderID")
+
+	// 调用智能合约的 GetOrder 函数
+	result, err := contract.EvaluateTransaction("GetOrder", orderID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order model.Order
+	if err := json.Unmarshal(result, &order); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order.Info())
+}
+
+func GetOrderBook(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+
+	// 调用智能合约的 GetOrderBook 函数
+	result, err := contract.EvaluateTransaction("GetOrderBook", stockID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var book struct {
+		Symbol string        `json:"symbol"`
+		Bids   []model.Order `json:"bids"`
+		Asks   []model.Order `json:"asks"`
+	}
+	if err := json.Unmarshal(result, &book); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse order book"})
+		return
+	}
+
+	response := OrderBookResponse{
+		Symbol: book.Symbol,
+		Bids:   make([]model.OrderInfo, 0, len(book.Bids)),
+		Asks:   make([]model.OrderInfo, 0, len(book.Asks)),
+	}
+	for _, order := range book.Bids {
+		response.Bids = append(response.Bids, order.Info())
+	}
+	for _, order := range book.Asks {
+		response.Asks = append(response.Asks, order.Info())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func MigrateOrderIndex(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateOrderIndex 函数，根据现有订单重建用户挂单索引
+	result, err := contract.SubmitTransaction("MigrateOrderIndex")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+func SetCostBasisMethod(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	var req model.CostBasisMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 SetCostBasisMethod 函数
+	_, err := contract.SubmitTransaction("SetCostBasisMethod", username, req.Method)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Cost basis method of %s set to %s", username, req.Method)})
+}
+
+// GetUserPnL 查询用户各持仓的已实现和未实现盈亏
+func GetUserPnL(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetUserPnL 函数
+	result, err := contract.EvaluateTransaction("GetUserPnL", username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pnl model.UserPnL
+	if err := json.Unmarshal(result, &pnl); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse P&L"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pnl.Info())
+}
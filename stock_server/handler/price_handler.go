@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+type PriceHistoryResponse struct {
+	Symbol   string               `json:"symbol"`
+	Interval string               `json:"interval"`
+	Bars     []model.PriceBarInfo `json:"bars"`
+}
+
+// GetPriceHistory 查询股票的 K 线，查询参数 interval 为 1m / 1h / 1d（默认 1d），start / end 为可选的 RFC3339 时间
+func GetPriceHistory(contract *client.Contract, c *gin.Context) {
+	stockID := c.Param("stockID")
+	interval := c.DefaultQuery("interval", "1d")
+	start, end, ok := timeRange(c)
+	if !ok {
+		return
+	}
+
+	// 调用智能合约的 GetPriceBars 函数
+	result, err := contract.EvaluateTransaction("GetPriceBars", stockID, interval, start, end)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ledgerBars []model.PriceBar
+	if err := json.Unmarshal(result, &ledgerBars); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse price bars"})
+		return
+	}
+
+	bars := make([]model.PriceBarInfo, 0, len(ledgerBars))
+	for _, bar := range ledgerBars {
+		bars = append(bars, bar.Info())
+	}
+
+	c.JSON(http.StatusOK, PriceHistoryResponse{Symbol: stockID, Interval: interval, Bars: bars})
+}
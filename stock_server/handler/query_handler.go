@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+// queryTypes 富查询类型对应的链码函数，分页版本的函数名加 Page 后缀，listField 为分页结果中的列表字段
+var queryTypes = map[string]struct {
+	function  string
+	listField string
+}{
+	"holdings": {function: "QueryHoldings", listField: "holdings"},
+	"stocks":   {function: "QueryStocks", listField: "stocks"},
+	"balances": {function: "QueryUserBalances", listField: "users"},
+}
+
+// invalidQueryPattern 匹配链码对查询条件和分页参数的校验错误
+var invalidQueryPattern = regexp.MustCompile(`unsupported selector operator|selector must be a JSON object|page size must be between`)
+
+type QueryResponse struct {
+	Type     string        `json:"type"`
+	Results  []interface{} `json:"results"`
+	Bookmark string        `json:"bookmark,omitempty"`
+}
+
+func RunQuery(contract *client.Contract, c *gin.Context) {
+	var req model.QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	queryType, ok := queryTypes[req.Type]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "type must be holdings, stocks or balances"})
+		return
+	}
+	if req.PageSize < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "page_size must not be negative"})
+		return
+	}
+	selector := "{}"
+	if len(req.Selector) > 0 {
+		selector = string(req.Selector)
+	}
+
+	// 调用智能合约的 Query* 函数，page_size 大于 0 时调用分页版本
+	var list json.RawMessage
+	bookmark := ""
+	if req.PageSize > 0 {
+		result, err := contract.EvaluateTransaction(queryType.function+"Page", selector, strconv.Itoa(req.PageSize), req.Bookmark)
+		if err != nil {
+			abortQueryError(c, err)
+			return
+		}
+		var page map[string]json.RawMessage
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse query result"})
+			return
+		}
+		list = page[queryType.listField]
+		if err := json.Unmarshal(page["bookmark"], &bookmark); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse query result"})
+			return
+		}
+	} else {
+		result, err := contract.EvaluateTransaction(queryType.function, selector)
+		if err != nil {
+			abortQueryError(c, err)
+			return
+		}
+		list = result
+	}
+
+	results, err := queryViews(req.Type, list)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse query result"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{Type: req.Type, Results: results, Bookmark: bookmark})
+}
+
+// abortQueryError 查询条件或分页参数无效时返回 400，其余错误返回 500
+func abortQueryError(c *gin.Context, err error) {
+	for _, message := range chaincodeMessages(err) {
+		if invalidQueryPattern.MatchString(message) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// queryViews 将链码返回的记录列表转换为客户端视图
+func queryViews(queryType string, list json.RawMessage) ([]interface{}, error) {
+	results := []interface{}{}
+	switch queryType {
+	case "holdings":
+		var holdings []model.Holding
+		if err := json.Unmarshal(list, &holdings); err != nil {
+			return nil, err
+		}
+		for _, holding := range holdings {
+			results = append(results, holding.Info())
+		}
+	case "stocks":
+		var stocks []model.StockToken
+		if err := json.Unmarshal(list, &stocks); err != nil {
+			return nil, err
+		}
+		for _, stock := range stocks {
+			results = append(results, stock.Info())
+		}
+	case "balances":
+		var users []model.UserBalance
+		if err := json.Unmarshal(list, &users); err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			results = append(results, user.Info())
+		}
+	}
+	return results, nil
+}
+
+func MigrateQueryFields(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateQueryFields 函数，为旧记录补上富查询使用的 docType 字段
+	result, err := submitPrivate(contract, "MigrateQueryFields", nil)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
+}
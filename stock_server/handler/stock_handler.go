@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/config"
 	"server/model"
 )
 
@@ -16,20 +19,57 @@ type UserStocksResponse struct {
 }
 
 type UserTotalValueResponse struct {
-	TotalValue float64 `json:"totalValue"`
+	TotalValue model.Amount `json:"totalValue"`
 }
 
 type StockPriceResponse struct {
-	Price float64 `json:"price"`
+	Price model.Amount `json:"price"`
 }
 
 type SellStockResponse struct {
-	Revenue float64 `json:"revenue"`
+	Revenue model.Amount `json:"revenue"`
+}
+
+type BalanceResponse struct {
+	Balance model.Amount `json:"balance"`
+}
+
+type UserTradesResponse struct {
+	Trades []model.TradeInfo `json:"trades"`
+}
+
+type UserCashEntriesResponse struct {
+	Entries []model.CashEntryInfo `json:"entries"`
+}
+
+// MaxPageSize 与链码一致的单页最大记录数
+const MaxPageSize = 200
+
+// 分页查询的响应，Bookmark 为空表示没有下一页
+type StocksPageResponse struct {
+	Stocks   map[string]model.StockInfo `json:"stocks"`
+	Bookmark string                     `json:"bookmark"`
+}
+
+type UsersPageResponse struct {
+	Users    map[string]model.UserInfo `json:"users"`
+	Bookmark string                    `json:"bookmark"`
+}
+
+type AssetsPageResponse struct {
+	Assets   map[string]interface{} `json:"assets"`
+	Bookmark string                 `json:"bookmark"`
 }
 
 func InitLedger(contract *client.Contract, c *gin.Context) {
 	_, err := contract.SubmitTransaction("InitLedger")
 	if err != nil {
+		for _, message := range chaincodeMessages(err) {
+			if strings.Contains(message, "ledger is already initialized") {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": message})
+				return
+			}
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -44,9 +84,9 @@ func BuyStock(contract *client.Contract, c *gin.Context) {
 	}
 
 	// 调用智能合约的 BuyStock 函数
-	_, err := contract.SubmitTransaction("BuyStock", req.Username, req.StockID, strconv.Itoa(req.Amount), fmt.Sprintf("%.2f", req.Payment))
+	_, err := contract.SubmitTransaction("BuyStock", req.Username, req.StockID, strconv.Itoa(req.Amount), req.Payment.Cents(), c.GetHeader(IdempotencyKeyHeader))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortTradeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Buy transaction submitted successfully"})
@@ -60,14 +100,14 @@ func SellStock(contract *client.Contract, c *gin.Context) {
 	}
 
 	// 调用智能合约的 SellStock 函数
-	result, err := contract.SubmitTransaction("SellStock", req.Username, req.StockID, strconv.Itoa(req.Amount))
+	result, err := contract.SubmitTransaction("SellStock", req.Username, req.StockID, strconv.Itoa(req.Amount), c.GetHeader(IdempotencyKeyHeader))
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortTradeError(c, err)
 		return
 	}
 	
 	// 解析返回的收入金额
-	revenue, err := strconv.ParseFloat(string(result), 64)
+	revenue, err := model.ParseCents(result)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse revenue value"})
 		return
@@ -87,7 +127,7 @@ func GetStockPrice(contract *client.Contract, c *gin.Context) {
 	}
 	
 	// 解析返回的价格
-	price, err := strconv.ParseFloat(string(result), 64)
+	price, err := model.ParseCents(result)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse price value"})
 		return
@@ -119,45 +159,23 @@ func GetUserStockCount(contract *client.Contract, c *gin.Context) {
 
 func GetUserStocks(contract *client.Contract, c *gin.Context) {
 	username := c.Param("username")
-	
-	// 调用智能合约的 GetUserStockCount 函数来获取每只股票的数量
-	// 但我们还需要一个方法来获取用户持有的所有股票ID
-	// 这里我们假设前端知道要查询哪些股票，或者我们提供一个获取所有股票的方法
-	
-	// 作为替代方案，我们可以添加一个 GetAllStockIDs 方法到智能合约中
-	// 或者在这里查询所有股票然后逐一检查用户是否持有
-	
-	// 目前直接使用 GetUserStockCount 对每只股票进行查询
-	// 更好的方法是在智能合约中添加一个 GetUserStocks 方法
-	
-	// 为了保持一致性，这里暂时保留原逻辑，但建议在智能合约中添加 GetUserStocks 方法
-	result, err := contract.EvaluateTransaction("GetAllStock")
+
+	// 调用智能合约的 GetUserStocks 函数，一次查询返回用户的全部持仓
+	result, err := contract.EvaluateTransaction("GetUserStocks", username)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var allStocks map[string]interface{}
-	_ = json.Unmarshal(result, &allStocks)
+	var positions []model.Holding
+	if err := json.Unmarshal(result, &positions); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user stocks"})
+		return
+	}
 
 	userStocks := make(map[string]int)
-	for key := range allStocks {
-		if len(key) > 6 && key[:6] == "stock_" {
-			stockID := key[6:] // 移除 "stock_" 前缀
-			countResult, err := contract.EvaluateTransaction("GetUserStockCount", username, stockID)
-			if err != nil {
-				continue // 用户可能不持有这只股票
-			}
-			
-			count, err := strconv.Atoi(string(countResult))
-			if err != nil {
-				continue
-			}
-			
-			if count > 0 { // 只返回持有数量大于0的股票
-				userStocks[stockID] = count
-			}
-		}
+	for _, position := range positions {
+		userStocks[position.Symbol] = position.Quantity
 	}
 
 	c.JSON(http.StatusOK, UserStocksResponse{Stocks: userStocks})
@@ -174,7 +192,7 @@ func GetUserTotalValue(contract *client.Contract, c *gin.Context) {
 	}
 	
 	// 解析返回的总价值
-	totalValue, err := strconv.ParseFloat(string(result), 64)
+	totalValue, err := model.ParseCents(result)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse total value"})
 		return
@@ -183,7 +201,102 @@ func GetUserTotalValue(contract *client.Contract, c *gin.Context) {
 	c.JSON(http.StatusOK, UserTotalValueResponse{TotalValue: totalValue})
 }
 
+func GetUserTrades(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+	start, end, ok := timeRange(c)
+	if !ok {
+		return
+	}
+
+	// 调用智能合约的 GetUserTrades 函数
+	result, err := contract.EvaluateTransaction("GetUserTrades", username, start, end)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ledgerTrades []model.Trade
+	if err := json.Unmarshal(result, &ledgerTrades); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse trades"})
+		return
+	}
+
+	trades := make([]model.TradeInfo, 0, len(ledgerTrades))
+	for _, trade := range ledgerTrades {
+		trades = append(trades, trade.Info())
+	}
+
+	c.JSON(http.StatusOK, UserTradesResponse{Trades: trades})
+}
+
+// GetUserCashEntries 按时间先后返回用户的入金、出金和现金转账流水
+func GetUserCashEntries(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetUserCashEntries 函数
+	result, err := contract.EvaluateTransaction("GetUserCashEntries", username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ledgerEntries []model.CashEntry
+	if err := json.Unmarshal(result, &ledgerEntries); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse cash entries"})
+		return
+	}
+
+	entries := make([]model.CashEntryInfo, 0, len(ledgerEntries))
+	for _, entry := range ledgerEntries {
+		entries = append(entries, entry.Info())
+	}
+
+	c.JSON(http.StatusOK, UserCashEntriesResponse{Entries: entries})
+}
+
+// timeRange 读取查询参数 start、end（RFC3339，可为空），格式错误时返回 400
+func timeRange(c *gin.Context) (start string, end string, ok bool) {
+	start = c.Query("start")
+	end = c.Query("end")
+	for _, bound := range []string{start, end} {
+		if bound == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339Nano, bound); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time %s, must be RFC3339", bound)})
+			return "", "", false
+		}
+	}
+	return start, end, true
+}
+
 func GetAllAssets(contract *client.Contract, c *gin.Context) {
+	pageSize, bookmark, paged, ok := pageQuery(c)
+	if !ok {
+		return
+	}
+
+	if paged {
+		// 调用智能合约的 GetAssetsPage 函数
+		result, err := contract.EvaluateTransaction("GetAssetsPage", pageSize, bookmark)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var page struct {
+			Assets   map[string]json.RawMessage `json:"assets"`
+			Bookmark string                     `json:"bookmark"`
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse assets"})
+			return
+		}
+
+		c.JSON(http.StatusOK, AssetsPageResponse{Assets: assetInfos(page.Assets), Bookmark: page.Bookmark})
+		return
+	}
+
 	// 调用智能合约的 GetAllAssets 函数
 	result, err := contract.EvaluateTransaction("GetAllAssets")
 	if err != nil {
@@ -191,61 +304,337 @@ func GetAllAssets(contract *client.Contract, c *gin.Context) {
 		return
 	}
 	
-	var assets map[string]interface{}
-	err = json.Unmarshal(result, &assets)
+	var rawAssets map[string]json.RawMessage
+	err = json.Unmarshal(result, &rawAssets)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse assets"})
 		return
 	}
 	
-	c.JSON(http.StatusOK, assets)
+	c.JSON(http.StatusOK, assetInfos(rawAssets))
+}
+
+// assetInfos 按键名前缀区分股票和用户，并将金额转换为两位小数
+func assetInfos(rawAssets map[string]json.RawMessage) map[string]interface{} {
+	assets := make(map[string]interface{})
+	for key, raw := range rawAssets {
+		if len(key) > 6 && key[:6] == "stock_" {
+			var stock model.StockToken
+			if err := json.Unmarshal(raw, &stock); err != nil {
+				continue
+			}
+			assets[key] = stock.Info()
+		} else if len(key) > 5 && key[:5] == "user_" {
+			var user model.UserAccount
+			if err := json.Unmarshal(raw, &user); err != nil {
+				continue
+			}
+			assets[key] = user.Info()
+		}
+	}
+	return assets
 }
 
 func GetAllStocks(contract *client.Contract, c *gin.Context) {
-	// 调用智能合约的 GetAllStock 函数
-	result, err := contract.EvaluateTransaction("GetAllStock")
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	pageSize, bookmark, paged, ok := pageQuery(c)
+	if !ok {
 		return
 	}
-	
-	var stocks map[string]interface{}
-	err = json.Unmarshal(result, &stocks)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stocks"})
+
+	var ledgerStocks map[string]model.StockToken
+	var next string
+	if paged {
+		// 调用智能合约的 GetStocksPage 函数
+		result, err := contract.EvaluateTransaction("GetStocksPage", pageSize, bookmark)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var page struct {
+			Stocks   map[string]model.StockToken `json:"stocks"`
+			Bookmark string                      `json:"bookmark"`
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stocks"})
+			return
+		}
+		ledgerStocks, next = page.Stocks, page.Bookmark
+	} else {
+		// 调用智能合约的 GetAllStock 函数
+		result, err := contract.EvaluateTransaction("GetAllStock")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := json.Unmarshal(result, &ledgerStocks); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stocks"})
+			return
+		}
+	}
+
+	stocks := make(map[string]model.StockInfo, len(ledgerStocks))
+	for key, stock := range ledgerStocks {
+		stocks[key] = stock.Info()
+	}
+
+	if paged {
+		c.JSON(http.StatusOK, StocksPageResponse{Stocks: stocks, Bookmark: next})
 		return
 	}
-	
 	c.JSON(http.StatusOK, stocks)
 }
 
 func GetAllUsers(contract *client.Contract, c *gin.Context) {
-	// 调用智能合约的 GetAllUser 函数
-	result, err := contract.EvaluateTransaction("GetAllUser")
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	pageSize, bookmark, paged, ok := pageQuery(c)
+	if !ok {
 		return
 	}
-	
-	var users map[string]interface{}
-	err = json.Unmarshal(result, &users)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse users"})
+
+	var ledgerUsers map[string]model.UserAccount
+	var next string
+	if paged {
+		// 调用智能合约的 GetUsersPage 函数
+		result, err := contract.EvaluateTransaction("GetUsersPage", pageSize, bookmark)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var page struct {
+			Users    map[string]model.UserAccount `json:"users"`
+			Bookmark string                       `json:"bookmark"`
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse users"})
+			return
+		}
+		ledgerUsers, next = page.Users, page.Bookmark
+	} else {
+		// 调用智能合约的 GetAllUser 函数
+		result, err := contract.EvaluateTransaction("GetAllUser")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := json.Unmarshal(result, &ledgerUsers); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse users"})
+			return
+		}
+	}
+
+	users := make(map[string]model.UserInfo, len(ledgerUsers))
+	for key, user := range ledgerUsers {
+		users[key] = user.Info()
+	}
+
+	if paged {
+		c.JSON(http.StatusOK, UsersPageResponse{Users: users, Bookmark: next})
 		return
 	}
-	
 	c.JSON(http.StatusOK, users)
 }
 
+// pageQuery 读取 page_size 和 bookmark 查询参数。
+// 未传 page_size 时 paged 为 false，接口按原样返回全部数据；参数非法时已写入 400 响应，ok 为 false。
+func pageQuery(c *gin.Context) (pageSize string, bookmark string, paged bool, ok bool) {
+	pageSize = c.Query("page_size")
+	bookmark = c.Query("bookmark")
+	if pageSize == "" {
+		if bookmark != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "bookmark requires page_size"})
+			return "", "", false, false
+		}
+		return "", "", false, true
+	}
+
+	size, err := strconv.Atoi(pageSize)
+	if err != nil || size <= 0 || size > MaxPageSize {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("page_size must be between 1 and %d", MaxPageSize)})
+		return "", "", false, false
+	}
+	return strconv.Itoa(size), bookmark, true, true
+}
+
 func CloseAccount(contract *client.Contract, c *gin.Context) {
 	username := c.Param("username")
+	// payout 为空时账户必须已清空持仓和余额，否则清仓后余额转入 payout 账户
+	payout := c.Query("payout")
 	
 	// 调用智能合约的 CloseAccount 函数
-	_, err := contract.SubmitTransaction("CloseAccount", username)
+	_, err := contract.SubmitTransaction("CloseAccount", username, payout)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Account %s closed successfully", username)})
+}
+
+func GetClosedAccount(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	// 调用智能合约的 GetClosedAccount 函数
+	result, err := contract.EvaluateTransaction("GetClosedAccount", username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var closed model.ClosedAccount
+	if err := json.Unmarshal(result, &closed); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse closed account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, closed.Info())
+}
+
+func CreateUser(contract *client.Contract, c *gin.Context) {
+	var req model.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	details, err := json.Marshal(model.AccountDetails{InitialBalance: int64(req.InitialBalance), RealName: req.RealName, Email: req.Email})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 CreateUser 函数，初始余额和个人资料通过 transient map 传入，不写入交易参数
+	_, err = submitPrivate(contract, "CreateUser", map[string][]byte{"account": details}, req.Username)
+	if err != nil {
+		// 用户令牌只能开立零余额账户，初始资金由管理员入金
+		if strings.Contains(err.Error(), "caller is not an admin") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "initial_balance requires an admin deposit"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Account %s created successfully", req.Username)})
+}
+
+func Deposit(contract *client.Contract, c *gin.Context) {
+	submitCash(contract, c, "Deposit")
+}
+
+func Withdraw(contract *client.Contract, c *gin.Context) {
+	submitCash(contract, c, "Withdraw")
+}
+
+// submitCash 调用 Deposit / Withdraw，返回变更后该币种的余额
+func submitCash(contract *client.Contract, c *gin.Context, function string) {
+	username := c.Param("username")
+
+	var req model.CashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 金额通过 transient map 传入，不写入交易参数
+	result, err := submitPrivate(contract, function, map[string][]byte{"amount": []byte(req.Amount.Cents())}, username, req.Currency, req.Reason)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := model.ParseCents(result)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse balance value"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BalanceResponse{Balance: balance})
+}
+
+func UpdateAccountDetails(contract *client.Contract, c *gin.Context) {
+	username := c.Param("username")
+
+	var req model.AccountDetailsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	details, err := json.Marshal(model.AccountDetails{RealName: req.RealName, Email: req.Email})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 UpdateAccountDetails 函数
+	_, err = submitPrivate(contract, "UpdateAccountDetails", map[string][]byte{"account": details}, username)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Account %s updated successfully", username)})
+}
+
+// submitPrivate 提交携带私有数据的交易：私有数据放在 transient map 中，只由私有数据集合成员组织背书
+func submitPrivate(contract *client.Contract, function string, transient map[string][]byte, args ...string) ([]byte, error) {
+	return contract.Submit(function,
+		client.WithArguments(args...),
+		client.WithTransient(transient),
+		client.WithEndorsingOrganizations(config.MspID),
+	)
+}
+
+func MigrateLegacyAmounts(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateLegacyAmounts 函数，将旧的浮点金额迁移为分
+	result, err := contract.SubmitTransaction("MigrateLegacyAmounts")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
+}
+
+func MigrateStorageLayout(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateStorageLayout 函数，将旧的字符串拼接键迁移为复合键
+	result, err := contract.SubmitTransaction("MigrateStorageLayout")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
+}
+
+func MigrateUserPrivateData(contract *client.Contract, c *gin.Context) {
+	// 调用智能合约的 MigrateUserPrivateData 函数，将公共账本上的余额和历史迁移到私有数据集合
+	result, err := submitPrivate(contract, "MigrateUserPrivateData", nil)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	migrated, err := strconv.Atoi(string(result))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse migrated count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"migrated": migrated})
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/model"
+)
+
+func TransferShares(contract *client.Contract, c *gin.Context) {
+	var req model.TransferSharesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 TransferShares 函数
+	_, err := contract.SubmitTransaction("TransferShares", req.From, req.To, req.StockID, strconv.Itoa(req.Amount))
+	if err != nil {
+		abortTradeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share transfer submitted successfully"})
+}
+
+func TransferCash(contract *client.Contract, c *gin.Context) {
+	var req model.TransferCashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 调用智能合约的 TransferCash 函数，金额通过 transient map 传入，不写入交易参数
+	_, err := submitPrivate(contract, "TransferCash", map[string][]byte{"amount": []byte(req.Amount.Cents())}, req.From, req.To, req.Currency)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cash transfer submitted successfully"})
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"server/config"
+	"server/event"
 	"server/handler"
 	"server/middleware"
+	"server/service"
 )
 
 func main() {
@@ -32,24 +35,48 @@ func main() {
 	network := gw.GetNetwork(config.ChannelName)
 	contract := network.GetContract(config.ChaincodeName)
 
+	// 管理员身份的 Gateway 连接，用于上市、调价、退市等管理操作
+	adminGw, err := client.Connect(
+		config.NewAdminIdentity(),
+		client.WithSign(config.NewAdminSign()),
+		client.WithClientConnection(conn),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to gateway as admin: %v", err)
+	}
+	defer adminGw.Close()
+
+	adminContract := adminGw.GetNetwork(config.ChannelName).GetContract(config.ChaincodeName)
+
+	// 订阅链码事件，推送给 SSE / WebSocket 客户端
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := event.NewBroker()
+	go event.Listen(ctx, network, config.ChaincodeName, broker)
+
 	r := gin.Default()
 
 	// 添加请求日志中间件
 	r.Use(middleware.RequestLogger())
 
-	// 初始化账本
-	r.POST("/init", func(c *gin.Context) {
-		handler.InitLedger(contract, c)
-	})
+	// 用户接口：需要用户令牌，并以该用户的身份提交交易，链码据此校验账户归属
+	pool := service.NewContractPool(conn)
+	defer pool.Close()
+	user := r.Group("", middleware.UserAuth(middleware.LoadUserTokens(), pool))
 
 	// 买入股票
-	r.POST("/buy", func(c *gin.Context) {
-		handler.BuyStock(contract, c)
+	user.POST("/buy", func(c *gin.Context) {
+		handler.BuyStock(middleware.UserContract(c), c)
 	})
 
 	// 卖出股票
-	r.POST("/sell", func(c *gin.Context) {
-		handler.SellStock(contract, c)
+	user.POST("/sell", func(c *gin.Context) {
+		handler.SellStock(middleware.UserContract(c), c)
+	})
+
+	// 篮子委托：一笔交易内买卖多只股票，全部成交或全部不成交
+	user.POST("/basket", func(c *gin.Context) {
+		handler.SubmitBasket(middleware.UserContract(c), c)
 	})
 
 	// 查询股价
@@ -57,6 +84,11 @@ func main() {
 		handler.GetStockPrice(contract, c)
 	})
 
+	// 查询 K 线，interval 为 1m / 1h / 1d
+	r.GET("/price/:stockID/history", func(c *gin.Context) {
+		handler.GetPriceHistory(contract, c)
+	})
+
 	// 查询用户持仓数量
 	r.GET("/user/:username/stocks/:stockID", func(c *gin.Context) {
 		handler.GetUserStockCount(contract, c)
@@ -67,14 +99,74 @@ func main() {
 		handler.GetUserStocks(contract, c)
 	})
 
-	// 查询用户总资产
-	r.GET("/user/:username/value", func(c *gin.Context) {
-		handler.GetUserTotalValue(contract, c)
+	// 查询用户总资产，只限账户本人
+	user.GET("/user/:username/value", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetUserTotalValue(middleware.UserContract(c), c)
+	})
+
+	// 查询用户资产估值，按汇率折算为 currency 计价，只限账户本人
+	user.GET("/user/:username/valuation", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetUserValuation(middleware.UserContract(c), c)
+	})
+
+	// 查询用户各持仓的已实现和未实现盈亏，只限账户本人
+	user.GET("/user/:username/pnl", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetUserPnL(middleware.UserContract(c), c)
+	})
+
+	// 查询用户交易记录，可按 start / end 时间过滤，只限账户本人
+	user.GET("/user/:username/trades", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetUserTrades(middleware.UserContract(c), c)
+	})
+
+	// 查询用户的入金、出金和现金转账流水，只限账户本人
+	user.GET("/user/:username/cash", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetUserCashEntries(middleware.UserContract(c), c)
+	})
+
+	// 查询用户收到的派息记录
+	r.GET("/user/:username/dividends", func(c *gin.Context) {
+		handler.GetUserDividends(contract, c)
+	})
+
+	// 查询手续费配置
+	r.GET("/fees", func(c *gin.Context) {
+		handler.GetFeeSchedule(contract, c)
+	})
+
+	// 预估手续费
+	r.GET("/fees/quote", func(c *gin.Context) {
+		handler.QuoteFee(contract, c)
+	})
+
+	// 查询汇率
+	r.GET("/fx", func(c *gin.Context) {
+		handler.GetFXRates(contract, c)
 	})
 
-	// 获取账本中所有资产（股票 + 用户）
-	r.GET("/assets", func(c *gin.Context) {
-		handler.GetAllAssets(contract, c)
+	// 查询熔断阈值
+	r.GET("/circuit-breaker", func(c *gin.Context) {
+		handler.GetCircuitBreaker(contract, c)
+	})
+
+	// 查询分红宣布记录
+	r.GET("/dividends/:declarationID", func(c *gin.Context) {
+		handler.GetDividend(contract, c)
+	})
+
+	// 查询已销户账户的墓碑记录
+	r.GET("/user/:username/closed", func(c *gin.Context) {
+		handler.GetClosedAccount(contract, c)
+	})
+
+	// 审计：用户账户记录的历史版本及逐版本差异
+	r.GET("/audit/user/:username", func(c *gin.Context) {
+		handler.GetUserAudit(contract, c)
+	})
+
+	// 审计：股票记录的历史版本及逐版本差异
+	r.GET("/audit/stock/:stockID", func(c *gin.Context) {
+		handler.GetStockAudit(contract, c)
 	})
 
 	// 获取账本中所有股票
@@ -82,14 +174,205 @@ func main() {
 		handler.GetAllStocks(contract, c)
 	})
 
-	// 获取账本中所有用户
-	r.GET("/users", func(c *gin.Context) {
-		handler.GetAllUsers(contract, c)
+	// 查询某只股票的股东名册
+	r.GET("/stocks/:stockID/holders", func(c *gin.Context) {
+		handler.GetStockHolders(contract, c)
+	})
+
+	// 提交限价委托
+	user.POST("/orders", func(c *gin.Context) {
+		handler.PlaceOrder(middleware.UserContract(c), c)
+	})
+
+	// 查询某只股票的买卖盘
+	r.GET("/orders/book/:stockID", func(c *gin.Context) {
+		handler.GetOrderBook(contract, c)
+	})
+
+	// 查询订单
+	r.GET("/orders/:orderID", func(c *gin.Context) {
+		handler.GetOrder(contract, c)
+	})
+
+	// 按客户端订单号（Idempotency-Key）查询请求是否已执行，只限账户本人
+	user.GET("/user/:username/client-orders/:clientOrderID", middleware.OwnerOnly(), func(c *gin.Context) {
+		handler.GetClientOrder(middleware.UserContract(c), c)
+	})
+
+	// 撤销订单
+	user.DELETE("/orders/:orderID", func(c *gin.Context) {
+		handler.CancelOrder(middleware.UserContract(c), c)
+	})
+
+	// 开户
+	user.POST("/users", func(c *gin.Context) {
+		handler.CreateUser(middleware.UserContract(c), c)
+	})
+
+	// 出金
+	user.POST("/user/:username/withdraw", func(c *gin.Context) {
+		handler.Withdraw(middleware.UserContract(c), c)
+	})
+
+	// 设置成本计算方法
+	user.PUT("/user/:username/cost-basis", func(c *gin.Context) {
+		handler.SetCostBasisMethod(middleware.UserContract(c), c)
+	})
+
+	// 更新账户个人资料
+	user.PUT("/user/:username/details", func(c *gin.Context) {
+		handler.UpdateAccountDetails(middleware.UserContract(c), c)
+	})
+
+	// 用户之间转让股票
+	user.POST("/transfer/shares", func(c *gin.Context) {
+		handler.TransferShares(middleware.UserContract(c), c)
+	})
+
+	// 用户之间转账
+	user.POST("/transfer/cash", func(c *gin.Context) {
+		handler.TransferCash(middleware.UserContract(c), c)
+	})
+
+	// 关闭用户账户，可用 payout 参数指定清仓后余额转入的账户
+	user.DELETE("/user/:username", func(c *gin.Context) {
+		handler.CloseAccount(middleware.UserContract(c), c)
+	})
+
+	// 以 Server-Sent Events 推送链码事件
+	r.GET("/events", func(c *gin.Context) {
+		handler.StreamEvents(broker, c)
+	})
+
+	// 以 WebSocket 推送链码事件
+	r.GET("/events/ws", func(c *gin.Context) {
+		handler.StreamEventsWebSocket(broker, c)
+	})
+
+	// 管理接口：需要管理员令牌，并以管理员身份提交交易
+	admin := r.Group("/admin", middleware.AdminAuth())
+
+	// 初始化空账本，已初始化的账本拒绝重置
+	admin.POST("/init", func(c *gin.Context) {
+		handler.InitLedger(adminContract, c)
+	})
+
+	// 获取账本中所有资产（股票 + 用户），包含各用户余额
+	admin.GET("/assets", func(c *gin.Context) {
+		handler.GetAllAssets(adminContract, c)
+	})
+
+	// 获取账本中所有用户，包含各用户余额
+	admin.GET("/users", func(c *gin.Context) {
+		handler.GetAllUsers(adminContract, c)
+	})
+
+	// 上市新股票
+	admin.POST("/stocks", func(c *gin.Context) {
+		handler.ListStock(adminContract, c)
+	})
+
+	// 调整股价
+	admin.PUT("/stocks/:stockID/price", func(c *gin.Context) {
+		handler.SetStockPrice(adminContract, c)
+	})
+
+	// 入金：确认银行到账、活动赠送或调账
+	admin.POST("/users/:username/deposit", func(c *gin.Context) {
+		handler.Deposit(adminContract, c)
+	})
+
+	// 将账户绑定到用户的证书身份
+	admin.POST("/users/:username/bind", func(c *gin.Context) {
+		handler.BindAccount(adminContract, pool, c)
+	})
+
+	// 宣布现金分红
+	admin.POST("/stocks/:stockID/dividends", func(c *gin.Context) {
+		handler.DeclareDividend(adminContract, c)
+	})
+
+	// 拆股或合股
+	admin.POST("/stocks/:stockID/split", func(c *gin.Context) {
+		handler.SplitStock(adminContract, c)
+	})
+
+	// 停牌
+	admin.POST("/stocks/:stockID/halt", func(c *gin.Context) {
+		handler.HaltStock(adminContract, c)
+	})
+
+	// 复牌
+	admin.POST("/stocks/:stockID/resume", func(c *gin.Context) {
+		handler.ResumeStock(adminContract, c)
+	})
+
+	// 设置熔断阈值
+	admin.PUT("/circuit-breaker", func(c *gin.Context) {
+		handler.SetCircuitBreaker(adminContract, c)
+	})
+
+	// 设置手续费账户和默认费率
+	admin.PUT("/fees", func(c *gin.Context) {
+		handler.SetFeeSchedule(adminContract, c)
+	})
+
+	// 设置或删除单只股票的费率
+	admin.PUT("/fees/:stockID", func(c *gin.Context) {
+		handler.SetSymbolFee(adminContract, c)
+	})
+	admin.DELETE("/fees/:stockID", func(c *gin.Context) {
+		handler.RemoveSymbolFee(adminContract, c)
+	})
+
+	// 设置汇率
+	admin.PUT("/fx/:currency", func(c *gin.Context) {
+		handler.SetFXRate(adminContract, c)
+	})
+
+	// 退市
+	admin.DELETE("/stocks/:stockID", func(c *gin.Context) {
+		handler.DelistStock(adminContract, c)
+	})
+
+	// 核对账本不变量：各股票股份总量与发行总量相符，余额和持仓不为负
+	admin.GET("/audit", func(c *gin.Context) {
+		handler.AuditLedger(adminContract, c)
+	})
+
+	// 富查询：按 CouchDB 查询条件检索持仓、股票和用户余额
+	admin.POST("/query", func(c *gin.Context) {
+		handler.RunQuery(adminContract, c)
+	})
+
+	// 将旧账本中的浮点金额迁移为分
+	admin.POST("/migrate/amounts", func(c *gin.Context) {
+		handler.MigrateLegacyAmounts(adminContract, c)
+	})
+
+	// 将旧的字符串拼接键迁移为复合键布局
+	admin.POST("/migrate/layout", func(c *gin.Context) {
+		handler.MigrateStorageLayout(adminContract, c)
+	})
+
+	// 将公共账本上的余额和历史迁移到私有数据集合
+	admin.POST("/migrate/private", func(c *gin.Context) {
+		handler.MigrateUserPrivateData(adminContract, c)
+	})
+
+	// 为旧记录补上富查询使用的 docType 字段
+	admin.POST("/migrate/query-fields", func(c *gin.Context) {
+		handler.MigrateQueryFields(adminContract, c)
+	})
+
+	// 根据现有持仓重建股东索引
+	admin.POST("/migrate/holders", func(c *gin.Context) {
+		handler.MigrateHolderIndex(adminContract, c)
 	})
 
-	// 关闭用户账户
-	r.DELETE("/user/:username", func(c *gin.Context) {
-		handler.CloseAccount(contract, c)
+	// 根据现有订单重建用户挂单索引
+	admin.POST("/migrate/orders", func(c *gin.Context) {
+		handler.MigrateOrderIndex(adminContract, c)
 	})
 
 	fmt.Println("Server running on :8080")
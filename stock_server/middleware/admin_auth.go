@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenEnv 管理员令牌所在的环境变量，未设置时拒绝所有管理请求
+const AdminTokenEnv = "STOCK_ADMIN_TOKEN"
+
+// AdminTokenHeader 客户端携带管理员令牌的请求头
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminAuth 校验管理员令牌，保护以管理员身份签名的接口
+func AdminAuth() gin.HandlerFunc {
+	token := os.Getenv(AdminTokenEnv)
+
+	return func(c *gin.Context) {
+		provided := c.GetHeader(AdminTokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin token required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"server/service"
+)
+
+// UserTokensEnv 用户令牌文件所在的环境变量，文件内容为 {"令牌": "用户名"}，未设置时拒绝所有用户请求
+const UserTokensEnv = "STOCK_USER_TOKENS_FILE"
+
+// UserTokenHeader 客户端携带用户令牌的请求头
+const UserTokenHeader = "X-User-Token"
+
+// contractKey 认证通过后写入 gin.Context 的合约
+const contractKey = "contract"
+
+// usernameKey 认证通过后写入 gin.Context 的用户名
+const usernameKey = "username"
+
+// LoadUserTokens 读取用户令牌文件，读取失败时返回空表
+func LoadUserTokens() map[string]string {
+	tokens := map[string]string{}
+
+	file := os.Getenv(UserTokensEnv)
+	if file == "" {
+		return tokens
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to read user tokens: %v", err)
+		return tokens
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		log.Printf("Failed to parse user tokens: %v", err)
+		return map[string]string{}
+	}
+	return tokens
+}
+
+// UserAuth 校验用户令牌，并选出以该用户身份签名的合约供后续处理使用
+func UserAuth(tokens map[string]string, pool *service.ContractPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := lookupToken(tokens, c.GetHeader(UserTokenHeader))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user token required"})
+			return
+		}
+
+		contract, err := pool.For(username)
+		if err != nil {
+			log.Printf("Failed to load identity of %s: %v", username, err)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no signing identity for user " + username})
+			return
+		}
+
+		c.Set(contractKey, contract)
+		c.Set(usernameKey, username)
+		c.Next()
+	}
+}
+
+// OwnerOnly 要求路径中的 :username 与令牌对应的用户一致，须在 UserAuth 之后使用。
+// 同一组织的所有客户端都能读取私有数据集合，查询余额的接口据此限制为账户本人
+func OwnerOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("username") != c.GetString(usernameKey) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "user token does not belong to " + c.Param("username")})
+			return
+		}
+		c.Next()
+	}
+}
+
+// lookupToken 逐个比较令牌，避免通过响应时间猜测令牌
+func lookupToken(tokens map[string]string, provided string) (string, bool) {
+	if provided == "" {
+		return "", false
+	}
+	username, found := "", false
+	for token, name := range tokens {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			username, found = name, true
+		}
+	}
+	return username, found
+}
+
+// UserContract 返回 UserAuth 选出的合约
+func UserContract(c *gin.Context) *client.Contract {
+	return c.MustGet(contractKey).(*client.Contract)
+}
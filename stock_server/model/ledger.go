@@ -0,0 +1,925 @@
+package model
+
+// StockToken 与链码中的 StockToken 对应，Price 单位为分；Quantity 为发行方尚未售出的数量，Supply 为发行总量
+type StockToken struct {
+	Symbol         string `json:"symbol"`
+	Price          int64  `json:"priceCents"`
+	Quantity       int    `json:"quantity"`
+	Supply         int    `json:"supply"`
+	Status         string `json:"status"`
+	HaltReason     string `json:"haltReason"`
+	ReferencePrice int64  `json:"referencePriceCents"`
+	ReferenceDate  string `json:"referenceDate"`
+	Currency       string `json:"currency"`
+}
+
+// UserAccount 与链码中的 UserAccount 对应，Balance 为基准币种 USD 的余额，Balances 为其他币种的余额，单位为分；
+// CostBasisMethod 为成本计算方法 fifo / average，为空视为 fifo。
+// Balance、Balances、History、RealName、Email 保存在私有数据集合中，非集合成员组织查询时为空
+type UserAccount struct {
+	Name            string           `json:"name"`
+	Stocks          map[string]int   `json:"stocks"`
+	Balance         int64            `json:"balanceCents"`
+	Balances        map[string]int64 `json:"balancesCents"`
+	History         []string         `json:"history"`
+	RealName        string           `json:"realName"`
+	Email           string           `json:"email"`
+	CostBasisMethod string           `json:"costBasisMethod"`
+}
+
+// StockInfo 返回给客户端的股票信息，金额为两位小数字符串
+type StockInfo struct {
+	Symbol     string `json:"symbol"`
+	Price      Amount `json:"price"`
+	Quantity   int    `json:"quantity"`
+	Supply     int    `json:"supply"`
+	Status     string `json:"status"`
+	Currency   string `json:"currency"`
+	HaltReason string `json:"halt_reason,omitempty"`
+}
+
+// UserInfo 返回给客户端的用户信息，金额为两位小数字符串；balance 为 USD 余额，balances 为其他币种的余额
+type UserInfo struct {
+	Name            string            `json:"name"`
+	Stocks          map[string]int    `json:"stocks"`
+	Balance         Amount            `json:"balance"`
+	Balances        map[string]Amount `json:"balances"`
+	History         []string          `json:"history"`
+	RealName        string            `json:"real_name,omitempty"`
+	Email           string            `json:"email,omitempty"`
+	CostBasisMethod string            `json:"cost_basis_method,omitempty"`
+}
+
+// Info 转换为客户端视图
+func (s StockToken) Info() StockInfo {
+	currency := s.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return StockInfo{Symbol: s.Symbol, Price: Amount(s.Price), Quantity: s.Quantity, Supply: s.Supply, Status: s.Status, Currency: currency, HaltReason: s.HaltReason}
+}
+
+// Info 转换为客户端视图
+func (u UserAccount) Info() UserInfo {
+	balances := make(map[string]Amount, len(u.Balances))
+	for currency, cents := range u.Balances {
+		balances[currency] = Amount(cents)
+	}
+	return UserInfo{Name: u.Name, Stocks: u.Stocks, Balance: Amount(u.Balance), Balances: balances, History: u.History, RealName: u.RealName, Email: u.Email, CostBasisMethod: u.CostBasisMethod}
+}
+
+// Order 与链码中的 Order 对应，Price 单位为分
+type Order struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Price         int64  `json:"priceCents"`
+	Quantity      int    `json:"quantity"`
+	Remaining     int    `json:"remaining"`
+	Status        string `json:"status"`
+	FeeReserved   int64  `json:"feeReservedCents"`
+	Timestamp     string `json:"timestamp"`
+	ClientOrderID string `json:"clientOrderId"`
+}
+
+// Fill 与链码中的 Fill 对应，Price 单位为分
+type Fill struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	BuyOrderID  string `json:"buyOrderId"`
+	SellOrderID string `json:"sellOrderId"`
+	Buyer       string `json:"buyer"`
+	Seller      string `json:"seller"`
+	Price       int64  `json:"priceCents"`
+	Quantity    int    `json:"quantity"`
+	BuyerFee    int64  `json:"buyerFeeCents"`
+	SellerFee   int64  `json:"sellerFeeCents"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// OrderInfo 返回给客户端的订单信息
+type OrderInfo struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Price         Amount `json:"price"`
+	Quantity      int    `json:"quantity"`
+	Remaining     int    `json:"remaining"`
+	Status        string `json:"status"`
+	FeeReserved   Amount `json:"fee_reserved"`
+	Timestamp     string `json:"timestamp"`
+	ClientOrderID string `json:"client_order_id,omitempty"`
+}
+
+// FillInfo 返回给客户端的成交信息
+type FillInfo struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	BuyOrderID  string `json:"buy_order_id"`
+	SellOrderID string `json:"sell_order_id"`
+	Buyer       string `json:"buyer"`
+	Seller      string `json:"seller"`
+	Price       Amount `json:"price"`
+	Quantity    int    `json:"quantity"`
+	BuyerFee    Amount `json:"buyer_fee"`
+	SellerFee   Amount `json:"seller_fee"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// Info 转换为客户端视图
+func (o Order) Info() OrderInfo {
+	return OrderInfo{
+		ID:            o.ID,
+		Username:      o.Username,
+		Symbol:        o.Symbol,
+		Side:          o.Side,
+		Price:         Amount(o.Price),
+		Quantity:      o.Quantity,
+		Remaining:     o.Remaining,
+		Status:        o.Status,
+		FeeReserved:   Amount(o.FeeReserved),
+		Timestamp:     o.Timestamp,
+		ClientOrderID: o.ClientOrderID,
+	}
+}
+
+// Info 转换为客户端视图
+func (f Fill) Info() FillInfo {
+	return FillInfo{
+		ID:          f.ID,
+		Symbol:      f.Symbol,
+		BuyOrderID:  f.BuyOrderID,
+		SellOrderID: f.SellOrderID,
+		Buyer:       f.Buyer,
+		Seller:      f.Seller,
+		Price:       Amount(f.Price),
+		Quantity:    f.Quantity,
+		BuyerFee:    Amount(f.BuyerFee),
+		SellerFee:   Amount(f.SellerFee),
+		Timestamp:   f.Timestamp,
+	}
+}
+
+// Trade 与链码中的 Trade 对应，金额单位为分
+type Trade struct {
+	ID           string `json:"id"`
+	TxID         string `json:"txId"`
+	Username     string `json:"username"`
+	Side         string `json:"side"`
+	Symbol       string `json:"symbol"`
+	Quantity     int    `json:"quantity"`
+	Price        int64  `json:"priceCents"`
+	Amount       int64  `json:"amountCents"`
+	Fee          int64  `json:"feeCents"`
+	Realized     int64  `json:"realizedCents"`
+	Currency     string `json:"currency"`
+	Counterparty string `json:"counterparty"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// TradeInfo 返回给客户端的交易记录
+type TradeInfo struct {
+	ID           string `json:"id"`
+	TxID         string `json:"tx_id"`
+	Username     string `json:"username"`
+	Side         string `json:"side"`
+	Symbol       string `json:"symbol"`
+	Quantity     int    `json:"quantity"`
+	Price        Amount `json:"price"`
+	Amount       Amount `json:"amount"`
+	Fee          Amount `json:"fee"`
+	Realized     Amount `json:"realized"`
+	Currency     string `json:"currency"`
+	Counterparty string `json:"counterparty"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// Info 转换为客户端视图
+func (t Trade) Info() TradeInfo {
+	return TradeInfo{
+		ID:           t.ID,
+		TxID:         t.TxID,
+		Username:     t.Username,
+		Side:         t.Side,
+		Symbol:       t.Symbol,
+		Quantity:     t.Quantity,
+		Price:        Amount(t.Price),
+		Amount:       Amount(t.Amount),
+		Fee:          Amount(t.Fee),
+		Realized:     Amount(t.Realized),
+		Currency:     t.Currency,
+		Counterparty: t.Counterparty,
+		Timestamp:    t.Timestamp,
+	}
+}
+
+// CashEntry 与链码中的现金流水对应，金额单位为分，只有集合成员组织内的账户本人和管理员能读到金额
+type CashEntry struct {
+	ID           string `json:"id"`
+	TxID         string `json:"txId"`
+	Username     string `json:"username"`
+	Kind         string `json:"kind"`
+	Currency     string `json:"currency"`
+	Reason       string `json:"reason"`
+	Counterparty string `json:"counterparty"`
+	Timestamp    string `json:"timestamp"`
+	Amount       int64  `json:"amountCents"`
+	AmountHash   string `json:"amountHash"`
+}
+
+// CashEntryInfo 返回给客户端的现金流水
+type CashEntryInfo struct {
+	ID           string `json:"id"`
+	TxID         string `json:"tx_id"`
+	Username     string `json:"username"`
+	Kind         string `json:"kind"`
+	Amount       Amount `json:"amount"`
+	Currency     string `json:"currency"`
+	Reason       string `json:"reason"`
+	Counterparty string `json:"counterparty"`
+	Timestamp    string `json:"timestamp"`
+	AmountHash   string `json:"amount_hash"`
+}
+
+// Info 转换为客户端视图
+func (e CashEntry) Info() CashEntryInfo {
+	return CashEntryInfo{
+		ID:           e.ID,
+		TxID:         e.TxID,
+		Username:     e.Username,
+		Kind:         e.Kind,
+		Amount:       Amount(e.Amount),
+		Currency:     e.Currency,
+		Reason:       e.Reason,
+		Counterparty: e.Counterparty,
+		Timestamp:    e.Timestamp,
+		AmountHash:   e.AmountHash,
+	}
+}
+
+// StockEvent 与链码事件负载对应，金额单位为分，不包含余额等私有数据
+type StockEvent struct {
+	Type         string `json:"type"`
+	TxID         string `json:"txId"`
+	Username     string `json:"username"`
+	Counterparty string `json:"counterparty"`
+	Symbol       string `json:"symbol"`
+	Quantity     int    `json:"quantity"`
+	Price        int64  `json:"priceCents"`
+	Amount       int64  `json:"amountCents"`
+	Fee          int64  `json:"feeCents"`
+	Currency     string `json:"currency"`
+	Reason       string `json:"reason"`
+	Count        int    `json:"count"`
+	Order        *Order `json:"order"`
+	Fills        []Fill `json:"fills"`
+
+	FXRate          *FXRate         `json:"fxRate"`
+	CircuitBreaker  *CircuitBreaker `json:"circuitBreaker"`
+	Split           *SplitResult    `json:"split"`
+	CostBasisMethod string          `json:"costBasisMethod"`
+	Collector       string          `json:"collector"`
+}
+
+// EventInfo 推送给客户端的事件，未用到的字段省略
+type EventInfo struct {
+	Type         string     `json:"type"`
+	TxID         string     `json:"tx_id"`
+	BlockNumber  uint64     `json:"block_number"`
+	Username     string     `json:"username,omitempty"`
+	Counterparty string     `json:"counterparty,omitempty"`
+	Symbol       string     `json:"symbol,omitempty"`
+	Quantity     int        `json:"quantity,omitempty"`
+	Price        *Amount    `json:"price,omitempty"`
+	Amount       *Amount    `json:"amount,omitempty"`
+	Fee          *Amount    `json:"fee,omitempty"`
+	Currency     string     `json:"currency,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Count        int        `json:"count,omitempty"`
+	Order        *OrderInfo `json:"order,omitempty"`
+	Fills        []FillInfo `json:"fills,omitempty"`
+
+	// 以下字段只出现在对应类型的事件中
+	FXRate           *FXRateInfo `json:"fx_rate,omitempty"`           // FXRateSet
+	ThresholdPercent *Percent    `json:"threshold_percent,omitempty"` // CircuitBreakerSet，"0.00" 表示关闭熔断
+	Split            *SplitInfo  `json:"split,omitempty"`             // StockSplit
+	CostBasisMethod  string      `json:"cost_basis_method,omitempty"` // CostBasisMethodSet
+	Collector        string      `json:"collector,omitempty"`         // FeeScheduleSet
+}
+
+// Info 转换为客户端视图
+func (e StockEvent) Info() EventInfo {
+	info := EventInfo{
+		Type:         e.Type,
+		TxID:         e.TxID,
+		Username:     e.Username,
+		Counterparty: e.Counterparty,
+		Symbol:       e.Symbol,
+		Quantity:     e.Quantity,
+		Currency:     e.Currency,
+		Reason:       e.Reason,
+		Count:        e.Count,
+
+		CostBasisMethod: e.CostBasisMethod,
+		Collector:       e.Collector,
+	}
+	if e.Price != 0 {
+		price := Amount(e.Price)
+		info.Price = &price
+	}
+	if e.Amount != 0 {
+		amount := Amount(e.Amount)
+		info.Amount = &amount
+	}
+	if e.Fee != 0 {
+		fee := Amount(e.Fee)
+		info.Fee = &fee
+	}
+	if e.Order != nil {
+		order := e.Order.Info()
+		info.Order = &order
+	}
+	for _, fill := range e.Fills {
+		info.Fills = append(info.Fills, fill.Info())
+	}
+	if e.FXRate != nil {
+		rate := e.FXRate.Info()
+		info.FXRate = &rate
+	}
+	if e.CircuitBreaker != nil {
+		threshold := Percent(e.CircuitBreaker.ThresholdBasisPoints)
+		info.ThresholdPercent = &threshold
+	}
+	if e.Split != nil {
+		split := e.Split.Info()
+		info.Split = &split
+	}
+	return info
+}
+
+// ClosedAccount 与链码中的销户墓碑记录对应
+type ClosedAccount struct {
+	Name          string `json:"name"`
+	OwnerMSP      string `json:"ownerMsp"`
+	OwnerID       string `json:"ownerId"`
+	PayoutAccount string `json:"payoutAccount"`
+	TxID          string `json:"txId"`
+	ClosedAt      string `json:"closedAt"`
+}
+
+// ClosedAccountInfo 返回给客户端的销户信息
+type ClosedAccountInfo struct {
+	Name          string `json:"name"`
+	PayoutAccount string `json:"payout_account"`
+	TxID          string `json:"tx_id"`
+	ClosedAt      string `json:"closed_at"`
+}
+
+// Info 转换为客户端视图
+func (a ClosedAccount) Info() ClosedAccountInfo {
+	return ClosedAccountInfo{Name: a.Name, PayoutAccount: a.PayoutAccount, TxID: a.TxID, ClosedAt: a.ClosedAt}
+}
+
+// DividendDeclaration 与链码中的 DividendDeclaration 对应，金额单位为分
+type DividendDeclaration struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	PerShare    int64  `json:"perShareCents"`
+	RecordDate  string `json:"recordDate"`
+	Holders     int    `json:"holders"`
+	TotalShares int    `json:"totalShares"`
+	Total       int64  `json:"totalCents"`
+	Currency    string `json:"currency"`
+	TxID        string `json:"txId"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// DividendInfo 返回给客户端的分红宣布信息
+type DividendInfo struct {
+	ID          string `json:"id"`
+	Symbol      string `json:"symbol"`
+	PerShare    Amount `json:"per_share"`
+	RecordDate  string `json:"record_date"`
+	Holders     int    `json:"holders"`
+	TotalShares int    `json:"total_shares"`
+	Total       Amount `json:"total"`
+	Currency    string `json:"currency"`
+	TxID        string `json:"tx_id"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// Info 转换为客户端视图
+func (d DividendDeclaration) Info() DividendInfo {
+	return DividendInfo{
+		ID:          d.ID,
+		Symbol:      d.Symbol,
+		PerShare:    Amount(d.PerShare),
+		RecordDate:  d.RecordDate,
+		Holders:     d.Holders,
+		TotalShares: d.TotalShares,
+		Total:       Amount(d.Total),
+		Currency:    d.Currency,
+		TxID:        d.TxID,
+		Timestamp:   d.Timestamp,
+	}
+}
+
+// DividendPayment 与链码中的 DividendPayment 对应，金额单位为分
+type DividendPayment struct {
+	DeclarationID string `json:"declarationId"`
+	Username      string `json:"username"`
+	Symbol        string `json:"symbol"`
+	Shares        int    `json:"shares"`
+	PerShare      int64  `json:"perShareCents"`
+	Amount        int64  `json:"amountCents"`
+	Currency      string `json:"currency"`
+	RecordDate    string `json:"recordDate"`
+	TxID          string `json:"txId"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// DividendPaymentInfo 返回给客户端的派息记录
+type DividendPaymentInfo struct {
+	DeclarationID string `json:"declaration_id"`
+	Symbol        string `json:"symbol"`
+	Shares        int    `json:"shares"`
+	PerShare      Amount `json:"per_share"`
+	Amount        Amount `json:"amount"`
+	Currency      string `json:"currency"`
+	RecordDate    string `json:"record_date"`
+	TxID          string `json:"tx_id"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// Info 转换为客户端视图
+func (p DividendPayment) Info() DividendPaymentInfo {
+	return DividendPaymentInfo{
+		DeclarationID: p.DeclarationID,
+		Symbol:        p.Symbol,
+		Shares:        p.Shares,
+		PerShare:      Amount(p.PerShare),
+		Amount:        Amount(p.Amount),
+		Currency:      p.Currency,
+		RecordDate:    p.RecordDate,
+		TxID:          p.TxID,
+		Timestamp:     p.Timestamp,
+	}
+}
+
+// CircuitBreaker 与链码中的熔断配置对应，阈值单位为基点（万分之一）
+type CircuitBreaker struct {
+	ThresholdBasisPoints int64 `json:"thresholdBasisPoints"`
+}
+
+// SplitResult 与链码中的 SplitResult 对应，金额单位为分
+type SplitResult struct {
+	Symbol      string `json:"symbol"`
+	Numerator   int    `json:"numerator"`
+	Denominator int    `json:"denominator"`
+	OldPrice    int64  `json:"oldPriceCents"`
+	NewPrice    int64  `json:"newPriceCents"`
+	Holders     int    `json:"holders"`
+	Cancelled   int    `json:"cancelledOrders"`
+	CashInLieu  int64  `json:"cashInLieuCents"`
+}
+
+// SplitInfo 返回给客户端的拆股结果
+type SplitInfo struct {
+	Symbol          string `json:"symbol"`
+	Numerator       int    `json:"numerator"`
+	Denominator     int    `json:"denominator"`
+	OldPrice        Amount `json:"old_price"`
+	NewPrice        Amount `json:"new_price"`
+	Holders         int    `json:"holders"`
+	CancelledOrders int    `json:"cancelled_orders"`
+	CashInLieu      Amount `json:"cash_in_lieu"`
+}
+
+// Info 转换为客户端视图
+func (r SplitResult) Info() SplitInfo {
+	return SplitInfo{
+		Symbol:          r.Symbol,
+		Numerator:       r.Numerator,
+		Denominator:     r.Denominator,
+		OldPrice:        Amount(r.OldPrice),
+		NewPrice:        Amount(r.NewPrice),
+		Holders:         r.Holders,
+		CancelledOrders: r.Cancelled,
+		CashInLieu:      Amount(r.CashInLieu),
+	}
+}
+
+// FeeRate 与链码中的 FeeRate 对应，金额单位为分
+type FeeRate struct {
+	Flat        int64 `json:"flatCents"`
+	BasisPoints int   `json:"basisPoints"`
+	Minimum     int64 `json:"minimumCents"`
+}
+
+// FeeSchedule 与链码中的 FeeSchedule 对应
+type FeeSchedule struct {
+	Collector string             `json:"collector"`
+	Default   FeeRate            `json:"default"`
+	Overrides map[string]FeeRate `json:"overrides"`
+}
+
+// FeeRateInfo 返回给客户端的费率，比例以基点（万分之一）表示
+type FeeRateInfo struct {
+	Flat        Amount `json:"flat"`
+	BasisPoints int    `json:"basis_points"`
+	Minimum     Amount `json:"minimum"`
+}
+
+// FeeScheduleInfo 返回给客户端的手续费配置
+type FeeScheduleInfo struct {
+	Collector string                 `json:"collector"`
+	Default   FeeRateInfo            `json:"default"`
+	Overrides map[string]FeeRateInfo `json:"overrides"`
+}
+
+// Info 转换为客户端视图
+func (r FeeRate) Info() FeeRateInfo {
+	return FeeRateInfo{Flat: Amount(r.Flat), BasisPoints: r.BasisPoints, Minimum: Amount(r.Minimum)}
+}
+
+// Info 转换为客户端视图
+func (f FeeSchedule) Info() FeeScheduleInfo {
+	overrides := make(map[string]FeeRateInfo, len(f.Overrides))
+	for symbol, rate := range f.Overrides {
+		overrides[symbol] = rate.Info()
+	}
+	return FeeScheduleInfo{Collector: f.Collector, Default: f.Default.Info(), Overrides: overrides}
+}
+
+// FeeQuote 与链码中的 FeeQuote 对应，金额单位为分
+type FeeQuote struct {
+	Symbol   string `json:"symbol"`
+	Currency string `json:"currency"`
+	Side     string `json:"side"`
+	Quantity int    `json:"quantity"`
+	Price    int64  `json:"priceCents"`
+	Notional int64  `json:"notionalCents"`
+	Fee      int64  `json:"feeCents"`
+	Total    int64  `json:"totalCents"`
+}
+
+// FeeQuoteInfo 返回给客户端的手续费预估，Total 买入为应付总额，卖出为扣除手续费后的所得
+type FeeQuoteInfo struct {
+	Symbol   string `json:"symbol"`
+	Currency string `json:"currency"`
+	Side     string `json:"side"`
+	Amount   int    `json:"amount"`
+	Price    Amount `json:"price"`
+	Notional Amount `json:"notional"`
+	Fee      Amount `json:"fee"`
+	Total    Amount `json:"total"`
+}
+
+// Info 转换为客户端视图
+func (q FeeQuote) Info() FeeQuoteInfo {
+	return FeeQuoteInfo{
+		Symbol:   q.Symbol,
+		Currency: q.Currency,
+		Side:     q.Side,
+		Amount:   q.Quantity,
+		Price:    Amount(q.Price),
+		Notional: Amount(q.Notional),
+		Fee:      Amount(q.Fee),
+		Total:    Amount(q.Total),
+	}
+}
+
+// DefaultCurrency 基准币种，与链码一致；未标注币种的股票按该币种计价
+const DefaultCurrency = "USD"
+
+// FXRate 与链码中的 FXRate 对应，Rate 为 1 单位该币种折合的 USD 金额 × 10^6
+type FXRate struct {
+	Currency  string `json:"currency"`
+	Rate      int64  `json:"rateMicros"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// FXRateInfo 返回给客户端的汇率，rate 为六位小数字符串
+type FXRateInfo struct {
+	Currency  string `json:"currency"`
+	Rate      Rate   `json:"rate"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Info 转换为客户端视图
+func (r FXRate) Info() FXRateInfo {
+	return FXRateInfo{Currency: r.Currency, Rate: Rate(r.Rate), UpdatedAt: r.UpdatedAt}
+}
+
+// ValuationLine 与链码中的 ValuationLine 对应，金额单位为分
+type ValuationLine struct {
+	Symbol    string `json:"symbol"`
+	Quantity  int    `json:"quantity"`
+	Currency  string `json:"currency"`
+	Value     int64  `json:"valueCents"`
+	Converted int64  `json:"convertedCents"`
+}
+
+// Valuation 与链码中的 Valuation 对应，金额单位为分
+type Valuation struct {
+	Username string          `json:"username"`
+	Currency string          `json:"currency"`
+	Total    int64           `json:"totalCents"`
+	Lines    []ValuationLine `json:"lines"`
+}
+
+// ValuationLineInfo 返回给客户端的估值明细，现金行没有 symbol 和 amount
+type ValuationLineInfo struct {
+	Symbol    string `json:"symbol,omitempty"`
+	Amount    int    `json:"amount,omitempty"`
+	Currency  string `json:"currency"`
+	Value     Amount `json:"value"`
+	Converted Amount `json:"converted"`
+}
+
+// ValuationInfo 返回给客户端的资产估值，total 与各行的 converted 以 currency 计价
+type ValuationInfo struct {
+	Username string              `json:"username"`
+	Currency string              `json:"currency"`
+	Total    Amount              `json:"total"`
+	Lines    []ValuationLineInfo `json:"lines"`
+}
+
+// Info 转换为客户端视图
+func (v Valuation) Info() ValuationInfo {
+	lines := make([]ValuationLineInfo, 0, len(v.Lines))
+	for _, line := range v.Lines {
+		lines = append(lines, ValuationLineInfo{
+			Symbol:    line.Symbol,
+			Amount:    line.Quantity,
+			Currency:  line.Currency,
+			Value:     Amount(line.Value),
+			Converted: Amount(line.Converted),
+		})
+	}
+	return ValuationInfo{Username: v.Username, Currency: v.Currency, Total: Amount(v.Total), Lines: lines}
+}
+
+// PositionPnL 与链码中的 PositionPnL 对应，金额单位为分
+type PositionPnL struct {
+	Symbol     string `json:"symbol"`
+	Currency   string `json:"currency"`
+	Quantity   int    `json:"quantity"`
+	Untracked  int    `json:"untracked"`
+	Price      int64  `json:"priceCents"`
+	Cost       int64  `json:"costCents"`
+	Value      int64  `json:"valueCents"`
+	Realized   int64  `json:"realizedCents"`
+	Unrealized int64  `json:"unrealizedCents"`
+}
+
+// UserPnL 与链码中的 UserPnL 对应
+type UserPnL struct {
+	Username  string        `json:"username"`
+	Method    string        `json:"method"`
+	Positions []PositionPnL `json:"positions"`
+}
+
+// PositionPnLInfo 返回给客户端的单只股票盈亏，金额以该股票的计价币种计；
+// untracked 为没有成本记录的股数，cost、value、unrealized 只包含有成本记录的部分
+type PositionPnLInfo struct {
+	Symbol     string `json:"symbol"`
+	Currency   string `json:"currency"`
+	Amount     int    `json:"amount"`
+	Untracked  int    `json:"untracked"`
+	Price      Amount `json:"price"`
+	Cost       Amount `json:"cost"`
+	Value      Amount `json:"value"`
+	Realized   Amount `json:"realized"`
+	Unrealized Amount `json:"unrealized"`
+}
+
+// UserPnLInfo 返回给客户端的用户盈亏
+type UserPnLInfo struct {
+	Username  string            `json:"username"`
+	Method    string            `json:"method"`
+	Positions []PositionPnLInfo `json:"positions"`
+}
+
+// Info 转换为客户端视图
+func (p UserPnL) Info() UserPnLInfo {
+	positions := make([]PositionPnLInfo, 0, len(p.Positions))
+	for _, position := range p.Positions {
+		positions = append(positions, PositionPnLInfo{
+			Symbol:     position.Symbol,
+			Currency:   position.Currency,
+			Amount:     position.Quantity,
+			Untracked:  position.Untracked,
+			Price:      Amount(position.Price),
+			Cost:       Amount(position.Cost),
+			Value:      Amount(position.Value),
+			Realized:   Amount(position.Realized),
+			Unrealized: Amount(position.Unrealized),
+		})
+	}
+	return UserPnLInfo{Username: p.Username, Method: p.Method, Positions: positions}
+}
+
+// PriceBar 与链码中的 PriceBar 对应，价格单位为分
+type PriceBar struct {
+	Start  string `json:"start"`
+	Open   int64  `json:"openCents"`
+	High   int64  `json:"highCents"`
+	Low    int64  `json:"lowCents"`
+	Close  int64  `json:"closeCents"`
+	Volume int    `json:"volume"`
+	Ticks  int    `json:"ticks"`
+}
+
+// PriceBarInfo 返回给客户端的 K 线，start 为周期起点（UTC）
+type PriceBarInfo struct {
+	Start  string `json:"start"`
+	Open   Amount `json:"open"`
+	High   Amount `json:"high"`
+	Low    Amount `json:"low"`
+	Close  Amount `json:"close"`
+	Volume int    `json:"volume"`
+}
+
+// Info 转换为客户端视图
+func (b PriceBar) Info() PriceBarInfo {
+	return PriceBarInfo{Start: b.Start, Open: Amount(b.Open), High: Amount(b.High), Low: Amount(b.Low), Close: Amount(b.Close), Volume: b.Volume}
+}
+
+// SupplyAudit 与链码中的 SupplyAudit 对应，float + held + escrowed 应等于 supply
+type SupplyAudit struct {
+	Symbol   string `json:"symbol"`
+	Supply   int    `json:"supply"`
+	Float    int    `json:"float"`
+	Held     int    `json:"held"`
+	Escrowed int    `json:"escrowed"`
+	Total    int    `json:"total"`
+	Balanced bool   `json:"balanced"`
+}
+
+// LedgerAudit 与链码中的 LedgerAudit 对应
+type LedgerAudit struct {
+	Stocks     []SupplyAudit `json:"stocks"`
+	Users      int           `json:"users"`
+	Violations []string      `json:"violations"`
+}
+
+// LedgerAuditInfo 返回给客户端的账本核对报告，ok 表示没有发现违规
+type LedgerAuditInfo struct {
+	OK         bool          `json:"ok"`
+	Stocks     []SupplyAudit `json:"stocks"`
+	Users      int           `json:"users"`
+	Violations []string      `json:"violations"`
+}
+
+// Info 转换为客户端视图
+func (a LedgerAudit) Info() LedgerAuditInfo {
+	stocks := a.Stocks
+	if stocks == nil {
+		stocks = []SupplyAudit{}
+	}
+	violations := a.Violations
+	if violations == nil {
+		violations = []string{}
+	}
+	return LedgerAuditInfo{OK: len(violations) == 0, Stocks: stocks, Users: a.Users, Violations: violations}
+}
+
+// ClientOrder 与链码中的 ClientOrder 对应，记录客户端订单号（Idempotency-Key）对应的已执行请求
+type ClientOrder struct {
+	Username      string `json:"username"`
+	ClientOrderID string `json:"clientOrderId"`
+	Function      string `json:"function"`
+	Request       string `json:"request"`
+	TxID          string `json:"txId"`
+	Timestamp     string `json:"timestamp"`
+	Result        string `json:"result"`
+}
+
+// ClientOrderInfo 返回给客户端的订单号记录，tx_id 为第一次执行该请求的交易
+type ClientOrderInfo struct {
+	Username      string `json:"username"`
+	ClientOrderID string `json:"client_order_id"`
+	Function      string `json:"function"`
+	TxID          string `json:"tx_id"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// Info 转换为客户端视图
+func (o ClientOrder) Info() ClientOrderInfo {
+	return ClientOrderInfo{Username: o.Username, ClientOrderID: o.ClientOrderID, Function: o.Function, TxID: o.TxID, Timestamp: o.Timestamp}
+}
+
+// Holding 与链码中的 Holding 和 Position 对应
+type Holding struct {
+	Username string `json:"username"`
+	Symbol   string `json:"symbol"`
+	Quantity int    `json:"quantity"`
+}
+
+// HoldingInfo 返回给客户端的持仓记录
+type HoldingInfo struct {
+	Username string `json:"username"`
+	Symbol   string `json:"symbol"`
+	Amount   int    `json:"amount"`
+}
+
+// Info 转换为客户端视图
+func (h Holding) Info() HoldingInfo {
+	return HoldingInfo{Username: h.Username, Symbol: h.Symbol, Amount: h.Quantity}
+}
+
+// UserBalance 与链码中的 UserBalance 对应，金额单位为分
+type UserBalance struct {
+	Name     string           `json:"name"`
+	Balance  int64            `json:"balanceCents"`
+	Balances map[string]int64 `json:"balancesCents"`
+}
+
+// UserBalanceInfo 返回给客户端的用户余额，balance 为 USD 余额，balances 为其他币种的余额
+type UserBalanceInfo struct {
+	Name     string            `json:"name"`
+	Balance  Amount            `json:"balance"`
+	Balances map[string]Amount `json:"balances"`
+}
+
+// Info 转换为客户端视图
+func (b UserBalance) Info() UserBalanceInfo {
+	balances := make(map[string]Amount, len(b.Balances))
+	for currency, cents := range b.Balances {
+		balances[currency] = Amount(cents)
+	}
+	return UserBalanceInfo{Name: b.Name, Balance: Amount(b.Balance), Balances: balances}
+}
+
+// BasketLeg 与链码中的 BasketLeg 对应，LimitPrice 单位为分
+type BasketLeg struct {
+	Symbol     string `json:"symbol"`
+	Side       string `json:"side"`
+	Quantity   int    `json:"quantity"`
+	LimitPrice int64  `json:"limitPriceCents"`
+}
+
+// LegResult 与链码中的 LegResult 对应，金额单位为分
+type LegResult struct {
+	Symbol   string `json:"symbol"`
+	Side     string `json:"side"`
+	Quantity int    `json:"quantity"`
+	Price    int64  `json:"priceCents"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amountCents"`
+	Fee      int64  `json:"feeCents"`
+	Realized int64  `json:"realizedCents"`
+}
+
+// LegResultInfo 返回给客户端的篮子单只股票成交结果
+type LegResultInfo struct {
+	Symbol   string `json:"symbol"`
+	Side     string `json:"side"`
+	Quantity int    `json:"quantity"`
+	Price    Amount `json:"price"`
+	Currency string `json:"currency"`
+	Amount   Amount `json:"amount"`
+	Fee      Amount `json:"fee"`
+	Realized Amount `json:"realized"`
+}
+
+// Info 转换为客户端视图
+func (l LegResult) Info() LegResultInfo {
+	return LegResultInfo{
+		Symbol:   l.Symbol,
+		Side:     l.Side,
+		Quantity: l.Quantity,
+		Price:    Amount(l.Price),
+		Currency: l.Currency,
+		Amount:   Amount(l.Amount),
+		Fee:      Amount(l.Fee),
+		Realized: Amount(l.Realized),
+	}
+}
+
+// BasketResult 与链码中的 BasketResult 对应，Net 为各币种现金净变动（分）
+type BasketResult struct {
+	Legs []LegResult      `json:"legs"`
+	Net  map[string]int64 `json:"netCents"`
+}
+
+// BasketResultInfo 返回给客户端的篮子委托结果，net 为负数表示净支出
+type BasketResultInfo struct {
+	Legs []LegResultInfo   `json:"legs"`
+	Net  map[string]Amount `json:"net"`
+}
+
+// Info 转换为客户端视图
+func (b BasketResult) Info() BasketResultInfo {
+	info := BasketResultInfo{Legs: make([]LegResultInfo, 0, len(b.Legs)), Net: make(map[string]Amount, len(b.Net))}
+	for _, leg := range b.Legs {
+		info.Legs = append(info.Legs, leg.Info())
+	}
+	for currency, cents := range b.Net {
+		info.Net[currency] = Amount(cents)
+	}
+	return info
+}
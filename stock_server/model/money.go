@@ -0,0 +1,248 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CentsPerUnit 一个货币单位包含的分数，与链码保持一致
+const CentsPerUnit = 100
+
+// Amount 金额，内部以分（int64）存储。
+// 对外 JSON 统一输出为两位小数的字符串（例如 "180.50"）；
+// 输入既可以是字符串也可以是数字字面量，按文本精确解析，不经过 float64。
+// 超过两位小数的非零部分直接拒绝，不做隐式四舍五入。
+type Amount int64
+
+// ParseAmount 将十进制字符串精确解析为分
+func ParseAmount(s string) (Amount, error) {
+	cents, err := parseDecimal(s, 2, "amount")
+	return Amount(cents), err
+}
+
+// parseDecimal 将十进制字符串精确解析为 places 位小数的定点整数，kind 用于错误信息
+func parseDecimal(s string, places int, kind string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty %s", kind)
+	}
+
+	neg := false
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("invalid %s %q", kind, s)
+	}
+
+	// 超出精度的部分必须全为 0
+	if len(fracPart) > places {
+		if strings.Trim(fracPart[places:], "0") != "" {
+			return 0, fmt.Errorf("%s %q has more than %d decimal places", kind, s, places)
+		}
+		fracPart = fracPart[:places]
+	}
+	for len(fracPart) < places {
+		fracPart += "0"
+	}
+
+	value, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q out of range", kind, s)
+	}
+	if neg {
+		value = -value
+	}
+	return value, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents 返回以分为单位的整数金额，用于传给链码
+func (a Amount) Cents() string {
+	return strconv.FormatInt(int64(a), 10)
+}
+
+// String 格式化为两位小数，例如 18050 -> "180.50"
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-a)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, u/CentsPerUnit, u%CentsPerUnit)
+}
+
+// MarshalJSON 输出为两位小数的字符串
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON 接受 "180.50" 或 180.5 两种写法
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else {
+		text = string(data)
+	}
+
+	parsed, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// ParseCents 解析链码返回的以分为单位的整数金额
+func ParseCents(result []byte) (Amount, error) {
+	cents, err := strconv.ParseInt(strings.TrimSpace(string(result)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return Amount(cents), nil
+}
+
+// RateScale 汇率精度，与链码的 FXRateScale 一致：汇率以 1 单位外币折合基准币种的金额 × 10^6 表示
+const RateScale = 1000000
+
+// Rate 汇率，内部以 10^6 倍的整数存储，对外 JSON 为六位小数的字符串（例如 "0.128000"），解析规则同 Amount
+type Rate int64
+
+// ParseRate 将十进制字符串精确解析为汇率
+func ParseRate(s string) (Rate, error) {
+	micros, err := parseDecimal(s, 6, "rate")
+	return Rate(micros), err
+}
+
+// Micros 返回 10^6 倍的整数汇率，用于传给链码
+func (r Rate) Micros() string {
+	return strconv.FormatInt(int64(r), 10)
+}
+
+// String 格式化为六位小数，例如 128000 -> "0.128000"
+func (r Rate) String() string {
+	sign := ""
+	u := uint64(r)
+	if r < 0 {
+		sign = "-"
+		u = uint64(-r)
+	}
+	return fmt.Sprintf("%s%d.%06d", sign, u/RateScale, u%RateScale)
+}
+
+// MarshalJSON 输出为六位小数的字符串
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON 接受 "0.128" 或 0.128 两种写法
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else {
+		text = string(data)
+	}
+
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// BasisPointsPerPercent 百分之一包含的基点（万分之一）数
+const BasisPointsPerPercent = 100
+
+// Percent 百分比，内部以基点（万分之一）存储，对外 JSON 为两位小数的字符串（例如 "7.50" 表示 7.5%），解析规则同 Amount
+type Percent int64
+
+// ParsePercent 将十进制字符串精确解析为百分比
+func ParsePercent(s string) (Percent, error) {
+	bps, err := parseDecimal(s, 2, "percent")
+	return Percent(bps), err
+}
+
+// BasisPoints 返回基点数，用于传给链码
+func (p Percent) BasisPoints() string {
+	return strconv.FormatInt(int64(p), 10)
+}
+
+// Valid 判断百分比是否在 0 到 100 之间
+func (p Percent) Valid() bool {
+	return p >= 0 && p <= 100*BasisPointsPerPercent
+}
+
+// String 格式化为两位小数，例如 750 -> "7.50"
+func (p Percent) String() string {
+	sign := ""
+	u := uint64(p)
+	if p < 0 {
+		sign = "-"
+		u = uint64(-p)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, u/BasisPointsPerPercent, u%BasisPointsPerPercent)
+}
+
+// MarshalJSON 输出为两位小数的字符串
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON 接受 "7.5" 或 7.5 两种写法
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else {
+		text = string(data)
+	}
+
+	parsed, err := ParsePercent(text)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
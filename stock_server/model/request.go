@@ -1,14 +1,151 @@
 package model
 
+import "encoding/json"
+
 type BuyStockRequest struct {
-	Username string  `json:"username"`
-	StockID  string  `json:"stock_id"`
-	Amount   int     `json:"amount"`
-	Payment  float64 `json:"payment"`
+	Username string `json:"username"`
+	StockID  string `json:"stock_id"`
+	Amount   int    `json:"amount"`
+	Payment  Amount `json:"payment"`
 }
 
 type SellStockRequest struct {
 	Username string `json:"username"`
 	StockID  string `json:"stock_id"`
 	Amount   int    `json:"amount"`
-}
\ No newline at end of file
+}
+
+type PlaceOrderRequest struct {
+	Username string `json:"username"`
+	StockID  string `json:"stock_id"`
+	Side     string `json:"side"`
+	Amount   int    `json:"amount"`
+	Price    Amount `json:"price"`
+}
+
+// ListStockRequest 上市新股票，Currency 为计价币种，为空时为 USD
+type ListStockRequest struct {
+	StockID  string `json:"stock_id"`
+	Price    Amount `json:"price"`
+	Quantity int    `json:"quantity"`
+	Currency string `json:"currency"`
+}
+
+type SetStockPriceRequest struct {
+	Price Amount `json:"price"`
+}
+
+type CreateUserRequest struct {
+	Username       string `json:"username"`
+	InitialBalance Amount `json:"initial_balance"`
+	RealName       string `json:"real_name"`
+	Email          string `json:"email"`
+}
+
+// AccountDetailsRequest 更新账户的个人资料
+type AccountDetailsRequest struct {
+	RealName string `json:"real_name"`
+	Email    string `json:"email"`
+}
+
+// AccountDetails 与链码中的 AccountDetails 对应，通过 transient map 传给链码
+type AccountDetails struct {
+	InitialBalance int64  `json:"initialBalanceCents"`
+	RealName       string `json:"realName"`
+	Email          string `json:"email"`
+}
+
+// CashRequest 存取现金，Currency 为空时为 USD
+type CashRequest struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+	Reason   string `json:"reason"`
+}
+
+type TransferSharesRequest struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	StockID string `json:"stock_id"`
+	Amount  int    `json:"amount"`
+}
+
+// TransferCashRequest 转账，Currency 为空时为 USD
+type TransferCashRequest struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Currency string `json:"currency"`
+	Amount   Amount `json:"amount"`
+}
+
+// BindAccountRequest 将账户绑定到某个用户的证书身份，Identity 为空时使用账户名
+type BindAccountRequest struct {
+	Identity string `json:"identity"`
+}
+
+// DeclareDividendRequest 宣布现金分红，RecordDate 格式为 YYYY-MM-DD
+type DeclareDividendRequest struct {
+	PerShare   Amount `json:"per_share"`
+	RecordDate string `json:"record_date"`
+}
+
+// SplitStockRequest 按 numerator:denominator 拆股，numerator 小于 denominator 时为合股
+type SplitStockRequest struct {
+	Numerator   int `json:"numerator"`
+	Denominator int `json:"denominator"`
+}
+
+// HaltStockRequest 停牌，Reason 为 news_pending / regulatory / operational
+type HaltStockRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CircuitBreakerRequest 设置熔断阈值，百分比最多两位小数，例如 "7.5" 表示偏离参考价 7.5%，"0" 关闭熔断
+type CircuitBreakerRequest struct {
+	ThresholdPercent Percent `json:"threshold_percent"`
+}
+
+// FeeRateRequest 费率：每笔固定费用、按成交金额收取的基点（万分之一）、每笔最低收费
+type FeeRateRequest struct {
+	Flat        Amount `json:"flat"`
+	BasisPoints int    `json:"basis_points"`
+	Minimum     Amount `json:"minimum"`
+}
+
+// FeeScheduleRequest 设置手续费账户和默认费率
+type FeeScheduleRequest struct {
+	Collector string `json:"collector"`
+	FeeRateRequest
+}
+
+// FXRateRequest 设置汇率：1 单位该币种折合的 USD 金额，最多六位小数，例如 "0.128"
+type FXRateRequest struct {
+	Rate Rate `json:"rate"`
+}
+
+// CostBasisMethodRequest 设置成本计算方法：fifo（先进先出）或 average（移动平均）
+type CostBasisMethodRequest struct {
+	Method string `json:"method"`
+}
+
+// QueryRequest 富查询：type 为 holdings / stocks / balances，selector 为 CouchDB 查询条件（JSON 对象），
+// page_size 大于 0 时分页返回，bookmark 为上一页返回的书签
+type QueryRequest struct {
+	Type     string          `json:"type"`
+	Selector json.RawMessage `json:"selector"`
+	PageSize int             `json:"page_size"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// BasketLegRequest 篮子委托中的一只股票，LimitPrice 为限价
+type BasketLegRequest struct {
+	StockID    string `json:"stock_id"`
+	Side       string `json:"side"`
+	Amount     int    `json:"amount"`
+	LimitPrice Amount `json:"limit_price"`
+}
+
+// SubmitBasketRequest 在一笔交易内买卖多只股票，全部成交或全部不成交
+type SubmitBasketRequest struct {
+	Username string             `json:"username"`
+	Legs     []BasketLegRequest `json:"legs"`
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+	"server/config"
+)
+
+// ContractPool 为每个用户维护一个以其身份签名的 Gateway 连接，底层共享同一条 gRPC 连接
+type ContractPool struct {
+	conn *grpc.ClientConn
+
+	mu       sync.Mutex
+	gateways map[string]*client.Gateway
+}
+
+func NewContractPool(conn *grpc.ClientConn) *ContractPool {
+	return &ContractPool{conn: conn, gateways: make(map[string]*client.Gateway)}
+}
+
+// For 返回以 username 身份签名的合约，首次使用时从 config.UserMSPPath 读取证书和私钥
+func (p *ContractPool) For(username string) (*client.Contract, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	gw, ok := p.gateways[username]
+	if !ok {
+		id, sign, err := config.LoadUserIdentity(username)
+		if err != nil {
+			return nil, err
+		}
+		gw, err = client.Connect(id, client.WithSign(sign), client.WithClientConnection(p.conn))
+		if err != nil {
+			return nil, err
+		}
+		p.gateways[username] = gw
+	}
+
+	return gw.GetNetwork(config.ChannelName).GetContract(config.ChaincodeName), nil
+}
+
+// Close 关闭所有用户的 Gateway 连接
+func (p *ContractPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for username, gw := range p.gateways {
+		gw.Close()
+		delete(p.gateways, username)
+	}
+}